@@ -0,0 +1,414 @@
+// Code generated by cmd/openapi from api/openapi.json. DO NOT EDIT.
+
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Client calls the Catch and Go API, version 1.0.0.
+type Client struct {
+	// BaseURL is where the server is reached, like "https://example.com".
+	BaseURL string
+	// Token is the bearer token of the requests, the one of a session.
+	Token      string
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client of the server at baseURL, authenticated with token.
+func NewClient(baseURL, token string) *Client {
+	return &Client{BaseURL: baseURL, Token: token, HTTPClient: http.DefaultClient}
+}
+
+// ResponseError is returned for the responses with an error status.
+type ResponseError struct {
+	StatusCode int
+	// Body is the decoded error response, nil when the response wasn't one.
+	Body *ErrorResponse
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// do sends a request with a JSON body, if any, and decodes the JSON response into out, if any.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		resErr := &ResponseError{StatusCode: res.StatusCode}
+		var body ErrorResponse
+		if json.NewDecoder(res.Body).Decode(&body) == nil {
+			resErr.Body = &body
+		}
+		return resErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding the response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// CreateDashboardRequest is a dashboard to add to the session.
+type CreateDashboardRequest struct {
+	// Show the departures of every platform of the station of the stop.
+	FollowStation bool  `json:"follow_station"`
+	StopID        int64 `json:"stop_id"`
+}
+
+// Dashboard is a stop followed by a session.
+type Dashboard struct {
+	CreatedAt *time.Time `json:"created_at"`
+	// The dashboard shows the departures of every platform of the station of its stop.
+	FollowStation bool  `json:"follow_station"`
+	ID            int64 `json:"id"`
+	Stop          Stop  `json:"stop"`
+}
+
+// DashboardPage is a page of a list of Dashboard.
+type DashboardPage struct {
+	Data       []Dashboard `json:"data"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+// DashboardResponse is a response holding Dashboard.
+type DashboardResponse struct {
+	Data Dashboard `json:"data"`
+}
+
+// Departure is an upcoming departure.
+type Departure struct {
+	Destination Text `json:"destination"`
+	// The vehicle is arriving within the minute.
+	Due        bool      `json:"due"`
+	ExpectedAt time.Time `json:"expected_at"`
+	Line       Line      `json:"line"`
+	// The number of whole minutes until expected_at, 0 when due.
+	Minutes int `json:"minutes"`
+}
+
+// Departures is a board of the upcoming departures of a stop, soonest first, and of the disruptions affecting it.
+type Departures struct {
+	Departures  []Departure `json:"departures"`
+	Disruptions []Text      `json:"disruptions"`
+	FetchedAt   time.Time   `json:"fetched_at"`
+	// The real-time provider couldn't be reached and older data is served.
+	Stale bool `json:"stale"`
+}
+
+// DeparturesResponse is a response holding Departures.
+type DeparturesResponse struct {
+	Data Departures `json:"data"`
+}
+
+// Direction is a line heading to one of its terminuses.
+type Direction struct {
+	Destination Text `json:"destination"`
+	// Whether the line heads to the suburbs or to the city.
+	Direction string `json:"direction"`
+	ID        int64  `json:"id"`
+	LineCode  string `json:"line_code"`
+}
+
+// DirectionList is a list of Direction.
+type DirectionList struct {
+	Data []Direction `json:"data"`
+}
+
+// Error is a code for programs to branch on, and a message for people.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse is the body of the responses with an error status.
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+// Line is a line regardless of its direction.
+type Line struct {
+	Code      string `json:"code"`
+	Color     string `json:"color"`
+	Mode      string `json:"mode"`
+	TextColor string `json:"text_color"`
+}
+
+// LinePage is a page of a list of Line.
+type LinePage struct {
+	Data       []Line     `json:"data"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// Pagination is the position of a page in its list.
+type Pagination struct {
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
+	Total   int `json:"total"`
+}
+
+// Session is an anonymous session, the token is sent as a bearer token.
+type Session struct {
+	Locale string `json:"locale"`
+	Theme  string `json:"theme"`
+	Token  string `json:"token"`
+}
+
+// SessionResponse is a response holding Session.
+type SessionResponse struct {
+	Data Session `json:"data"`
+}
+
+// Stop is a stop, or a platform of a station.
+type Stop struct {
+	Code string `json:"code"`
+	// In meters from the searched position, for the nearby stops.
+	Distance *int    `json:"distance,omitempty"`
+	ID       int64   `json:"id"`
+	Latitude float64 `json:"latitude"`
+	// The codes of the lines serving the stop, when they are listed.
+	Lines     []string `json:"lines,omitempty"`
+	Longitude float64  `json:"longitude"`
+	Name      Text     `json:"name"`
+	// The station of the platform, if any.
+	StationID *int64 `json:"station_id"`
+}
+
+// StopList is a list of Stop.
+type StopList struct {
+	Data []Stop `json:"data"`
+}
+
+// StopResponse is a response holding Stop.
+type StopResponse struct {
+	Data Stop `json:"data"`
+}
+
+// Text is a text in French and in Dutch.
+type Text struct {
+	FR string `json:"fr"`
+	NL string `json:"nl"`
+}
+
+// GetOpenAPI returns this document.
+func (c *Client) GetOpenAPI(ctx context.Context) (map[string]any, error) {
+	var out map[string]any
+	if err := c.do(ctx, http.MethodGet, "/api/openapi.json", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListDashboardsParams are the query parameters of ListDashboards.
+type ListDashboardsParams struct {
+	// The page, starting at 1
+	Page int
+	// The number of items of a page, 50 by default and 200 at most
+	PerPage int
+}
+
+// ListDashboards lists the dashboards of the session.
+func (c *Client) ListDashboards(ctx context.Context, params ListDashboardsParams) (*DashboardPage, error) {
+	query := url.Values{}
+	if params.Page != 0 {
+		query.Set("page", strconv.Itoa(params.Page))
+	}
+	if params.PerPage != 0 {
+		query.Set("per_page", strconv.Itoa(params.PerPage))
+	}
+	var out DashboardPage
+	if err := c.do(ctx, http.MethodGet, "/api/v1/dashboards", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateDashboard adds a dashboard to the session.
+func (c *Client) CreateDashboard(ctx context.Context, body CreateDashboardRequest) (*DashboardResponse, error) {
+	var out DashboardResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/dashboards", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteDashboard removes a dashboard of the session, succeeding when it is already gone.
+func (c *Client) DeleteDashboard(ctx context.Context, dashboardID int64) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/dashboards/"+url.PathEscape(strconv.FormatInt(dashboardID, 10)), nil, nil, nil)
+}
+
+// ListDashboardDepartures returns the upcoming departures of a dashboard, of its stop or of every platform of its station.
+func (c *Client) ListDashboardDepartures(ctx context.Context, dashboardID int64) (*DeparturesResponse, error) {
+	var out DeparturesResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/dashboards/"+url.PathEscape(strconv.FormatInt(dashboardID, 10))+"/departures", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDirectionStops lists the stops of a direction in the order they are served.
+func (c *Client) ListDirectionStops(ctx context.Context, lineID int64) (*StopList, error) {
+	var out StopList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/directions/"+url.PathEscape(strconv.FormatInt(lineID, 10))+"/stops", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListLinesParams are the query parameters of ListLines.
+type ListLinesParams struct {
+	// The page, starting at 1
+	Page int
+	// The number of items of a page, 50 by default and 200 at most
+	PerPage int
+}
+
+// ListLines lists the lines of the network, in the order of the line picker.
+func (c *Client) ListLines(ctx context.Context, params ListLinesParams) (*LinePage, error) {
+	query := url.Values{}
+	if params.Page != 0 {
+		query.Set("page", strconv.Itoa(params.Page))
+	}
+	if params.PerPage != 0 {
+		query.Set("per_page", strconv.Itoa(params.PerPage))
+	}
+	var out LinePage
+	if err := c.do(ctx, http.MethodGet, "/api/v1/lines", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDirections lists the directions of a line.
+func (c *Client) ListDirections(ctx context.Context, lineCode string) (*DirectionList, error) {
+	var out DirectionList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/lines/"+url.PathEscape(lineCode)+"/directions", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateSession starts an anonymous session, whose token authenticates the other requests.
+func (c *Client) CreateSession(ctx context.Context) (*SessionResponse, error) {
+	var out SessionResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/sessions", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SearchStopsParams are the query parameters of SearchStops.
+type SearchStopsParams struct {
+	// The searched name, at least 2 letters
+	Q string
+	// The number of stops, 10 by default and 50 at most
+	Limit int
+}
+
+// SearchStops finds the stops by their French or Dutch name, accents and typos included.
+func (c *Client) SearchStops(ctx context.Context, params SearchStopsParams) (*StopList, error) {
+	query := url.Values{}
+	query.Set("q", params.Q)
+	if params.Limit != 0 {
+		query.Set("limit", strconv.Itoa(params.Limit))
+	}
+	var out StopList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/stops", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListNearbyStopsParams are the query parameters of ListNearbyStops.
+type ListNearbyStopsParams struct {
+	// The latitude of the position
+	Lat float64
+	// The longitude of the position
+	Lon float64
+	// In meters, 500 by default and 2000 at most
+	Radius float64
+}
+
+// ListNearbyStops lists the stops around a position, closest first.
+func (c *Client) ListNearbyStops(ctx context.Context, params ListNearbyStopsParams) (*StopList, error) {
+	query := url.Values{}
+	query.Set("lat", strconv.FormatFloat(params.Lat, 'f', -1, 64))
+	query.Set("lon", strconv.FormatFloat(params.Lon, 'f', -1, 64))
+	if params.Radius != 0 {
+		query.Set("radius", strconv.FormatFloat(params.Radius, 'f', -1, 64))
+	}
+	var out StopList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/stops/nearby", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetStop returns a stop and the lines serving it.
+func (c *Client) GetStop(ctx context.Context, stopCode string) (*StopResponse, error) {
+	var out StopResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/stops/"+url.PathEscape(stopCode), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListStopDepartures returns the upcoming departures of a stop.
+func (c *Client) ListStopDepartures(ctx context.Context, stopCode string) (*DeparturesResponse, error) {
+	var out DeparturesResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/stops/"+url.PathEscape(stopCode)+"/departures", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetHealth returns the health of the database and of the real-time provider.
+func (c *Client) GetHealth(ctx context.Context) (map[string]string, error) {
+	var out map[string]string
+	if err := c.do(ctx, http.MethodGet, "/health", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,54 @@
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": {"code": "unauthorized", "message": "A bearer token is required"}}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v1/stops/nearby":
+			if q := r.URL.Query(); q.Get("lat") != "50.8466" || q.Get("lon") != "4.3528" || q.Has("radius") {
+				t.Errorf("unexpected query %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"data": [{"id": 1, "code": "8042", "name": {"fr": "ARTS-LOI", "nl": "KUNST-WET"}, "station_id": null, "distance": 120}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": "stop_not_found", "message": "No stop has the code \"9999\""}}`))
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := NewClient(srv.URL, "token")
+
+	stops, err := c.ListNearbyStops(ctx, ListNearbyStopsParams{Lat: 50.8466, Lon: 4.3528})
+	if err != nil {
+		t.Fatalf("ListNearbyStops() error = %v", err)
+	}
+	if len(stops.Data) != 1 || stops.Data[0].Name.NL != "KUNST-WET" || *stops.Data[0].Distance != 120 || stops.Data[0].StationID != nil {
+		t.Errorf("ListNearbyStops() = %+v", stops.Data)
+	}
+
+	_, err = c.GetStop(ctx, "9999")
+	var resErr *ResponseError
+	if !errors.As(err, &resErr) || resErr.StatusCode != http.StatusNotFound || resErr.Body == nil || resErr.Body.Error.Code != "stop_not_found" {
+		t.Errorf("GetStop() error = %v, want the error response of the server", err)
+	}
+
+	_, err = NewClient(srv.URL, "").ListLines(ctx, ListLinesParams{})
+	if !errors.As(err, &resErr) || resErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("ListLines() without token error = %v, want a 401", err)
+	}
+}
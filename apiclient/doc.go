@@ -0,0 +1,10 @@
+// Package apiclient is a client of the JSON API of the server, generated from
+// its OpenAPI document by cmd/openapi. Run `make openapi` after changing the API.
+//
+//	c := apiclient.NewClient("https://example.com", token)
+//	page, err := c.ListDashboards(ctx, apiclient.ListDashboardsParams{})
+//
+// The responses with an error status are returned as a *ResponseError.
+package apiclient
+
+//go:generate go run ../cmd/openapi -root ..
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/jp-roisin/catch-and-go/internal/database"
 	"github.com/jp-roisin/catch-and-go/internal/server"
 )
 
@@ -38,6 +40,26 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 }
 
 func main() {
+	migrateOnly := flag.Bool("migrate-only", false, "apply the pending migrations and exit")
+	dumpSchema := flag.Bool("dump-schema", false, "print the schema the migrations create (the content of schema.sql) and exit")
+	flag.Parse()
+
+	if *dumpSchema {
+		schema, err := database.MigratedSchema(context.Background())
+		if err != nil {
+			log.Fatalf("Couldn't dump the schema: %v", err)
+		}
+		fmt.Print(schema)
+		return
+	}
+
+	if *migrateOnly {
+		// New applies the migrations
+		if err := database.New().Close(); err != nil {
+			log.Fatalf("Couldn't close the database: %v", err)
+		}
+		return
+	}
 
 	server := server.NewServer()
 
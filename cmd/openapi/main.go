@@ -0,0 +1,60 @@
+// Command openapi writes the OpenAPI document of the server to api/openapi.json,
+// and generates the Go client of the apiclient package from that document.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/jp-roisin/catch-and-go/internal/openapi"
+	"github.com/jp-roisin/catch-and-go/internal/server"
+)
+
+const (
+	specPath   = "api/openapi.json"
+	clientPath = "apiclient/client.gen.go"
+)
+
+var clientOptions = openapi.ClientOptions{
+	Package:     "apiclient",
+	Source:      specPath,
+	ErrorSchema: "ErrorResponse",
+}
+
+func main() {
+	root := flag.String("root", ".", "the root of the repository")
+	flag.Parse()
+
+	spec, client, err := generate()
+	if err != nil {
+		log.Fatalf("❌ Generation failed: %v", err)
+	}
+
+	for path, content := range map[string][]byte{specPath: spec, clientPath: client} {
+		if err := os.WriteFile(filepath.Join(*root, path), content, 0o644); err != nil {
+			log.Fatalf("❌ Writing %s failed: %v", path, err)
+		}
+		log.Printf("✅ %s written", path)
+	}
+}
+
+// generate renders the document of the server, and the client of the document
+// as it is read back from the file.
+func generate() (spec, client []byte, err error) {
+	spec, err = server.OpenAPIDocument().Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, err := openapi.Parse(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err = openapi.GenerateClient(doc, clientOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+	return spec, client, nil
+}
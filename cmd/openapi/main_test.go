@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestGeneratedFilesAreUpToDate fails when the API changed without running
+// `make openapi`.
+func TestGeneratedFilesAreUpToDate(t *testing.T) {
+	spec, client, err := generate()
+	if err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+
+	for path, want := range map[string][]byte{specPath: spec, clientPath: client} {
+		got, err := os.ReadFile(filepath.Join("..", "..", path))
+		if err != nil {
+			t.Fatalf("reading %s: %v", path, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is out of date, run `make openapi`", path)
+		}
+	}
+}
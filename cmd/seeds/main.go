@@ -3,50 +3,130 @@ package main
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
+	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/jp-roisin/catch-and-go/internal/database"
 	"github.com/jp-roisin/catch-and-go/internal/database/seeds"
+	"github.com/jp-roisin/catch-and-go/internal/externalapi"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+const usage = `Usage:
+  seeds [csv]                        seed from the STIB CSV exports in internal/database/seeds/data
+  seeds gtfs <zip>                   seed from a GTFS static archive
+  seeds validate [csv | gtfs <zip>]  report every problem of the input files, without touching the database
+  seeds fetch                        download the STIB datasets into internal/database/seeds/data
+`
+
 func main() {
-	service := database.New()
-	dburl := os.Getenv("BLUEPRINT_DB_URL")
-	db, err := sql.Open("sqlite3", dburl)
-	if err != nil {
-		log.Fatalf("❌ Failed to open DB: %v", err)
+	command := "csv"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
 	}
-	defer db.Close()
 
-	ctx := context.Background()
+	switch command {
+	case "csv":
+		seedCSV()
+	case "gtfs":
+		if len(os.Args) != 3 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		seedGTFS(os.Args[2])
+	case "validate":
+		validate(os.Args[2:])
+	case "fetch":
+		fetch()
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
 
-	if err := seeds.SeedStops(ctx, db); err != nil {
-		log.Fatalf("❌ Stops seeding failed:\n %v", err)
+// validate exits with status 1 when the input files have errors,
+// so that it can run in CI.
+func validate(args []string) {
+	var report seeds.Report
+	switch {
+	case len(args) == 0 || (len(args) == 1 && args[0] == "csv"):
+		report = seeds.ValidateSTIBCSV()
+	case len(args) == 2 && args[0] == "gtfs":
+		report = seeds.ValidateGTFS(args[1])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
 	}
-	log.Println("✅ Stops seeding successful")
 
-	if err := seeds.SeedLines(ctx, db); err != nil {
-		log.Fatalf("❌ Lines seeding failed:\n %v", err)
+	fmt.Println(report)
+	if len(report.Errors) > 0 {
+		os.Exit(1)
 	}
-	log.Println("✅ Lines seeding successful")
+}
 
-	if err := seeds.SeedLinesMetadatas(ctx, db); err != nil {
-		log.Fatalf("❌ Lines metadata seeding failed:\n %v", err)
+// fetch uses the STIB_API_KEY and STIB_API_URL of the real-time client.
+// The exports are a few megabytes, so STIB_TIMEOUT defaults to a minute here.
+func fetch() {
+	opts, err := externalapi.ClientOptionsFromEnv()
+	if err != nil {
+		log.Fatalf("❌ Invalid client options: %v", err)
+	}
+	if os.Getenv("STIB_TIMEOUT") == "" {
+		opts.Timeout = time.Minute
 	}
-	log.Println("✅ Lines metadata seeding successful")
+	client := externalapi.NewSTIBClient(os.Getenv("STIB_API_URL"), os.Getenv("STIB_API_KEY"), opts)
 
-	if err := seeds.SeedStopsByLines(ctx, db, service); err != nil {
-		log.Fatalf("❌ Stops by Lines seeding failed:\n %v", err)
+	result, err := seeds.FetchSTIBDatasets(context.Background(), client, seeds.DataDir, time.Now().UTC())
+	if err != nil {
+		log.Fatalf("❌ Fetching the datasets failed:\n %v", err)
 	}
-	log.Println("✅ Stops by Lines seeding successful")
+	fmt.Println(result)
+	log.Println("✅ Fetch complete")
+}
 
-	if err := seeds.SeedLinesTextColors(ctx, db, service); err != nil {
-		log.Fatalf("❌ Lines text colors seeding failed:\n %v", err)
+func openDB() *sql.DB {
+	dburl := os.Getenv("BLUEPRINT_DB_URL")
+	db, err := sql.Open("sqlite3", dburl)
+	if err != nil {
+		log.Fatalf("❌ Failed to open DB: %v", err)
 	}
-	log.Println("✅ Lines text colors seeding successful")
+	if err := database.Migrate(context.Background(), db); err != nil {
+		log.Fatalf("❌ Failed to migrate DB: %v", err)
+	}
+	return db
+}
+
+func seedGTFS(path string) {
+	network, err := seeds.ReadGTFS(path)
+	if err != nil {
+		log.Fatalf("❌ GTFS reading failed:\n %v", err)
+	}
+	log.Printf("✅ GTFS read: %d stops, %d lines", len(network.Stops), len(network.Lines))
+
+	syncNetwork(network)
+}
+
+func seedCSV() {
+	network, err := seeds.ReadSTIBCSV()
+	if err != nil {
+		log.Fatalf("❌ CSV reading failed:\n %v", err)
+	}
+	log.Printf("✅ CSV read: %d stops, %d lines", len(network.Stops), len(network.Lines))
+
+	syncNetwork(network)
+}
 
+func syncNetwork(network seeds.Network) {
+	db := openDB()
+	defer db.Close()
+
+	report, err := seeds.SyncNetwork(context.Background(), db, network)
+	if err != nil {
+		log.Fatalf("❌ Network seeding failed:\n %v", err)
+	}
+	fmt.Println(report)
 	log.Println("✅ Seeding complete")
 }
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/jp-roisin/catch-and-go/internal/externalapi/stibmock"
+)
+
+// stibmock serves the STIB real-time records endpoint locally, from a scenario file.
+// Point the API at it with:
+//
+//	STIB_API_URL=http://localhost:8090/api/explore/v2.1/catalog/datasets
+func main() {
+	addr := flag.String("addr", ":8090", "address to listen on")
+	scenarioPath := flag.String("scenario", "cmd/stibmock/scenarios/default.json", "scenario file to serve")
+	flag.Parse()
+
+	scenario, err := stibmock.LoadScenario(*scenarioPath)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	log.Printf("✅ Serving %s on %s%s", *scenarioPath, *addr, stibmock.DatasetsPath)
+	if err := http.ListenAndServe(*addr, stibmock.NewHandler(scenario)); err != nil {
+		log.Fatalf("❌ stibmock server error: %v", err)
+	}
+}
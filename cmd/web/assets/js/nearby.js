@@ -0,0 +1,22 @@
+// Lists the stops around the position of the device in the target element,
+// or falls back to the line picker when the position isn't available.
+function jsNearbyStops(target) {
+  const swap = (path) => htmx.ajax('GET', path, { target: target, swap: 'outerHTML' });
+
+  if (!navigator.geolocation) {
+    swap('/lines/picker');
+    return;
+  }
+
+  navigator.geolocation.getCurrentPosition(
+    (position) => {
+      const params = new URLSearchParams({
+        lat: position.coords.latitude,
+        lon: position.coords.longitude,
+      });
+      swap('/stops/nearby?' + params);
+    },
+    () => swap('/lines/picker'),
+    { enableHighAccuracy: true, timeout: 10000, maximumAge: 60000 },
+  );
+}
@@ -29,21 +29,34 @@ type Service interface {
 	CreateSession(ctx context.Context, token string) (store.Session, error)
 	UpdateLocale(ctx context.Context, param store.UpdateLocaleParams) error
 	UpdateTheme(ctx context.Context, param store.UpdateThemeParams) error
+	TouchSession(ctx context.Context, param store.TouchSessionParams) error
 
 	GetLine(ctx context.Context, param store.GetLineParams) (store.Line, error)
+	GetLineById(ctx context.Context, id int64) (store.Line, error)
 	ListLines(ctx context.Context) ([]store.Line, error)
 	ListLinesByDirection(ctx context.Context, direction int) ([]store.Line, error)
 	ListLinesByCode(ctx context.Context, code string) ([]store.Line, error)
 
 	GetStop(ctx context.Context, code string) (store.Stop, error)
+	GetStopById(ctx context.Context, id int64) (store.Stop, error)
+	// SearchStops finds the stops by their French or Dutch name, see search.go.
+	SearchStops(ctx context.Context, query string, limit int) ([]store.Stop, error)
+	// ListStopsNearby returns the stops within radius meters of a position, closest first.
+	ListStopsNearby(ctx context.Context, latitude, longitude, radius float64, limit int) ([]NearbyStop, error)
+	// ListStopCodesFromStation returns the codes of the platforms of a station.
+	ListStopCodesFromStation(ctx context.Context, stationID int64) ([]string, error)
 
 	ListStopsFromLine(ctx context.Context, id int) ([]store.Stop, error)
+	ListLineCodesFromStop(ctx context.Context, stopID int64) ([]string, error)
 
 	CreateDashboard(ctx context.Context, param store.CreatedashboardParams) (store.Dashboard, error)
 	ListDashboardsFromSession(ctx context.Context, sessionID string) ([]store.ListDashboardsFromSessionRow, error)
 	DeleteDashboard(ctx context.Context, param store.DeleteDashboardParams) error
 	GetDashboardById(ctx context.Context, param store.GetDashboardByIdParams) (store.Dashboard, error)
 	GetDashboardByIdWithStopInfo(ctx context.Context, param store.GetDashboardByIdWithStopInfoParams) (store.GetDashboardByIdWithStopInfoRow, error)
+	// ListWatchedStopCodes returns the stop codes followed by sessions active since the given time,
+	// most recently active first.
+	ListWatchedStopCodes(ctx context.Context, since time.Time) ([]string, error)
 }
 
 type service struct {
@@ -56,6 +69,8 @@ var (
 	dbInstance *service
 )
 
+// New opens the database and applies the pending migrations. It exits when the
+// schema version is unknown to this build.
 func New() Service {
 	// Reuse Connection
 	if dbInstance != nil {
@@ -69,6 +84,10 @@ func New() Service {
 		log.Fatal(err)
 	}
 
+	if err := Migrate(context.Background(), db); err != nil {
+		log.Fatalf("Couldn't migrate the database: %v", err)
+	}
+
 	dbInstance = &service{
 		db:      db,
 		queries: store.New(db),
@@ -148,6 +167,10 @@ func (s *service) GetLine(ctx context.Context, param store.GetLineParams) (store
 	return s.queries.GetLine(ctx, param)
 }
 
+func (s *service) GetLineById(ctx context.Context, id int64) (store.Line, error) {
+	return s.queries.GetLineById(ctx, id)
+}
+
 func (s *service) ListLines(ctx context.Context) ([]store.Line, error) {
 	return s.queries.ListLines(ctx)
 }
@@ -164,6 +187,14 @@ func (s *service) GetStop(ctx context.Context, code string) (store.Stop, error)
 	return s.queries.GetStop(ctx, code)
 }
 
+func (s *service) GetStopById(ctx context.Context, id int64) (store.Stop, error) {
+	return s.queries.GetStopById(ctx, id)
+}
+
+func (s *service) ListStopCodesFromStation(ctx context.Context, stationID int64) ([]string, error) {
+	return s.queries.ListStopCodesFromStation(ctx, sql.NullInt64{Int64: stationID, Valid: true})
+}
+
 func (s *service) UpdateLocale(ctx context.Context, param store.UpdateLocaleParams) error {
 	return s.queries.UpdateLocale(ctx, param)
 }
@@ -172,10 +203,18 @@ func (s *service) UpdateTheme(ctx context.Context, param store.UpdateThemeParams
 	return s.queries.UpdateTheme(ctx, param)
 }
 
+func (s *service) TouchSession(ctx context.Context, param store.TouchSessionParams) error {
+	return s.queries.TouchSession(ctx, param)
+}
+
 func (s *service) ListStopsFromLine(ctx context.Context, id int) ([]store.Stop, error) {
 	return s.queries.ListStopsFromLine(ctx, int64(id))
 }
 
+func (s *service) ListLineCodesFromStop(ctx context.Context, stopID int64) ([]string, error) {
+	return s.queries.ListLineCodesFromStop(ctx, stopID)
+}
+
 func (s *service) CreateDashboard(ctx context.Context, param store.CreatedashboardParams) (store.Dashboard, error) {
 	return s.queries.Createdashboard(ctx, param)
 }
@@ -195,3 +234,7 @@ func (s *service) GetDashboardById(ctx context.Context, param store.GetDashboard
 func (s *service) GetDashboardByIdWithStopInfo(ctx context.Context, param store.GetDashboardByIdWithStopInfoParams) (store.GetDashboardByIdWithStopInfoRow, error) {
 	return s.queries.GetDashboardByIdWithStopInfo(ctx, param)
 }
+
+func (s *service) ListWatchedStopCodes(ctx context.Context, since time.Time) ([]string, error) {
+	return s.queries.ListWatchedStopCodes(ctx, sql.NullTime{Time: since, Valid: true})
+}
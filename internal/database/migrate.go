@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pressly/goose/v3"
+)
+
+//go:embed migrations/*.sql
+var embeddedMigrations embed.FS
+
+// ErrUnknownSchemaVersion is returned when the database was migrated by a more
+// recent build, whose migrations this one doesn't know about.
+var ErrUnknownSchemaVersion = errors.New("unknown schema version")
+
+// Migrate applies the pending migrations embedded in the binary. The versions
+// are recorded in the goose_db_version table, like the goose CLI does.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	migrations, err := fs.Sub(embeddedMigrations, "migrations")
+	if err != nil {
+		return err
+	}
+
+	provider, err := goose.NewProvider(goose.DialectSQLite3, db, migrations)
+	if err != nil {
+		return fmt.Errorf("failed to load the migrations: %w", err)
+	}
+
+	if err := checkSchemaVersion(ctx, provider); err != nil {
+		return err
+	}
+
+	results, err := provider.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to migrate: %w", err)
+	}
+	for _, r := range results {
+		log.Printf("Applied migration %s in %v", r.Source.Path, r.Duration)
+	}
+	return nil
+}
+
+// checkSchemaVersion refuses a database whose version isn't one of the embedded
+// migrations: serving it could read and write columns that don't exist anymore.
+func checkSchemaVersion(ctx context.Context, provider *goose.Provider) error {
+	current, latest, err := provider.GetVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read the schema version: %w", err)
+	}
+	if current == 0 {
+		return nil
+	}
+
+	for _, s := range provider.ListSources() {
+		if s.Version == current {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %d, the latest known migration is %d", ErrUnknownSchemaVersion, current, latest)
+}
+
+// DumpSchema returns the statements creating the tables, indexes and triggers of db
+// in the format of schema.sql, including the shadow tables of the virtual ones.
+func DumpSchema(ctx context.Context, db *sql.DB) (string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT sql FROM sqlite_master WHERE sql IS NOT NULL ORDER BY rowid")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var sb strings.Builder
+	for rows.Next() {
+		var statement string
+		if err := rows.Scan(&statement); err != nil {
+			return "", err
+		}
+		sb.WriteString(statement + ";\n")
+	}
+	return sb.String(), rows.Err()
+}
+
+// MigratedSchema applies the migrations to a scratch database and returns its schema,
+// which is what schema.sql must hold.
+func MigratedSchema(ctx context.Context) (string, error) {
+	dir, err := os.MkdirTemp("", "schema")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "store.db"))
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	if err := Migrate(ctx, db); err != nil {
+		return "", err
+	}
+	return DumpSchema(ctx, db)
+}
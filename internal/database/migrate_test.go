@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openMigratedDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	return db
+}
+
+// schema.sql is read by sqlc and the tests, it must follow the migrations.
+func TestSchemaMatchesMigrations(t *testing.T) {
+	db := openMigratedDB(t)
+
+	schema, err := DumpSchema(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := os.ReadFile("schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema != string(expected) {
+		t.Errorf("schema.sql doesn't match the migrations, run make migrate. Migrated schema:\n%s", schema)
+	}
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	db := openMigratedDB(t)
+
+	if err := Migrate(context.Background(), db); err != nil {
+		t.Errorf("Migrate() on a migrated database error = %v", err)
+	}
+}
+
+func TestMigrateRefusesUnknownSchemaVersion(t *testing.T) {
+	db := openMigratedDB(t)
+
+	// Left by a more recent build
+	if _, err := db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (29991231000000, 1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(context.Background(), db); !errors.Is(err, ErrUnknownSchemaVersion) {
+		t.Errorf("Migrate() error = %v, want ErrUnknownSchemaVersion", err)
+	}
+}
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Stops and lines are matched by their natural key when reseeding.
+-- Former seeds could insert the same stop code twice: the references
+-- are moved to the first row before removing the duplicates.
+UPDATE stops_by_lines
+SET stop_id = (SELECT MIN(s2.id) FROM stops s1 JOIN stops s2 ON s2.code = s1.code WHERE s1.id = stops_by_lines.stop_id);
+UPDATE dashboards
+SET stop_id = (SELECT MIN(s2.id) FROM stops s1 JOIN stops s2 ON s2.code = s1.code WHERE s1.id = dashboards.stop_id);
+DELETE FROM stops WHERE id NOT IN (SELECT MIN(id) FROM stops GROUP BY code);
+
+UPDATE stops_by_lines
+SET line_id = (SELECT MIN(l2.id) FROM lines l1 JOIN lines l2 ON l2.code = l1.code AND l2.direction = l1.direction WHERE l1.id = stops_by_lines.line_id);
+DELETE FROM lines WHERE id NOT IN (SELECT MIN(id) FROM lines GROUP BY code, direction);
+
+CREATE UNIQUE INDEX idx_stops_code ON stops(code);
+CREATE UNIQUE INDEX idx_lines_code_direction ON lines(code, direction);
+CREATE INDEX idx_stops_by_lines_line_id ON stops_by_lines(line_id);
+
+-- Set when the stop of a dashboard disappeared from the network and couldn't be remapped.
+ALTER TABLE dashboards ADD COLUMN stop_removed_at DATETIME;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE dashboards DROP COLUMN stop_removed_at;
+DROP INDEX idx_stops_by_lines_line_id;
+DROP INDEX idx_lines_code_direction;
+DROP INDEX idx_stops_code;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A station groups the platforms (stops) sharing a name, like "5710F" and "5710G".
+CREATE TABLE stations (
+  id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+  name TEXT NOT NULL,
+  geo TEXT NOT NULL,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_stations_name ON stations(name);
+
+ALTER TABLE stops ADD COLUMN station_id INTEGER REFERENCES stations(id);
+CREATE INDEX idx_stops_station_id ON stops(station_id);
+
+-- Set when the dashboard shows every platform of the station of its stop.
+ALTER TABLE dashboards ADD COLUMN follow_station BOOLEAN NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE dashboards DROP COLUMN follow_station;
+DROP INDEX idx_stops_station_id;
+ALTER TABLE stops DROP COLUMN station_id;
+DROP INDEX idx_stations_name;
+DROP TABLE stations;
+-- +goose StatementEnd
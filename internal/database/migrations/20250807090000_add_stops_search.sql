@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Full-text index of the French and Dutch stop names, its rowid is the stop id.
+-- FTS5 is only compiled in go-sqlite3 with the sqlite_fts5 build tag.
+-- remove_diacritics makes "elisabeth" match "Élisabeth".
+CREATE VIRTUAL TABLE stops_search USING fts5(
+  name_fr,
+  name_nl,
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO stops_search (rowid, name_fr, name_nl)
+SELECT id, json_extract(name, '$.fr'), json_extract(name, '$.nl') FROM stops;
+
+CREATE TRIGGER stops_search_insert AFTER INSERT ON stops BEGIN
+  INSERT INTO stops_search (rowid, name_fr, name_nl)
+  VALUES (new.id, json_extract(new.name, '$.fr'), json_extract(new.name, '$.nl'));
+END;
+
+CREATE TRIGGER stops_search_update AFTER UPDATE OF name ON stops BEGIN
+  UPDATE stops_search
+  SET name_fr = json_extract(new.name, '$.fr'), name_nl = json_extract(new.name, '$.nl')
+  WHERE rowid = new.id;
+END;
+
+CREATE TRIGGER stops_search_delete AFTER DELETE ON stops BEGIN
+  DELETE FROM stops_search WHERE rowid = old.id;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER stops_search_delete;
+DROP TRIGGER stops_search_update;
+DROP TRIGGER stops_search_insert;
+DROP TABLE stops_search;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Bounding box prefilter of the nearby stops, the expressions must match the query ones.
+CREATE INDEX idx_stops_latitude ON stops(json_extract(geo, '$.latitude'));
+CREATE INDEX idx_stops_longitude ON stops(json_extract(geo, '$.longitude'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_stops_longitude;
+DROP INDEX idx_stops_latitude;
+-- +goose StatementEnd
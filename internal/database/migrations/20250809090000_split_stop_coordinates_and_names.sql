@@ -0,0 +1,109 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The coordinates and the French and Dutch names get their own columns, instead
+-- of JSON strings only the Go code could read.
+DROP TRIGGER stops_search_insert;
+DROP TRIGGER stops_search_update;
+DROP TRIGGER stops_search_delete;
+DROP INDEX idx_stops_latitude;
+DROP INDEX idx_stops_longitude;
+
+ALTER TABLE stops ADD COLUMN lat REAL NOT NULL DEFAULT 0;
+ALTER TABLE stops ADD COLUMN lon REAL NOT NULL DEFAULT 0;
+ALTER TABLE stops ADD COLUMN name_fr TEXT NOT NULL DEFAULT '';
+ALTER TABLE stops ADD COLUMN name_nl TEXT NOT NULL DEFAULT '';
+UPDATE stops SET
+  lat = json_extract(geo, '$.latitude'),
+  lon = json_extract(geo, '$.longitude'),
+  name_fr = json_extract(name, '$.fr'),
+  name_nl = json_extract(name, '$.nl');
+ALTER TABLE stops DROP COLUMN geo;
+ALTER TABLE stops DROP COLUMN name;
+
+ALTER TABLE lines ADD COLUMN destination_fr TEXT NOT NULL DEFAULT '';
+ALTER TABLE lines ADD COLUMN destination_nl TEXT NOT NULL DEFAULT '';
+UPDATE lines SET
+  destination_fr = json_extract(destination, '$.fr'),
+  destination_nl = json_extract(destination, '$.nl');
+ALTER TABLE lines DROP COLUMN destination;
+
+-- Spatial index of the stops, its id is the stop id. A stop is a point: its box
+-- has the same min and max.
+CREATE VIRTUAL TABLE stops_rtree USING rtree(id, min_lat, max_lat, min_lon, max_lon);
+INSERT INTO stops_rtree (id, min_lat, max_lat, min_lon, max_lon)
+SELECT id, lat, lat, lon, lon FROM stops;
+
+CREATE TRIGGER stops_rtree_insert AFTER INSERT ON stops BEGIN
+  INSERT INTO stops_rtree (id, min_lat, max_lat, min_lon, max_lon)
+  VALUES (new.id, new.lat, new.lat, new.lon, new.lon);
+END;
+
+CREATE TRIGGER stops_rtree_update AFTER UPDATE OF lat, lon ON stops BEGIN
+  UPDATE stops_rtree
+  SET min_lat = new.lat, max_lat = new.lat, min_lon = new.lon, max_lon = new.lon
+  WHERE id = new.id;
+END;
+
+CREATE TRIGGER stops_rtree_delete AFTER DELETE ON stops BEGIN
+  DELETE FROM stops_rtree WHERE id = old.id;
+END;
+
+CREATE TRIGGER stops_search_insert AFTER INSERT ON stops BEGIN
+  INSERT INTO stops_search (rowid, name_fr, name_nl)
+  VALUES (new.id, new.name_fr, new.name_nl);
+END;
+
+CREATE TRIGGER stops_search_update AFTER UPDATE OF name_fr, name_nl ON stops BEGIN
+  UPDATE stops_search
+  SET name_fr = new.name_fr, name_nl = new.name_nl
+  WHERE rowid = new.id;
+END;
+
+CREATE TRIGGER stops_search_delete AFTER DELETE ON stops BEGIN
+  DELETE FROM stops_search WHERE rowid = old.id;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER stops_search_delete;
+DROP TRIGGER stops_search_update;
+DROP TRIGGER stops_search_insert;
+DROP TRIGGER stops_rtree_delete;
+DROP TRIGGER stops_rtree_update;
+DROP TRIGGER stops_rtree_insert;
+DROP TABLE stops_rtree;
+
+ALTER TABLE lines ADD COLUMN destination TEXT NOT NULL DEFAULT '';
+UPDATE lines SET destination = json_object('fr', destination_fr, 'nl', destination_nl);
+ALTER TABLE lines DROP COLUMN destination_fr;
+ALTER TABLE lines DROP COLUMN destination_nl;
+
+ALTER TABLE stops ADD COLUMN geo TEXT NOT NULL DEFAULT '';
+ALTER TABLE stops ADD COLUMN name TEXT NOT NULL DEFAULT '';
+UPDATE stops SET
+  geo = json_object('latitude', lat, 'longitude', lon),
+  name = json_object('fr', name_fr, 'nl', name_nl);
+ALTER TABLE stops DROP COLUMN lat;
+ALTER TABLE stops DROP COLUMN lon;
+ALTER TABLE stops DROP COLUMN name_fr;
+ALTER TABLE stops DROP COLUMN name_nl;
+
+CREATE INDEX idx_stops_latitude ON stops(json_extract(geo, '$.latitude'));
+CREATE INDEX idx_stops_longitude ON stops(json_extract(geo, '$.longitude'));
+
+CREATE TRIGGER stops_search_insert AFTER INSERT ON stops BEGIN
+  INSERT INTO stops_search (rowid, name_fr, name_nl)
+  VALUES (new.id, json_extract(new.name, '$.fr'), json_extract(new.name, '$.nl'));
+END;
+
+CREATE TRIGGER stops_search_update AFTER UPDATE OF name ON stops BEGIN
+  UPDATE stops_search
+  SET name_fr = json_extract(new.name, '$.fr'), name_nl = json_extract(new.name, '$.nl')
+  WHERE rowid = new.id;
+END;
+
+CREATE TRIGGER stops_search_delete AFTER DELETE ON stops BEGIN
+  DELETE FROM stops_search WHERE rowid = old.id;
+END;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Stations are no longer unique by name: platforms are grouped by their GTFS
+-- parent station, or by name within walking distance, and two stations far apart
+-- can share a name. The key identifies a station across syncs.
+ALTER TABLE stations ADD COLUMN key TEXT NOT NULL DEFAULT '';
+UPDATE stations SET key = name;
+DROP INDEX idx_stations_name;
+CREATE UNIQUE INDEX idx_stations_key ON stations(key);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_stations_key;
+ALTER TABLE stations DROP COLUMN key;
+CREATE UNIQUE INDEX idx_stations_name ON stations(name);
+-- +goose StatementEnd
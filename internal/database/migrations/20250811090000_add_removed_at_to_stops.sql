@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Set when the stop left the network but is kept for the dashboards still following it.
+ALTER TABLE stops ADD COLUMN removed_at DATETIME;
+UPDATE stops SET removed_at = (
+  SELECT MIN(stop_removed_at) FROM dashboards WHERE dashboards.stop_id = stops.id
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE stops DROP COLUMN removed_at;
+-- +goose StatementEnd
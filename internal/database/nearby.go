@@ -0,0 +1,66 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+
+	"github.com/jp-roisin/catch-and-go/internal/database/store"
+)
+
+const earthRadius = 6371000 // meters
+
+// NearbyStop is a stop and its distance from the searched position, in meters.
+type NearbyStop struct {
+	store.Stop
+	Distance float64
+}
+
+// ListStopsNearby returns the stops within radius meters of a position, closest first.
+//
+// The stops of the bounding box of the circle are read through the spatial index,
+// only those are measured.
+func (s *service) ListStopsNearby(ctx context.Context, latitude, longitude, radius float64, limit int) ([]NearbyStop, error) {
+	dLat := radius / earthRadius * 180 / math.Pi
+	dLon := dLat / math.Cos(latitude*math.Pi/180)
+
+	stops, err := s.queries.ListStopsInBox(ctx, store.ListStopsInBoxParams{
+		MinLatitude:     latitude - dLat,
+		MaxLatitude:     latitude + dLat,
+		MinLongitude:    longitude - dLon,
+		MaxLongitude:    longitude + dLon,
+		UnknownStopCode: UnknownStopCode,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var nearby []NearbyStop
+	for _, stop := range stops {
+		// The corners of the box are further than the radius
+		d := Haversine(latitude, longitude, stop.Lat, stop.Lon)
+		if d <= radius {
+			nearby = append(nearby, NearbyStop{Stop: stop, Distance: d})
+		}
+	}
+
+	slices.SortStableFunc(nearby, func(a, b NearbyStop) int {
+		return cmp.Or(cmp.Compare(a.Distance, b.Distance), cmp.Compare(a.ID, b.ID))
+	})
+	if len(nearby) > limit {
+		nearby = nearby[:limit]
+	}
+	return nearby, nil
+}
+
+// Haversine is the great-circle distance between two positions, in meters.
+func Haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/jp-roisin/catch-and-go/internal/database/store"
+)
+
+func TestListStopsNearby(t *testing.T) {
+	db := openMigratedDB(t)
+	_, err := db.Exec(`
+		INSERT INTO stops (code, lat, lon, name_fr, name_nl) VALUES
+		('0001', 50.8468, 4.3525, 'ARRET INCONNU', 'ONBEKENDE HALTE'),
+		('8032', 50.8432, 4.3808, 'SCHUMAN', 'SCHUMAN'),
+		('8022', 50.8440, 4.3775, 'MAELBEEK', 'MAALBEEK'),
+		('8042', 50.0000, 4.0000, 'MERODE', 'MERODE'),
+		('8011', 50.8503, 4.3526, 'DE BROUCKERE', 'DE BROUCKERE')
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The spatial index follows the moved stops
+	if _, err := db.Exec(`UPDATE stops SET lat = 50.8386, lon = 4.3986 WHERE code = '8042'`); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &service{db: db, queries: store.New(db)}
+
+	// Next to Schuman, Merode is 1.4 km away and De Brouckère 2 km
+	stops, err := s.ListStopsNearby(context.Background(), 50.8430, 4.3800, 1000, 10)
+	if err != nil {
+		t.Fatalf("ListStopsNearby() error = %v", err)
+	}
+	if len(stops) != 2 || stops[0].Code != "8032" || stops[1].Code != "8022" {
+		t.Fatalf("ListStopsNearby() = %+v, want Schuman then Maelbeek", stops)
+	}
+	if math.Abs(stops[0].Distance-61) > 2 {
+		t.Errorf("distance to Schuman = %f, want about 61 meters", stops[0].Distance)
+	}
+
+	stops, err = s.ListStopsNearby(context.Background(), 50.8430, 4.3800, 3000, 3)
+	if err != nil {
+		t.Fatalf("ListStopsNearby() error = %v", err)
+	}
+	var codes []string
+	for _, stop := range stops {
+		codes = append(codes, stop.Code)
+	}
+	// The unknown stop placeholder is never listed
+	if strings.Join(codes, ",") != "8032,8022,8042" {
+		t.Errorf("ListStopsNearby() = %v, want the 3 closest stops", codes)
+	}
+}
+
+func TestListStopsInBoxUsesIndex(t *testing.T) {
+	db := openMigratedDB(t)
+
+	rows, err := db.Query(`EXPLAIN QUERY PLAN
+		SELECT stops.id FROM stops
+		JOIN stops_rtree r ON r.id = stops.id
+		WHERE r.min_lat >= 50.84 AND r.max_lat <= 50.85
+		  AND r.min_lon >= 4.37 AND r.max_lon <= 4.39
+		  AND stops.code <> ?`, UnknownStopCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var plan strings.Builder
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			t.Fatal(err)
+		}
+		plan.WriteString(detail + "\n")
+	}
+	// The r-tree is searched first, then the stops by their primary key
+	if !strings.Contains(plan.String(), "VIRTUAL TABLE INDEX") || !strings.Contains(plan.String(), "INTEGER PRIMARY KEY") {
+		t.Errorf("the bounding box scans the stops:\n%s", plan.String())
+	}
+}
@@ -1,9 +1,10 @@
 -- name: Createdashboard :one
 INSERT INTO dashboards (
     session_id,
-    stop_id
+    stop_id,
+    follow_station
 ) VALUES (
-    ?, ?
+    ?, ?, ?
 )
 RETURNING *;
 
@@ -16,9 +17,13 @@ SELECT
   d.created_at AS dashboard_created_at,
   s.id AS stop_id,
   s.code AS stop_code,
-  s.geo AS stop_geo,
-  s.name AS stop_name,
-  s.created_at AS stop_created_at
+  s.lat AS stop_lat,
+  s.lon AS stop_lon,
+  s.name_fr AS stop_name_fr,
+  s.name_nl AS stop_name_nl,
+  s.created_at AS stop_created_at,
+  s.station_id AS stop_station_id,
+  d.follow_station
 FROM dashboards d
 JOIN stops s ON s.id = d.stop_id
 WHERE d.session_id = ?
@@ -40,10 +45,25 @@ SELECT
   d.created_at AS dashboard_created_at,
   s.id AS stop_id,
   s.code AS stop_code,
-  s.geo AS stop_geo,
-  s.name AS stop_name,
-  s.created_at AS stop_created_at
+  s.lat AS stop_lat,
+  s.lon AS stop_lon,
+  s.name_fr AS stop_name_fr,
+  s.name_nl AS stop_name_nl,
+  s.created_at AS stop_created_at,
+  d.stop_removed_at,
+  s.station_id AS stop_station_id,
+  d.follow_station
 FROM dashboards d
 JOIN stops s ON s.id = d.stop_id
 WHERE d.id = ? AND d.session_id = ?;
 
+
+-- name: ListWatchedStopCodes :many
+SELECT s.code
+FROM dashboards d
+JOIN stops ds ON ds.id = d.stop_id
+JOIN stops s ON s.id = ds.id OR (d.follow_station AND s.station_id = ds.station_id)
+JOIN sessions se ON se.id = d.session_id
+WHERE se.last_seen_at >= ? AND d.stop_removed_at IS NULL
+GROUP BY s.code
+ORDER BY MAX(se.last_seen_at) DESC;
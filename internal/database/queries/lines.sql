@@ -2,6 +2,10 @@
 SELECT * FROM lines
 WHERE code = ? AND direction = ? LIMIT 1;
 
+-- name: GetLineById :one
+SELECT * FROM lines
+WHERE id = ? LIMIT 1;
+
 -- name: ListLines :many
 SELECT * FROM lines
 ORDER BY code ASC;
@@ -27,3 +27,8 @@ WHERE id = ?;
 UPDATE sessions
 set theme = ?
 WHERE id = ?;
+
+-- name: TouchSession :exec
+UPDATE sessions
+set last_seen_at = ?
+WHERE id = ?;
@@ -2,6 +2,32 @@
 SELECT * FROM stops
 WHERE code = ? LIMIT 1;
 
+-- name: GetStopById :one
+SELECT * FROM stops
+WHERE id = ? LIMIT 1;
+
+-- name: ListStopCodesFromStation :many
+SELECT code FROM stops
+WHERE station_id = ?
+ORDER BY code ASC;
+
 -- name: ListStops :many
+-- The stops that left the network are only kept for their dashboards.
 SELECT * FROM stops
+WHERE removed_at IS NULL
 ORDER BY code ASC;
+
+-- name: SearchStops :many
+-- The unknown stop is the placeholder the seeds map unknown stops to.
+SELECT stops.* FROM stops
+JOIN stops_search ON stops_search.rowid = stops.id
+WHERE stops_search MATCH sqlc.arg(query) AND stops.code <> sqlc.arg(unknown_stop_code) AND stops.removed_at IS NULL
+ORDER BY stops.code ASC
+LIMIT sqlc.arg(limit);
+
+-- name: ListStopsInBox :many
+SELECT stops.* FROM stops
+JOIN stops_rtree r ON r.id = stops.id
+WHERE r.min_lat >= sqlc.arg(min_latitude) AND r.max_lat <= sqlc.arg(max_latitude)
+  AND r.min_lon >= sqlc.arg(min_longitude) AND r.max_lon <= sqlc.arg(max_longitude)
+  AND stops.code <> sqlc.arg(unknown_stop_code) AND stops.removed_at IS NULL;
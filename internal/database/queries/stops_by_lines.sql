@@ -4,3 +4,10 @@ FROM stops_by_lines sbl
 JOIN stops s ON s.id = sbl.stop_id
 WHERE sbl.line_id = ?
 ORDER BY sbl."order" ASC;
+
+-- name: ListLineCodesFromStop :many
+SELECT DISTINCT l.code
+FROM stops_by_lines sbl
+JOIN lines l ON l.id = sbl.line_id
+WHERE sbl.stop_id = ?
+ORDER BY l.code ASC;
@@ -8,21 +8,18 @@ CREATE TABLE sqlite_sequence(name,seq);
 CREATE TABLE sessions (
   id TEXT PRIMARY KEY NOT NULL,
   created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-, locale TEXT NOT NULL DEFAULT 'fr', theme TEXT NOT NULL DEFAULT 'dark');
+, locale TEXT NOT NULL DEFAULT 'fr', theme TEXT NOT NULL DEFAULT 'dark', last_seen_at DATETIME);
 CREATE TABLE stops (
   id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
   code TEXT NOT NULL,
-  geo TEXT NOT NULL,
-  name TEXT NOT NULL,
   created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-);
+, station_id INTEGER REFERENCES stations(id), lat REAL NOT NULL DEFAULT 0, lon REAL NOT NULL DEFAULT 0, name_fr TEXT NOT NULL DEFAULT '', name_nl TEXT NOT NULL DEFAULT '', removed_at DATETIME);
 CREATE TABLE lines (
   id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
   code TEXT NOT NULL,
-  destination TEXT NOT NULL,
   direction INT NOT NULL,
   created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-, mode TEXT, color TEXT, text_color TEXT NOT NULL DEFAULT '#ffffff');
+, mode TEXT, color TEXT, text_color TEXT NOT NULL DEFAULT '#ffffff', destination_fr TEXT NOT NULL DEFAULT '', destination_nl TEXT NOT NULL DEFAULT '');
 CREATE TABLE stops_by_lines (
   id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
   stop_id INTEGER NOT NULL,
@@ -36,7 +33,56 @@ CREATE TABLE dashboards (
   id integer primary key autoincrement not null,
   session_id text not null,
   stop_id integer not null,
-  created_at datetime default current_timestamp,
+  created_at datetime default current_timestamp, stop_removed_at DATETIME, follow_station BOOLEAN NOT NULL DEFAULT 0,
   constraint fk_session foreign key (session_id) references sessions(id),
   constraint fk_stop foreign key (stop_id) references stops(id)
 );
+CREATE UNIQUE INDEX idx_stops_code ON stops(code);
+CREATE UNIQUE INDEX idx_lines_code_direction ON lines(code, direction);
+CREATE INDEX idx_stops_by_lines_line_id ON stops_by_lines(line_id);
+CREATE TABLE stations (
+  id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+  name TEXT NOT NULL,
+  geo TEXT NOT NULL,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+, key TEXT NOT NULL DEFAULT '');
+CREATE INDEX idx_stops_station_id ON stops(station_id);
+CREATE VIRTUAL TABLE stops_search USING fts5(
+  name_fr,
+  name_nl,
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+CREATE TABLE 'stops_search_data'(id INTEGER PRIMARY KEY, block BLOB);
+CREATE TABLE 'stops_search_idx'(segid, term, pgno, PRIMARY KEY(segid, term)) WITHOUT ROWID;
+CREATE TABLE 'stops_search_content'(id INTEGER PRIMARY KEY, c0, c1);
+CREATE TABLE 'stops_search_docsize'(id INTEGER PRIMARY KEY, sz BLOB);
+CREATE TABLE 'stops_search_config'(k PRIMARY KEY, v) WITHOUT ROWID;
+CREATE VIRTUAL TABLE stops_rtree USING rtree(id, min_lat, max_lat, min_lon, max_lon);
+CREATE TABLE "stops_rtree_rowid"(rowid INTEGER PRIMARY KEY,nodeno);
+CREATE TABLE "stops_rtree_node"(nodeno INTEGER PRIMARY KEY,data);
+CREATE TABLE "stops_rtree_parent"(nodeno INTEGER PRIMARY KEY,parentnode);
+CREATE TRIGGER stops_rtree_insert AFTER INSERT ON stops BEGIN
+  INSERT INTO stops_rtree (id, min_lat, max_lat, min_lon, max_lon)
+  VALUES (new.id, new.lat, new.lat, new.lon, new.lon);
+END;
+CREATE TRIGGER stops_rtree_update AFTER UPDATE OF lat, lon ON stops BEGIN
+  UPDATE stops_rtree
+  SET min_lat = new.lat, max_lat = new.lat, min_lon = new.lon, max_lon = new.lon
+  WHERE id = new.id;
+END;
+CREATE TRIGGER stops_rtree_delete AFTER DELETE ON stops BEGIN
+  DELETE FROM stops_rtree WHERE id = old.id;
+END;
+CREATE TRIGGER stops_search_insert AFTER INSERT ON stops BEGIN
+  INSERT INTO stops_search (rowid, name_fr, name_nl)
+  VALUES (new.id, new.name_fr, new.name_nl);
+END;
+CREATE TRIGGER stops_search_update AFTER UPDATE OF name_fr, name_nl ON stops BEGIN
+  UPDATE stops_search
+  SET name_fr = new.name_fr, name_nl = new.name_nl
+  WHERE rowid = new.id;
+END;
+CREATE TRIGGER stops_search_delete AFTER DELETE ON stops BEGIN
+  DELETE FROM stops_search WHERE rowid = old.id;
+END;
+CREATE UNIQUE INDEX idx_stations_key ON stations(key);
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/jp-roisin/catch-and-go/internal/database/store"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// UnknownStopCode is the placeholder stop the seeds map unknown stops to, it is
+// never a search or nearby result.
+const UnknownStopCode = "0001"
+
+// SearchStops finds the stops whose French or Dutch name contains every word of
+// the query, ignoring case and accents. The words are prefixes, so that a name is
+// found while it is being typed ("gare mid" finds "GARE DU MIDI").
+//
+// When the full-text index has no match, the query is assumed misspelled and the
+// names are compared word by word, tolerating a typo or two depending on the length
+// of the words ("montgomry" finds "MONTGOMERY").
+func (s *service) SearchStops(ctx context.Context, query string, limit int) ([]store.Stop, error) {
+	words := searchWords(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	stops, err := s.queries.SearchStops(ctx, store.SearchStopsParams{
+		Query:           ftsQuery(words),
+		UnknownStopCode: UnknownStopCode,
+		Limit:           int64(limit),
+	})
+	if err != nil || len(stops) > 0 {
+		return stops, err
+	}
+
+	all, err := s.queries.ListStops(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return fuzzySearch(all, words, limit), nil
+}
+
+// searchWords splits a text into lowercase words without accents, like the
+// unicode61 tokenizer of the index does.
+func searchWords(text string) []string {
+	stripped, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), text)
+	if err != nil {
+		stripped = text
+	}
+	return strings.FieldsFunc(strings.ToLower(stripped), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ftsQuery turns words into a MATCH expression requiring all of them as prefixes.
+// The words only hold letters and digits, so they can't be read as FTS operators.
+func ftsQuery(words []string) string {
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = w + "*"
+	}
+	return strings.Join(terms, " ")
+}
+
+// fuzzySearch ranks the stops by the number of typos needed to match every word
+// of the query, and leaves out those needing more than the words allow.
+func fuzzySearch(stops []store.Stop, words []string, limit int) []store.Stop {
+	type candidate struct {
+		stop  store.Stop
+		typos int
+	}
+
+	var candidates []candidate
+	for _, stop := range stops {
+		if stop.Code == UnknownStopCode {
+			continue
+		}
+
+		best := -1
+		for _, n := range []string{stop.NameFr, stop.NameNl} {
+			if typos, ok := matchTypos(words, searchWords(n)); ok && (best < 0 || typos < best) {
+				best = typos
+			}
+		}
+		if best >= 0 {
+			candidates = append(candidates, candidate{stop, best})
+		}
+	}
+
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		if a.typos != b.typos {
+			return a.typos - b.typos
+		}
+		return strings.Compare(a.stop.Code, b.stop.Code)
+	})
+
+	var result []store.Stop
+	for _, c := range candidates {
+		if len(result) == limit {
+			break
+		}
+		result = append(result, c.stop)
+	}
+	return result
+}
+
+// matchTypos returns the number of typos for every query word to match a word of
+// the name, either whole or as a prefix.
+func matchTypos(query, name []string) (int, bool) {
+	total := 0
+	for _, q := range query {
+		q := []rune(q)
+		best := -1
+		for _, n := range name {
+			n := []rune(n)
+			d := levenshtein(q, n)
+			if len(n) > len(q) {
+				d = min(d, levenshtein(q, n[:len(q)]))
+			}
+			if best < 0 || d < best {
+				best = d
+			}
+		}
+		if best < 0 || best > allowedTypos(len(q)) {
+			return 0, false
+		}
+		total += best
+	}
+	return total, true
+}
+
+// allowedTypos is the number of typos tolerated in a word: short words would
+// match too many names otherwise.
+func allowedTypos(length int) int {
+	switch {
+	case length < 4:
+		return 0
+	case length < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// levenshtein is the number of insertions, deletions and substitutions to turn a into b.
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
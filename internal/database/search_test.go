@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/jp-roisin/catch-and-go/internal/database/store"
+)
+
+func TestSearchStops(t *testing.T) {
+	db := openMigratedDB(t)
+	_, err := db.Exec(`
+		INSERT INTO stops (code, name_fr, name_nl) VALUES
+		('0001', 'ARRET INCONNU', 'ONBEKENDE HALTE'),
+		('8042', 'MERODE', 'MERODE'),
+		('8282', 'GARE DE L''OUEST', 'WESTSTATION'),
+		('8291', 'ÉLISABETH', 'ELISABETH'),
+		('8272', 'MONTGOMERY', 'MONTGOMERY')
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The index follows the renamed stops
+	if _, err := db.Exec(`UPDATE stops SET name_fr = 'MÉRODE' WHERE code = '8042'`); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &service{db: db, queries: store.New(db)}
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"elisabeth", []string{"8291"}},
+		{"Élisab", []string{"8291"}},
+		{"weststat", []string{"8282"}},
+		{"gare ouest", []string{"8282"}},
+		{"l'ouest", []string{"8282"}},
+		{"mérode", []string{"8042"}},
+		{"montgomry", []string{"8272"}},
+		{"elisabteh", []string{"8291"}},
+		{"inconnu", nil},
+		{"mer", []string{"8042"}},
+		{"xyz", nil},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		stops, err := s.SearchStops(context.Background(), tt.query, 10)
+		if err != nil {
+			t.Fatalf("SearchStops(%q) error = %v", tt.query, err)
+		}
+		var codes []string
+		for _, stop := range stops {
+			codes = append(codes, stop.Code)
+		}
+		if !slices.Equal(codes, tt.expected) {
+			t.Errorf("SearchStops(%q) = %v, want %v", tt.query, codes, tt.expected)
+		}
+	}
+}
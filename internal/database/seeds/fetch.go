@@ -0,0 +1,177 @@
+package seeds
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DataDir is where the STIB exports are read from, relative to the repository root.
+const DataDir = "internal/database/seeds/data"
+
+const manifestFileName = "manifest.json"
+
+// Exporter downloads whole datasets as semicolon-separated CSV files,
+// see externalapi.STIBClient.ExportDataset.
+type Exporter interface {
+	ExportDataset(ctx context.Context, dataset string, columns []string) ([]byte, error)
+}
+
+// stibDataset is an open data dataset of the STIB and the columns the readers
+// expect, in their order. The text colors of the lines aren't published, that
+// file is maintained by hand.
+type stibDataset struct {
+	name    string
+	columns []string
+	path    string
+}
+
+var stibDatasets = []stibDataset{
+	{"stop-details-production", []string{"gpscoordinates", "id", "name"}, stopDetailsFilePath},
+	{"stops-by-line-production", []string{"destination", "direction", "lineid", "points"}, stopsByLineFilePath},
+	{"shapefiles-production", []string{"ligne", "color"}, shapeFilesPath},
+}
+
+// Manifest records where the files of DataDir come from, to tell whether a
+// fetch brought new data and how old the seeded data is.
+type Manifest struct {
+	Datasets map[string]ManifestEntry `json:"datasets"`
+}
+
+type ManifestEntry struct {
+	File      string    `json:"file"`
+	SHA256    string    `json:"sha256"`
+	Size      int       `json:"size"`
+	FetchedAt time.Time `json:"fetched_at"`
+	// ChangedAt is the fetch that last brought a different content.
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// FetchResult tells which datasets changed since the previous fetch.
+type FetchResult struct {
+	Manifest Manifest
+	Changed  []string
+}
+
+func (r FetchResult) String() string {
+	var sb strings.Builder
+	for _, d := range stibDatasets {
+		e := r.Manifest.Datasets[d.name]
+		fmt.Fprintf(&sb, "%s: %d bytes, sha256 %s\n", e.File, e.Size, e.SHA256)
+	}
+	if len(r.Changed) == 0 {
+		sb.WriteString("no dataset changed since the last fetch")
+	} else {
+		fmt.Fprintf(&sb, "changed: %s", strings.Join(r.Changed, ", "))
+	}
+	return sb.String()
+}
+
+// FetchSTIBDatasets downloads the STIB datasets the seeds are read from into dir,
+// and updates the manifest of the directory with their checksums.
+//
+// Every dataset is downloaded before anything is written, so that a failed fetch
+// doesn't leave files from different dates behind.
+func FetchSTIBDatasets(ctx context.Context, e Exporter, dir string, now time.Time) (FetchResult, error) {
+	var result FetchResult
+
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return result, err
+	}
+
+	contents := make(map[string][]byte, len(stibDatasets))
+	for _, d := range stibDatasets {
+		body, err := e.ExportDataset(ctx, d.name, d.columns)
+		if err != nil {
+			return result, fmt.Errorf("failed to export %s: %w", d.name, err)
+		}
+		contents[d.name] = body
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return result, err
+	}
+
+	for _, d := range stibDatasets {
+		body := contents[d.name]
+		sum := sha256.Sum256(body)
+		entry := ManifestEntry{
+			File:      filepath.Base(d.path),
+			SHA256:    hex.EncodeToString(sum[:]),
+			Size:      len(body),
+			FetchedAt: now,
+			ChangedAt: now,
+		}
+
+		previous, ok := manifest.Datasets[d.name]
+		if ok && previous.SHA256 == entry.SHA256 {
+			entry.ChangedAt = previous.ChangedAt
+		} else {
+			result.Changed = append(result.Changed, d.name)
+		}
+		manifest.Datasets[d.name] = entry
+
+		if err := writeFileAtomic(filepath.Join(dir, entry.File), body); err != nil {
+			return result, err
+		}
+	}
+
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return result, err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, manifestFileName), append(encoded, '\n')); err != nil {
+		return result, err
+	}
+
+	result.Manifest = manifest
+	return result, nil
+}
+
+// ReadManifest reads the manifest of dir, which is empty when nothing was fetched yet.
+func ReadManifest(dir string) (Manifest, error) {
+	m := Manifest{Datasets: make(map[string]ManifestEntry)}
+
+	content, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+
+	if err := json.Unmarshal(content, &m); err != nil {
+		return m, fmt.Errorf("invalid %s: %w", manifestFileName, err)
+	}
+	if m.Datasets == nil {
+		m.Datasets = make(map[string]ManifestEntry)
+	}
+	return m, nil
+}
+
+// writeFileAtomic replaces a file with a rename, so readers never see it half written.
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,102 @@
+package seeds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jp-roisin/catch-and-go/internal/externalapi"
+)
+
+func TestFetchSTIBDatasets(t *testing.T) {
+	exports := map[string]string{
+		"stop-details-production":  "gpscoordinates;id;name\n",
+		"stops-by-line-production": "destination;direction;lineid;points\n",
+		"shapefiles-production":    "ligne;color\n001m;#C4008F\n",
+	}
+	var selects []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Apikey secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		dataset, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/exports/csv")
+		if !ok || r.URL.Query().Get("delimiter") != ";" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		selects = append(selects, r.URL.Query().Get("select"))
+		w.Write([]byte(exports[dataset]))
+	}))
+	defer server.Close()
+
+	client := externalapi.NewSTIBClient(server.URL, "secret", externalapi.ClientOptions{MaxRetries: externalapi.NoRetries})
+	dir := t.TempDir()
+	first := time.Date(2025, 8, 1, 8, 0, 0, 0, time.UTC)
+
+	result, err := FetchSTIBDatasets(context.Background(), client, dir, first)
+	if err != nil {
+		t.Fatalf("FetchSTIBDatasets() error = %v", err)
+	}
+	if len(result.Changed) != 3 {
+		t.Errorf("first fetch changed %v, want every dataset", result.Changed)
+	}
+	expectedSelects := []string{"gpscoordinates,id,name", "destination,direction,lineid,points", "ligne,color"}
+	if !reflect.DeepEqual(selects, expectedSelects) {
+		t.Errorf("selected columns = %v, want %v", selects, expectedSelects)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "shapefiles-production.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != exports["shapefiles-production"] {
+		t.Errorf("shapefiles-production.csv = %q, want the export", content)
+	}
+
+	// Only the shapefiles change on the next fetch
+	exports["shapefiles-production"] += "002m;#F57000\n"
+	second := first.Add(24 * time.Hour)
+	result, err = FetchSTIBDatasets(context.Background(), client, dir, second)
+	if err != nil {
+		t.Fatalf("FetchSTIBDatasets() error = %v", err)
+	}
+	if !reflect.DeepEqual(result.Changed, []string{"shapefiles-production"}) {
+		t.Errorf("second fetch changed %v, want the shapefiles only", result.Changed)
+	}
+
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stops := manifest.Datasets["stop-details-production"]
+	if !stops.FetchedAt.Equal(second) || !stops.ChangedAt.Equal(first) {
+		t.Errorf("stop details fetched at %v and changed at %v, want %v and %v", stops.FetchedAt, stops.ChangedAt, second, first)
+	}
+	if shapes := manifest.Datasets["shapefiles-production"]; !shapes.ChangedAt.Equal(second) || shapes.Size != len(exports["shapefiles-production"]) {
+		t.Errorf("shapefiles manifest entry = %+v, want the second export", shapes)
+	}
+}
+
+func TestFetchSTIBDatasetsKeepsFilesOnFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := externalapi.NewSTIBClient(server.URL, "wrong", externalapi.ClientOptions{MaxRetries: externalapi.NoRetries})
+	dir := t.TempDir()
+
+	if _, err := FetchSTIBDatasets(context.Background(), client, dir, time.Now()); err == nil {
+		t.Fatalf("FetchSTIBDatasets() expected an error")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("a failed fetch wrote %d files", len(entries))
+	}
+}
@@ -0,0 +1,358 @@
+package seeds
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jp-roisin/catch-and-go/internal/database/store"
+)
+
+// GTFS route types we have a mode for, see https://gtfs.org/schedule/reference/#routestxt
+var gtfsRouteTypes = map[string]string{
+	"0": "tram",
+	"1": "metro",
+	"3": "bus",
+}
+
+// gtfsTable is a GTFS file, with its columns looked up by name since
+// their order isn't fixed by the specification.
+type gtfsTable struct {
+	name    string
+	columns map[string]int
+	rows    [][]string
+}
+
+// get returns the value of a column, or "" when the file doesn't have it.
+func (t gtfsTable) get(row []string, column string) string {
+	i, ok := t.columns[column]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// require reports the columns missing from the file, and returns whether it has them all.
+func (t gtfsTable) require(r *Report, columns ...string) bool {
+	ok := true
+	for _, c := range columns {
+		if _, found := t.columns[c]; !found {
+			r.errorf(t.name, 1, c, "missing required column")
+			ok = false
+		}
+	}
+	return ok
+}
+
+func readGTFSTable(archive *zip.ReadCloser, name string) (gtfsTable, error) {
+	t := gtfsTable{name: name, columns: make(map[string]int)}
+
+	f, err := archive.Open(name)
+	if err != nil {
+		return t, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		return t, err
+	}
+	for i, c := range header {
+		t.columns[strings.TrimPrefix(strings.TrimSpace(c), "\ufeff")] = i
+	}
+
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return t, err
+		}
+		t.rows = append(t.rows, row)
+	}
+
+	return t, nil
+}
+
+// ReadGTFS reads a GTFS static zip into a Network.
+//
+// Each direction of a route becomes a line, whose stops are the ones of its
+// longest trip: the other trips usually are short turns of the same pattern.
+// Stations (location_type 1) are left out, only the stops vehicles call at are kept;
+// the parent_station of a stop groups it with the other platforms of its station.
+//
+// GTFS names are in a single language. The French and Dutch ones are taken from
+// translations.txt when the feed has it, the original name is used otherwise.
+//
+// It fails when any row is invalid, with every problem found.
+func ReadGTFS(path string) (Network, error) {
+	var r Report
+	n := readGTFS(path, &r)
+	return n, r.Err()
+}
+
+// ValidateGTFS reads a GTFS static zip like ReadGTFS, and reports what is wrong with it.
+func ValidateGTFS(path string) Report {
+	var r Report
+	n := readGTFS(path, &r)
+	r.summarize(n, "stop_times.txt")
+	return r
+}
+
+func readGTFS(path string, r *Report) Network {
+	var n Network
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		r.errorf(path, 0, "", "failed to open the GTFS archive: %v", err)
+		return n
+	}
+	defer archive.Close()
+
+	tables := make(map[string]gtfsTable)
+	for _, name := range []string{"stops.txt", "routes.txt", "trips.txt", "stop_times.txt"} {
+		t, err := readGTFSTable(archive, name)
+		if err != nil {
+			r.errorf(name, 0, "", "%v", err)
+		}
+		tables[name] = t
+	}
+
+	translations := readGTFSTranslations(archive, r)
+	if len(r.Errors) > 0 {
+		return n
+	}
+
+	stops, routes, trips, stopTimes := tables["stops.txt"], tables["routes.txt"], tables["trips.txt"], tables["stop_times.txt"]
+	ok := stops.require(r, "stop_id", "stop_name", "stop_lat", "stop_lon")
+	ok = routes.require(r, "route_id", "route_type") && ok
+	ok = trips.require(r, "route_id", "trip_id") && ok
+	ok = stopTimes.require(r, "trip_id", "stop_id", "stop_sequence") && ok
+	if !ok {
+		return n
+	}
+
+	stopNames := make(map[string]i18nCell)
+	seenStops := make(map[string]bool)
+	for i, row := range stops.rows {
+		if stops.get(row, "location_type") == "1" {
+			continue
+		}
+
+		code := stops.get(row, "stop_id")
+		lat, errLat := strconv.ParseFloat(stops.get(row, "stop_lat"), 64)
+		if errLat != nil {
+			r.errorf(stops.name, i+2, "stop_lat", "invalid coordinate %q", stops.get(row, "stop_lat"))
+		}
+		lon, errLon := strconv.ParseFloat(stops.get(row, "stop_lon"), 64)
+		if errLon != nil {
+			r.errorf(stops.name, i+2, "stop_lon", "invalid coordinate %q", stops.get(row, "stop_lon"))
+		}
+		if errLat != nil || errLon != nil {
+			continue
+		}
+
+		name := translations.translate(stops.get(row, "stop_name"))
+		stopNames[code] = name
+		if seenStops[code] {
+			continue
+		}
+		seenStops[code] = true
+
+		n.Stops = append(n.Stops, NetworkStop{
+			Code:     code,
+			Name:     name,
+			Location: Location{Latitude: lat, Longitude: lon},
+			Station:  stops.get(row, "parent_station"),
+		})
+	}
+
+	// Ordered stops of every trip
+	type stopTime struct {
+		sequence int
+		stopID   string
+	}
+	tripStops := make(map[string][]stopTime)
+	for i, row := range stopTimes.rows {
+		sequence, err := strconv.Atoi(stopTimes.get(row, "stop_sequence"))
+		if err != nil {
+			r.errorf(stopTimes.name, i+2, "stop_sequence", "invalid stop sequence %q", stopTimes.get(row, "stop_sequence"))
+			continue
+		}
+		tripID := stopTimes.get(row, "trip_id")
+		tripStops[tripID] = append(tripStops[tripID], stopTime{sequence, stopTimes.get(row, "stop_id")})
+	}
+
+	// Several routes can share a short name, like the variants or the school runs
+	// of a line: they make a single line, the first route gives its mode and colors.
+	routeCodes := make(map[string]string)
+	var codes []string
+	lineRoutes := make(map[string][]string)
+	for i, row := range routes.rows {
+		routeID := routes.get(row, "route_id")
+		code := routes.get(row, "route_short_name")
+		if code == "" {
+			code = routeID
+		}
+		code = store.NormalizeLineCode(code)
+
+		if !validString.MatchString(code) {
+			r.errorf(routes.name, i+2, "route_short_name", "invalid line code %q (must be alphanumeric)", code)
+			continue
+		}
+
+		routeCodes[routeID] = code
+		if _, ok := lineRoutes[code]; !ok {
+			codes = append(codes, code)
+			lineRoutes[code] = row
+		}
+	}
+
+	// Longest trip of every line direction, whichever of its routes it belongs to
+	type lineDirection struct {
+		code      string
+		direction int
+	}
+	longest := make(map[lineDirection]string)
+	headsigns := make(map[string]string)
+	for i, row := range trips.rows {
+		direction := 0
+		if d := trips.get(row, "direction_id"); d != "" {
+			if direction, err = strconv.Atoi(d); err != nil || (direction != 0 && direction != 1) {
+				r.errorf(trips.name, i+2, "direction_id", "invalid direction %q (must be 0 or 1)", d)
+				continue
+			}
+		}
+
+		tripID := trips.get(row, "trip_id")
+		headsigns[tripID] = trips.get(row, "trip_headsign")
+
+		code, ok := routeCodes[trips.get(row, "route_id")]
+		if !ok {
+			continue
+		}
+		key := lineDirection{code, direction}
+		if current, ok := longest[key]; !ok || len(tripStops[tripID]) > len(tripStops[current]) {
+			longest[key] = tripID
+		}
+	}
+
+	for _, code := range codes {
+		row := lineRoutes[code]
+
+		for direction := 0; direction <= 1; direction++ {
+			tripID, ok := longest[lineDirection{code, direction}]
+			if !ok || len(tripStops[tripID]) == 0 {
+				continue
+			}
+
+			sts := tripStops[tripID]
+			sort.Slice(sts, func(i, j int) bool { return sts[i].sequence < sts[j].sequence })
+
+			line := NetworkLine{
+				Code:      code,
+				Direction: direction,
+				Mode:      gtfsRouteTypes[routes.get(row, "route_type")],
+				Color:     gtfsColor(routes.get(row, "route_color")),
+				TextColor: gtfsColor(routes.get(row, "route_text_color")),
+			}
+			if line.Color != "" && line.TextColor == "" {
+				line.TextColor = "#000000" // the GTFS default
+			}
+
+			for _, st := range sts {
+				line.StopCodes = append(line.StopCodes, st.stopID)
+			}
+
+			if headsign := headsigns[tripID]; headsign != "" {
+				line.Destination = translations.translate(headsign)
+			} else {
+				line.Destination = stopNames[sts[len(sts)-1].stopID]
+			}
+
+			n.Lines = append(n.Lines, line)
+		}
+	}
+
+	return n
+}
+
+// gtfsColor turns a GTFS color ("FF0000") into a CSS one ("#FF0000").
+func gtfsColor(c string) string {
+	if c == "" {
+		return ""
+	}
+	color := "#" + c
+	if !validHexColor.MatchString(color) {
+		return ""
+	}
+	return color
+}
+
+// gtfsTranslations maps original texts to their French and Dutch versions.
+type gtfsTranslations map[string]i18nCell
+
+func (t gtfsTranslations) translate(text string) i18nCell {
+	tr := t[text]
+	if tr.Fr == "" {
+		tr.Fr = text
+	}
+	if tr.Nl == "" {
+		tr.Nl = text
+	}
+	return tr
+}
+
+// readGTFSTranslations supports both the current translations.txt layout (field_value)
+// and the legacy one (trans_id), still published by some operators like the STIB.
+// Translations identified by record only (record_id) are not supported.
+func readGTFSTranslations(archive *zip.ReadCloser, r *Report) gtfsTranslations {
+	translations := make(gtfsTranslations)
+
+	t, err := readGTFSTable(archive, "translations.txt")
+	if errors.Is(err, fs.ErrNotExist) {
+		return translations
+	}
+	if err != nil {
+		r.errorf(t.name, 0, "", "%v", err)
+		return translations
+	}
+
+	key := "field_value"
+	if _, ok := t.columns["trans_id"]; ok {
+		key = "trans_id"
+	}
+	language := "language"
+	if _, ok := t.columns["lang"]; ok {
+		language = "lang"
+	}
+	if !t.require(r, key, language, "translation") {
+		return translations
+	}
+
+	for _, row := range t.rows {
+		original := t.get(row, key)
+		if original == "" {
+			continue
+		}
+		tr := translations[original]
+		switch strings.ToLower(t.get(row, language)) {
+		case "fr":
+			tr.Fr = t.get(row, "translation")
+		case "nl":
+			tr.Nl = t.get(row, "translation")
+		}
+		translations[original] = tr
+	}
+
+	return translations
+}
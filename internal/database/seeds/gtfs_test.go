@@ -0,0 +1,170 @@
+package seeds
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeGTFS(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "gtfs.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestReadGTFS(t *testing.T) {
+	path := writeGTFS(t, map[string]string{
+		"stops.txt": "\ufeffstop_id,stop_name,stop_lat,stop_lon,location_type,parent_station\n" +
+			"8042,MERODE,50.8386,4.3986,0,S1\n" +
+			"8032,SCHUMAN,50.8432,4.3808,0,\n" +
+			"8022,MAELBEEK,50.8440,4.3775,,\n" +
+			"5710F,MAELBEEK,50.8441,4.3776,0,\n" +
+			"S1,MERODE,50.8386,4.3986,1,\n",
+		"routes.txt": "route_id,route_short_name,route_type,route_color,route_text_color\n" +
+			"r1,1,1,C4008F,FFFFFF\n" +
+			"r92,92,0,,\n" +
+			"n12,N12,3,000000,FFFFFF\n",
+		"trips.txt": "route_id,service_id,trip_id,trip_headsign,direction_id\n" +
+			"r1,wk,t1,STOCKEL,0\n" +
+			"r1,wk,t2,STOCKEL,0\n" +
+			"r1,wk,t3,,1\n" +
+			"r92,wk,t4,FORT-JACO,0\n" +
+			"n12,wk,t5,,0\n",
+		"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+			"t1,08:00:00,08:00:00,8022,1\n" +
+			"t1,08:02:00,08:02:00,8042,3\n" +
+			"t1,08:01:00,08:01:00,8032,2\n" +
+			"t2,08:10:00,08:10:00,8032,1\n" +
+			"t3,09:00:00,09:00:00,8042,1\n" +
+			"t3,09:02:00,09:02:00,5710F,2\n" +
+			"t4,09:00:00,09:00:00,9999,1\n" +
+			"t5,01:00:00,01:00:00,8032,1\n",
+		"translations.txt": "trans_id,translation,lang\n" +
+			"MERODE,MERODE,FR\n" +
+			"MERODE,MERODE,NL\n" +
+			"STOCKEL,STOCKEL,FR\n" +
+			"STOCKEL,STOKKEL,NL\n",
+	})
+
+	n, err := ReadGTFS(path)
+	if err != nil {
+		t.Fatalf("ReadGTFS() error = %v", err)
+	}
+
+	expectedStops := []NetworkStop{
+		{Code: "8042", Name: i18nCell{Fr: "MERODE", Nl: "MERODE"}, Location: Location{Latitude: 50.8386, Longitude: 4.3986}, Station: "S1"},
+		{Code: "8032", Name: i18nCell{Fr: "SCHUMAN", Nl: "SCHUMAN"}, Location: Location{Latitude: 50.8432, Longitude: 4.3808}},
+		{Code: "8022", Name: i18nCell{Fr: "MAELBEEK", Nl: "MAELBEEK"}, Location: Location{Latitude: 50.8440, Longitude: 4.3775}},
+		{Code: "5710F", Name: i18nCell{Fr: "MAELBEEK", Nl: "MAELBEEK"}, Location: Location{Latitude: 50.8441, Longitude: 4.3776}},
+	}
+	if !reflect.DeepEqual(n.Stops, expectedStops) {
+		t.Errorf("ReadGTFS() stops = %+v, want %+v", n.Stops, expectedStops)
+	}
+
+	expectedLines := []NetworkLine{
+		{
+			Code: "1", Direction: 0, Destination: i18nCell{Fr: "STOCKEL", Nl: "STOKKEL"},
+			Mode: "metro", Color: "#C4008F", TextColor: "#FFFFFF",
+			StopCodes: []string{"8022", "8032", "8042"},
+		},
+		{
+			Code: "1", Direction: 1, Destination: i18nCell{Fr: "MAELBEEK", Nl: "MAELBEEK"},
+			Mode: "metro", Color: "#C4008F", TextColor: "#FFFFFF",
+			StopCodes: []string{"8042", "5710F"},
+		},
+		{
+			Code: "92", Direction: 0, Destination: i18nCell{Fr: "FORT-JACO", Nl: "FORT-JACO"},
+			Mode:      "tram",
+			StopCodes: []string{"9999"},
+		},
+		{
+			Code: "N12", Direction: 0, Destination: i18nCell{Fr: "SCHUMAN", Nl: "SCHUMAN"},
+			Mode: "bus", Color: "#000000", TextColor: "#FFFFFF",
+			StopCodes: []string{"8032"},
+		},
+	}
+	if !reflect.DeepEqual(n.Lines, expectedLines) {
+		t.Errorf("ReadGTFS() lines = %+v, want %+v", n.Lines, expectedLines)
+	}
+}
+
+func TestReadGTFSRoutesSharingAShortName(t *testing.T) {
+	path := writeGTFS(t, map[string]string{
+		"stops.txt": "stop_id,stop_name,stop_lat,stop_lon\n" +
+			"8042,MERODE,50.8386,4.3986\n" +
+			"8032,SCHUMAN,50.8432,4.3808\n" +
+			"8022,MAELBEEK,50.8440,4.3775\n",
+		"routes.txt": "route_id,route_short_name,route_type,route_color,route_text_color\n" +
+			"r5,5,1,E6B012,\n" +
+			"r5s,5,3,,\n",
+		"trips.txt": "route_id,service_id,trip_id,trip_headsign,direction_id\n" +
+			"r5,wk,t1,,0\n" +
+			"r5s,wk,t2,,0\n" +
+			"r5s,wk,t3,,1\n",
+		"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+			"t1,08:00:00,08:00:00,8022,1\n" +
+			"t2,08:10:00,08:10:00,8022,1\n" +
+			"t2,08:11:00,08:11:00,8032,2\n" +
+			"t2,08:12:00,08:12:00,8042,3\n" +
+			"t3,09:00:00,09:00:00,8042,1\n",
+	})
+
+	n, err := ReadGTFS(path)
+	if err != nil {
+		t.Fatalf("ReadGTFS() error = %v", err)
+	}
+
+	// The routes are one line, with the longest trip of either of them and the
+	// mode and colors of the first one
+	expectedLines := []NetworkLine{
+		{
+			Code: "5", Direction: 0, Destination: i18nCell{Fr: "MERODE", Nl: "MERODE"},
+			Mode: "metro", Color: "#E6B012", TextColor: "#000000",
+			StopCodes: []string{"8022", "8032", "8042"},
+		},
+		{
+			Code: "5", Direction: 1, Destination: i18nCell{Fr: "MERODE", Nl: "MERODE"},
+			Mode: "metro", Color: "#E6B012", TextColor: "#000000",
+			StopCodes: []string{"8042"},
+		},
+	}
+	if !reflect.DeepEqual(n.Lines, expectedLines) {
+		t.Errorf("ReadGTFS() lines = %+v, want %+v", n.Lines, expectedLines)
+	}
+}
+
+func TestReadGTFSMissingColumn(t *testing.T) {
+	path := writeGTFS(t, map[string]string{
+		"stops.txt":      "stop_id,stop_name\n8042,MERODE\n",
+		"routes.txt":     "route_id,route_type\n",
+		"trips.txt":      "route_id,trip_id\n",
+		"stop_times.txt": "trip_id,stop_id,stop_sequence\n",
+	})
+
+	if _, err := ReadGTFS(path); err == nil {
+		t.Errorf("ReadGTFS() expected an error for the missing coordinates")
+	}
+}
@@ -1,171 +1,151 @@
 package seeds
 
 import (
-	"context"
-	"database/sql"
 	"encoding/json"
-	"fmt"
-	"strconv"
+	"sort"
 
-	"github.com/jp-roisin/catch-and-go/internal/database"
+	"github.com/jp-roisin/catch-and-go/internal/database/store"
 )
 
-const stopsByLineFilePath = "internal/database/seeds/data/stops-by-line-production.csv"
+const stopsByLineFilePath = DataDir + "/stops-by-line-production.csv"
 
-func SeedLines(ctx context.Context, db *sql.DB) error {
-	linesResult, err := readCsvFile(stopsByLineFilePath)
-	if err != nil {
-		return err
-	}
-
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
+type lineStop struct {
+	Order int    `json:"order"`
+	Code  string `json:"id"`
+}
 
-	stmt, err := tx.PrepareContext(ctx, `
-			INSERT INTO lines (code, destination, direction)
-			VALUES (?, ?, ?)
-	`)
+// readLines parses the stops by line export, which holds one row per line direction
+// with its destination and its ordered stops. Invalid rows are reported and left out.
+func readLines(path string, r *Report) []NetworkLine {
+	linesResult, err := readCsvFile(path)
 	if err != nil {
-		tx.Rollback()
-		return err
+		r.errorf(path, 0, "", "%v", err)
+		return nil
 	}
-	defer stmt.Close()
 
-	count := 0
+	var lines []NetworkLine
 
+	var header []string
 	for i, row := range linesResult {
 		if i == 0 {
+			header = row
 			continue // skip csv header
 		}
 		if len(row) != 4 {
-			return fmt.Errorf("row %d has incorrect number of columns: %v", i+1, row)
+			r.errorf(path, i+1, "", "incorrect number of columns: %d instead of 4", len(row))
+			continue
 		}
 
 		destination := row[0]
 		direction := row[1]
-		code := row[2]
+		code := store.NormalizeLineCode(row[2])
+		lineStops := row[3]
+		valid := true
 
 		var d i18nCell
 		if err := json.Unmarshal([]byte(destination), &d); err != nil {
-			return fmt.Errorf("invalid JSON in 'destination' at row %d: %v", i+1, err)
+			r.errorf(path, i+1, csvColumn(header, 0), "invalid JSON: %v", err)
+			valid = false
 		}
 
 		if !validString.MatchString(direction) {
-			return fmt.Errorf("invalid stop ID at row %d: %q (must be alphanumeric)", i+1, direction)
+			r.errorf(path, i+1, csvColumn(header, 1), "invalid direction %q (must be alphanumeric)", direction)
+			valid = false
 		}
 
-		if !validInteger.MatchString(code) {
-			// Filtering lineIds like "N12"
-			fmt.Printf("Skipping lineId containing letters: %s\n", code)
-			continue
+		var ls []lineStop
+		if err := json.Unmarshal([]byte(lineStops), &ls); err != nil {
+			r.errorf(path, i+1, csvColumn(header, 3), "invalid JSON: %v", err)
+			valid = false
 		}
 
-		_, err = stmt.ExecContext(ctx, code, destination, directionToBoolean(direction))
-		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to insert row %d: %v", i+1, err)
+		// Codes can have letters, like the Noctis night lines ("N04")
+		if !validString.MatchString(code) {
+			r.errorf(path, i+1, csvColumn(header, 2), "invalid line ID %q (must be alphanumeric)", row[2])
+			valid = false
 		}
 
-		count++
-
-		if count%batchSize == 0 {
-			if err := tx.Commit(); err != nil {
-				return err
-			}
-			fmt.Printf("'Lines' batch complete: #%d \n", count/batchSize)
-
-			tx, err = db.BeginTx(ctx, nil)
-			if err != nil {
-				return err
-			}
+		if !valid {
+			continue
+		}
 
-			stmt, err = tx.PrepareContext(ctx, `INSERT INTO lines (code, destination, direction) VALUES (?, ?, ?)`)
-			if err != nil {
-				tx.Rollback()
-				return err
-			}
+		sort.SliceStable(ls, func(a, b int) bool { return ls[a].Order < ls[b].Order })
 
-			defer stmt.Close()
+		line := NetworkLine{
+			Code:        code,
+			Direction:   directionToBoolean(direction),
+			Destination: d,
 		}
-	}
-
-	// Commit remaining rows if any
-	if count%batchSize != 0 {
-		if err := tx.Commit(); err != nil {
-			return err
+		for _, st := range ls {
+			line.StopCodes = append(line.StopCodes, st.Code)
 		}
+
+		lines = append(lines, line)
 	}
 
-	return nil
+	return lines
 }
 
-const shapeFilesPath = "internal/database/seeds/data/shapefiles-production.csv"
+const shapeFilesPath = DataDir + "/shapefiles-production.csv"
 
-// SeedLinesMetadatas populates the `lines` table with additional metadata fields:
+type lineMetadata struct {
+	Mode  string
+	Color string
+}
+
+// readLinesMetadatas parses the additional metadata fields of the lines, by line code:
 // - `mode`: represents the type of transportation ("bus", "tram", or "metro")
 // - `color`: a HEX color code associated with the line (e.g., "#306196")
-func SeedLinesMetadatas(ctx context.Context, db *sql.DB) error {
-	metadataResult, err := readCsvFile(shapeFilesPath)
-	if err != nil {
-		return err
-	}
-
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
+func readLinesMetadatas(path string, r *Report) map[string]lineMetadata {
+	metadatas := make(map[string]lineMetadata)
 
-	stmt, err := tx.PrepareContext(ctx, `UPDATE lines SET mode = ?, color = ? WHERE code = ?`)
+	metadataResult, err := readCsvFile(path)
 	if err != nil {
-		tx.Rollback()
-		return err
+		r.errorf(path, 0, "", "%v", err)
+		return metadatas
 	}
-	defer stmt.Close()
 
+	var header []string
 	for i, row := range metadataResult {
 		if i == 0 {
+			header = row
 			continue // skip csv header
 		}
 		if len(row) != 2 {
-			return fmt.Errorf("row %d has incorrect number of columns: %v", i+1, row)
+			r.errorf(path, i+1, "", "incorrect number of columns: %d instead of 2", len(row))
+			continue
 		}
 
 		// Parse the first CSV column to extract the line ID and transportation mode.
 		// Example: "002m" yields:
-		// - lineId: 2   (parsed as int, with leading zeros removed)
+		// - lineId: "2"     (with leading zeros removed)
 		// - mode:   "metro" (derived from the final character)
+		// Night lines keep their letter: "N04b" yields "N04" and "bus".
 		idWithMode := validLineIdWithMode.FindStringSubmatch(row[0])
-		lineId, err := strconv.Atoi(idWithMode[1])
-		if err != nil {
-			return fmt.Errorf("invalid stop ID at row %d: %d (must be valid integer)", i+1, lineId)
+		if idWithMode == nil {
+			r.errorf(path, i+1, csvColumn(header, 0), "invalid line ID %q (must be an optional letter and digits, followed by the mode)", row[0])
+			continue
 		}
+		lineId := store.NormalizeLineCode(idWithMode[1])
 		mode, ok := modeMap[idWithMode[2]]
 		if !ok {
-			return fmt.Errorf("invalid mode at row %d: %s (must be either `m`, `b` or `t`)", i+1, mode)
+			r.errorf(path, i+1, csvColumn(header, 0), "invalid mode %s (must be either `m`, `b` or `t`)", idWithMode[2])
+			continue
 		}
 
 		color := row[1]
 		if !validHexColor.MatchString(color) {
-			return fmt.Errorf("invalid hex color at row %d: %s", i+1, color)
+			r.errorf(path, i+1, csvColumn(header, 1), "invalid hex color %s", color)
+			continue
 		}
 
-		_, err = stmt.ExecContext(ctx, mode, color, lineId)
-		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to insert row %d: %v", i+1, err)
-		}
+		metadatas[lineId] = lineMetadata{Mode: mode, Color: color}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
+	return metadatas
 }
 
-const textColorsFilesPath = "internal/database/seeds/data/lines_text_colors.csv"
+const textColorsFilesPath = DataDir + "/lines_text_colors.csv"
 
 // The STIB API does not provide text color information for the lines.
 // We created this CSV file manually based on the styles shown on:
@@ -178,57 +158,35 @@ const textColorsFilesPath = "internal/database/seeds/data/lines_text_colors.csv"
 // LIGNE;COLOR_HEX
 // 1;#ffffff
 // 2;#000000
-func SeedLinesTextColors(ctx context.Context, db *sql.DB, service database.Service) error {
-	textColorsResult, err := readCsvFile(textColorsFilesPath)
-	if err != nil {
-		return err
-	}
+func readLinesTextColors(path string, r *Report) map[string]string {
+	textColors := make(map[string]string)
 
-	tx, err := db.BeginTx(ctx, nil)
+	textColorsResult, err := readCsvFile(path)
 	if err != nil {
-		return err
+		r.errorf(path, 0, "", "%v", err)
+		return textColors
 	}
 
-	stmt, err := tx.PrepareContext(ctx, `
-			UPDATE lines
-			SET text_color = ?
-			WHERE id = ?;
-	`)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-	defer stmt.Close()
-
+	var header []string
 	for i, tc := range textColorsResult {
-		lineCode := tc[0]
-		lineTextColor := tc[1]
 		if i == 0 {
+			header = tc
 			continue // skip csv header
 		}
-		if lineTextColor != "#000000" {
-			continue // white is the DB's default value
-		}
-
-		// should return 2 result (two directions per line)
-		lines, err := service.ListLinesByCode(ctx, lineCode)
-		if err != nil {
-			fmt.Printf("Couldn't find lines with code = %d\n", lineCode)
+		if len(tc) != 2 {
+			r.errorf(path, i+1, "", "incorrect number of columns: %d instead of 2", len(tc))
 			continue
 		}
 
-		for _, l := range lines {
-			_, err = stmt.ExecContext(ctx, lineTextColor, l.ID)
-			if err != nil {
-				tx.Rollback()
-				return fmt.Errorf("failed to insert row %d: %v", i+1, err)
-			}
+		lineCode := store.NormalizeLineCode(tc[0])
+		lineTextColor := tc[1]
+		if !validHexColor.MatchString(lineTextColor) {
+			r.errorf(path, i+1, csvColumn(header, 1), "invalid hex color %s", lineTextColor)
+			continue
 		}
-	}
 
-	if err := tx.Commit(); err != nil {
-		return err
+		textColors[lineCode] = lineTextColor
 	}
 
-	return nil
+	return textColors
 }
@@ -0,0 +1,610 @@
+package seeds
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jp-roisin/catch-and-go/internal/database"
+)
+
+// Network is the transit data the seeders load into the database,
+// whatever the source it was read from.
+type Network struct {
+	Stops []NetworkStop
+	Lines []NetworkLine
+}
+
+type NetworkStop struct {
+	Code     string
+	Name     i18nCell
+	Location Location
+	// Station is the parent station of the stop in the source, empty when it doesn't tell.
+	// The platforms without one are grouped into stations by name and distance.
+	Station string
+}
+
+// NetworkLine is one direction of a line, with its stops in order.
+type NetworkLine struct {
+	Code        string
+	Direction   int
+	Destination i18nCell
+	// Mode, Color and TextColor are left empty when the source doesn't provide them.
+	Mode      string
+	Color     string
+	TextColor string
+	StopCodes []string
+}
+
+// SyncReport counts the rows a sync added, changed or removed.
+type SyncReport struct {
+	StopsAdded   int
+	StopsChanged int
+	StopsRemoved int
+
+	StationsAdded   int
+	StationsChanged int
+	StationsRemoved int
+
+	LinesAdded   int
+	LinesChanged int
+	LinesRemoved int
+
+	LineStopsAdded   int
+	LineStopsRemoved int
+	// UnknownStopFallbacks is the number of line stops missing from the network,
+	// which point to the unknown stop instead.
+	UnknownStopFallbacks int
+
+	// Dashboards following a stop that left the network are moved to the stop
+	// replacing it when there is one, and flagged otherwise.
+	DashboardsRemapped int
+	DashboardsFlagged  int
+	DashboardsRestored int
+}
+
+func (r SyncReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "stops: %d added, %d changed, %d removed\n", r.StopsAdded, r.StopsChanged, r.StopsRemoved)
+	fmt.Fprintf(&sb, "stations: %d added, %d changed, %d removed\n", r.StationsAdded, r.StationsChanged, r.StationsRemoved)
+	fmt.Fprintf(&sb, "lines: %d added, %d changed, %d removed\n", r.LinesAdded, r.LinesChanged, r.LinesRemoved)
+	fmt.Fprintf(&sb, "stops by lines: %d added, %d removed, %d unknown stop fallbacks\n", r.LineStopsAdded, r.LineStopsRemoved, r.UnknownStopFallbacks)
+	fmt.Fprintf(&sb, "dashboards: %d remapped, %d flagged, %d restored", r.DashboardsRemapped, r.DashboardsFlagged, r.DashboardsRestored)
+	return sb.String()
+}
+
+type existingStop struct {
+	id       int64
+	name     i18nCell
+	location Location
+}
+
+type existingStation struct {
+	id   int64
+	name string
+	geo  string
+}
+
+type lineKey struct {
+	code      string
+	direction int
+}
+
+type existingLine struct {
+	id          int64
+	destination i18nCell
+	mode        sql.NullString
+	color       sql.NullString
+	textColor   string
+}
+
+// SyncNetwork brings the database in line with a network, in a single transaction,
+// without touching the sessions: stops are matched by code and lines by code and
+// direction, so the rows (and the dashboards pointing to them) keep their ids.
+//
+// Stops referenced by a line but missing from the network are replaced by the unknown stop.
+func SyncNetwork(ctx context.Context, db *sql.DB, n Network) (SyncReport, error) {
+	var report SyncReport
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	unknownStopID, err := ensureUnknownStop(ctx, tx)
+	if err != nil {
+		return report, err
+	}
+
+	stopIDs, err := syncStops(ctx, tx, n.Stops, &report)
+	if err != nil {
+		return report, err
+	}
+	stopIDs[database.UnknownStopCode] = unknownStopID
+
+	if err := syncStations(ctx, tx, n.Stops, stopIDs, &report); err != nil {
+		return report, err
+	}
+
+	if err := syncLines(ctx, tx, n.Lines, stopIDs, &report); err != nil {
+		return report, err
+	}
+
+	if err := syncDashboards(ctx, tx, n.Stops, &report); err != nil {
+		return report, err
+	}
+
+	return report, tx.Commit()
+}
+
+func ensureUnknownStop(ctx context.Context, tx *sql.Tx) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, `SELECT id FROM stops WHERE code = ?`, database.UnknownStopCode).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	// Insert a fallback "unknown stop", used as a default reference in the
+	// stops_by_lines table when a stop of a line cannot be resolved.
+	us := getUnknownStop()
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO stops (code, lat, lon, name_fr, name_nl) VALUES (?, ?, ?, ?, ?)
+	`, us.Code, us.Lat, us.Lon, us.NameFr, us.NameNl)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert unknown stop row: %v", err)
+	}
+	return res.LastInsertId()
+}
+
+// syncStops upserts the stops of the network and returns their ids by code.
+// Stops that left the network are handled with the dashboards.
+func syncStops(ctx context.Context, tx *sql.Tx, stops []NetworkStop, report *SyncReport) (map[string]int64, error) {
+	existing, err := listExistingStops(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	stopIDs := make(map[string]int64, len(stops))
+	for _, s := range stops {
+		e, ok := existing[s.Code]
+		switch {
+		case !ok:
+			res, err := tx.ExecContext(ctx, `
+				INSERT INTO stops (code, lat, lon, name_fr, name_nl) VALUES (?, ?, ?, ?, ?)
+			`, s.Code, s.Location.Latitude, s.Location.Longitude, s.Name.Fr, s.Name.Nl)
+			if err != nil {
+				return nil, fmt.Errorf("failed to insert stop %s: %v", s.Code, err)
+			}
+			if e.id, err = res.LastInsertId(); err != nil {
+				return nil, err
+			}
+			report.StopsAdded++
+		case e.name != s.Name || e.location != s.Location:
+			_, err := tx.ExecContext(ctx, `
+				UPDATE stops SET lat = ?, lon = ?, name_fr = ?, name_nl = ? WHERE id = ?
+			`, s.Location.Latitude, s.Location.Longitude, s.Name.Fr, s.Name.Nl, e.id)
+			if err != nil {
+				return nil, fmt.Errorf("failed to update stop %s: %v", s.Code, err)
+			}
+			report.StopsChanged++
+		}
+
+		stopIDs[s.Code] = e.id
+	}
+
+	return stopIDs, nil
+}
+
+// stationRadius is how far from one another the platforms grouped by name can be,
+// stops sharing a name further apart are in different places.
+const stationRadius = 250 // meters
+
+// stationGroup holds the platforms of a station and the key identifying it across syncs.
+type stationGroup struct {
+	key       string
+	name      string
+	platforms []NetworkStop
+}
+
+// groupStations groups the stops into stations: by their parent station when the
+// source tells it, and otherwise by name, only keeping together the platforms
+// within stationRadius of another one.
+func groupStations(stops []NetworkStop) ([]stationGroup, error) {
+	var groups []stationGroup
+	parents := make(map[string]int)
+	var names []string
+	byName := make(map[string][]NetworkStop)
+
+	for _, s := range stops {
+		name, err := json.Marshal(s.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.Station != "" {
+			i, ok := parents[s.Station]
+			if !ok {
+				i = len(groups)
+				parents[s.Station] = i
+				groups = append(groups, stationGroup{key: "parent_station:" + s.Station, name: string(name)})
+			}
+			groups[i].platforms = append(groups[i].platforms, s)
+			continue
+		}
+
+		if _, ok := byName[string(name)]; !ok {
+			names = append(names, string(name))
+		}
+		byName[string(name)] = append(byName[string(name)], s)
+	}
+
+	for _, name := range names {
+		clusters := clusterPlatforms(byName[name])
+		for _, platforms := range clusters {
+			// A name found in a single place is the key, like before stations could share a name
+			key := name
+			if len(clusters) > 1 {
+				key = name + "@" + slices.MinFunc(platforms, func(a, b NetworkStop) int {
+					return strings.Compare(a.Code, b.Code)
+				}).Code
+			}
+			groups = append(groups, stationGroup{key: key, name: name, platforms: platforms})
+		}
+	}
+
+	return groups, nil
+}
+
+// clusterPlatforms splits stops sharing a name into groups where every platform is
+// within stationRadius of another one of its group.
+func clusterPlatforms(stops []NetworkStop) [][]NetworkStop {
+	var clusters [][]NetworkStop
+	grouped := make([]bool, len(stops))
+
+	for i := range stops {
+		if grouped[i] {
+			continue
+		}
+		grouped[i] = true
+		cluster := []NetworkStop{stops[i]}
+
+		for next := 0; next < len(cluster); next++ {
+			p := cluster[next]
+			for j := range stops {
+				if grouped[j] {
+					continue
+				}
+				d := database.Haversine(p.Location.Latitude, p.Location.Longitude, stops[j].Location.Latitude, stops[j].Location.Longitude)
+				if d <= stationRadius {
+					grouped[j] = true
+					cluster = append(cluster, stops[j])
+				}
+			}
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters
+}
+
+// syncStations groups the stops into stations (see groupStations), located at the
+// center of their platforms, and removes the stations that no longer have any.
+func syncStations(ctx context.Context, tx *sql.Tx, stops []NetworkStop, stopIDs map[string]int64, report *SyncReport) error {
+	groups, err := groupStations(stops)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]existingStation)
+	rows, err := tx.QueryContext(ctx, `SELECT id, key, name, geo FROM stations`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var e existingStation
+		var key string
+		if err := rows.Scan(&e.id, &key, &e.name, &e.geo); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[key] = e
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		var center Location
+		for _, p := range g.platforms {
+			center.Latitude += p.Location.Latitude
+			center.Longitude += p.Location.Longitude
+		}
+		center.Latitude /= float64(len(g.platforms))
+		center.Longitude /= float64(len(g.platforms))
+		geo, err := json.Marshal(center)
+		if err != nil {
+			return err
+		}
+
+		e, ok := existing[g.key]
+		switch {
+		case !ok:
+			res, err := tx.ExecContext(ctx, `INSERT INTO stations (key, name, geo) VALUES (?, ?, ?)`, g.key, g.name, string(geo))
+			if err != nil {
+				return fmt.Errorf("failed to insert station %s: %v", g.key, err)
+			}
+			if e.id, err = res.LastInsertId(); err != nil {
+				return err
+			}
+			report.StationsAdded++
+		case e.name != g.name || e.geo != string(geo):
+			if _, err := tx.ExecContext(ctx, `UPDATE stations SET name = ?, geo = ? WHERE id = ?`, g.name, string(geo), e.id); err != nil {
+				return fmt.Errorf("failed to update station %s: %v", g.key, err)
+			}
+			report.StationsChanged++
+		}
+		delete(existing, g.key)
+
+		for _, p := range g.platforms {
+			if _, err := tx.ExecContext(ctx, `UPDATE stops SET station_id = ? WHERE id = ? AND station_id IS NOT ?`, e.id, stopIDs[p.Code], e.id); err != nil {
+				return err
+			}
+		}
+	}
+
+	for key, e := range existing {
+		// Stops that left the network but are kept for their dashboards may still point to it
+		if _, err := tx.ExecContext(ctx, `UPDATE stops SET station_id = NULL WHERE station_id = ?`, e.id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM stations WHERE id = ?`, e.id); err != nil {
+			return fmt.Errorf("failed to remove station %s: %v", key, err)
+		}
+		report.StationsRemoved++
+	}
+
+	return nil
+}
+
+func listExistingStops(ctx context.Context, tx *sql.Tx) (map[string]existingStop, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, code, lat, lon, name_fr, name_nl FROM stops WHERE code != ?`, database.UnknownStopCode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stops := make(map[string]existingStop)
+	for rows.Next() {
+		var s existingStop
+		var code string
+		if err := rows.Scan(&s.id, &code, &s.location.Latitude, &s.location.Longitude, &s.name.Fr, &s.name.Nl); err != nil {
+			return nil, err
+		}
+		stops[code] = s
+	}
+	return stops, rows.Err()
+}
+
+// syncLines upserts the lines of the network with their stops, and removes the others.
+func syncLines(ctx context.Context, tx *sql.Tx, lines []NetworkLine, stopIDs map[string]int64, report *SyncReport) error {
+	existing, err := listExistingLines(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[lineKey]bool, len(lines))
+	for _, l := range lines {
+		key := lineKey{l.Code, l.Direction}
+		if seen[key] {
+			return fmt.Errorf("line %s (direction %d) appears twice in the network", l.Code, l.Direction)
+		}
+		seen[key] = true
+
+		mode, color, textColor := nullString(l.Mode), nullString(l.Color), textColorOrDefault(l.TextColor)
+
+		e, ok := existing[key]
+		switch {
+		case !ok:
+			res, err := tx.ExecContext(ctx, `
+				INSERT INTO lines (code, destination_fr, destination_nl, direction, mode, color, text_color)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, l.Code, l.Destination.Fr, l.Destination.Nl, l.Direction, mode, color, textColor)
+			if err != nil {
+				return fmt.Errorf("failed to insert line %s (direction %d): %v", l.Code, l.Direction, err)
+			}
+			if e.id, err = res.LastInsertId(); err != nil {
+				return err
+			}
+			report.LinesAdded++
+		case e.destination != l.Destination || e.mode != mode || e.color != color || e.textColor != textColor:
+			_, err := tx.ExecContext(ctx, `
+				UPDATE lines SET destination_fr = ?, destination_nl = ?, mode = ?, color = ?, text_color = ?
+				WHERE id = ?
+			`, l.Destination.Fr, l.Destination.Nl, mode, color, textColor, e.id)
+			if err != nil {
+				return fmt.Errorf("failed to update line %s (direction %d): %v", l.Code, l.Direction, err)
+			}
+			report.LinesChanged++
+		}
+
+		ids := make([]int64, 0, len(l.StopCodes))
+		for _, code := range l.StopCodes {
+			id, ok := stopIDs[code]
+			if !ok {
+				id = stopIDs[database.UnknownStopCode]
+				report.UnknownStopFallbacks++
+			}
+			ids = append(ids, id)
+		}
+
+		added, removed, err := syncLineStops(ctx, tx, e.id, ids)
+		if err != nil {
+			return fmt.Errorf("failed to sync the stops of line %s (direction %d): %v", l.Code, l.Direction, err)
+		}
+		report.LineStopsAdded += added
+		report.LineStopsRemoved += removed
+	}
+
+	for key, e := range existing {
+		if seen[key] {
+			continue
+		}
+
+		_, removed, err := syncLineStops(ctx, tx, e.id, nil)
+		if err != nil {
+			return fmt.Errorf("failed to remove the stops of line %s (direction %d): %v", key.code, key.direction, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM lines WHERE id = ?`, e.id); err != nil {
+			return fmt.Errorf("failed to remove line %s (direction %d): %v", key.code, key.direction, err)
+		}
+		report.LineStopsRemoved += removed
+		report.LinesRemoved++
+	}
+
+	return nil
+}
+
+func listExistingLines(ctx context.Context, tx *sql.Tx) (map[lineKey]existingLine, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, code, direction, destination_fr, destination_nl, mode, color, text_color FROM lines`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make(map[lineKey]existingLine)
+	for rows.Next() {
+		var l existingLine
+		var key lineKey
+		if err := rows.Scan(&l.id, &key.code, &key.direction, &l.destination.Fr, &l.destination.Nl, &l.mode, &l.color, &l.textColor); err != nil {
+			return nil, err
+		}
+		lines[key] = l
+	}
+	return lines, rows.Err()
+}
+
+// syncDashboards deals with the dashboards whose stop left the network, and
+// restores the flagged ones whose stop came back. Stops that left the network
+// are removed unless a flagged dashboard still points to them, those are only
+// marked with removed_at.
+func syncDashboards(ctx context.Context, tx *sql.Tx, stops []NetworkStop, report *SyncReport) error {
+	inNetwork := make(map[string]bool, len(stops))
+	for _, s := range stops {
+		inNetwork[s.Code] = true
+	}
+
+	existing, err := listExistingStops(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	for code, e := range existing {
+		if inNetwork[code] {
+			if _, err := tx.ExecContext(ctx, `UPDATE stops SET removed_at = NULL WHERE id = ? AND removed_at IS NOT NULL`, e.id); err != nil {
+				return err
+			}
+			res, err := tx.ExecContext(ctx, `UPDATE dashboards SET stop_removed_at = NULL WHERE stop_id = ? AND stop_removed_at IS NOT NULL`, e.id)
+			if err != nil {
+				return err
+			}
+			restored, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			report.DashboardsRestored += int(restored)
+			continue
+		}
+
+		var followers int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM dashboards WHERE stop_id = ?`, e.id).Scan(&followers); err != nil {
+			return err
+		}
+
+		if followers > 0 {
+			replacement, ok := findReplacement(e, stops)
+			if !ok {
+				res, err := tx.ExecContext(ctx, `UPDATE dashboards SET stop_removed_at = CURRENT_TIMESTAMP WHERE stop_id = ? AND stop_removed_at IS NULL`, e.id)
+				if err != nil {
+					return err
+				}
+				flagged, err := res.RowsAffected()
+				if err != nil {
+					return err
+				}
+				report.DashboardsFlagged += int(flagged)
+
+				// The stop is kept for its dashboards, a former sync may already have removed it
+				res, err = tx.ExecContext(ctx, `UPDATE stops SET removed_at = CURRENT_TIMESTAMP WHERE id = ? AND removed_at IS NULL`, e.id)
+				if err != nil {
+					return err
+				}
+				removed, err := res.RowsAffected()
+				if err != nil {
+					return err
+				}
+				report.StopsRemoved += int(removed)
+				continue
+			}
+
+			_, err := tx.ExecContext(ctx, `
+				UPDATE dashboards SET stop_id = (SELECT id FROM stops WHERE code = ?), stop_removed_at = NULL
+				WHERE stop_id = ?
+			`, replacement.Code, e.id)
+			if err != nil {
+				return err
+			}
+			report.DashboardsRemapped += followers
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM stops WHERE id = ?`, e.id); err != nil {
+			return fmt.Errorf("failed to remove stop %s: %v", code, err)
+		}
+		report.StopsRemoved++
+	}
+
+	return nil
+}
+
+// findReplacement looks for the stop taking over from a removed one: a stop with
+// the same name, the closest one if several match. Stops are often renumbered
+// when they are moved, while their name doesn't change.
+func findReplacement(removed existingStop, stops []NetworkStop) (NetworkStop, bool) {
+	var best NetworkStop
+	found := false
+	bestDistance := 0.0
+
+	for _, s := range stops {
+		if s.Name != removed.name {
+			continue
+		}
+		dLat := s.Location.Latitude - removed.location.Latitude
+		dLon := s.Location.Longitude - removed.location.Longitude
+		distance := dLat*dLat + dLon*dLon
+		if !found || distance < bestDistance {
+			best, bestDistance, found = s, distance, true
+		}
+	}
+
+	return best, found
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// The column has a NOT NULL default, which an explicit value overrides.
+func textColorOrDefault(color string) string {
+	if color == "" {
+		return "#ffffff"
+	}
+	return color
+}
@@ -0,0 +1,338 @@
+package seeds
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/jp-roisin/catch-and-go/internal/database"
+	"github.com/jp-roisin/catch-and-go/internal/database/store"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens its own database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	return db
+}
+
+func testNetwork() Network {
+	return Network{
+		Stops: []NetworkStop{
+			{Code: "8042", Name: i18nCell{Fr: "MERODE", Nl: "MERODE"}, Location: Location{Latitude: 50.8386, Longitude: 4.3986}},
+			{Code: "8032", Name: i18nCell{Fr: "SCHUMAN", Nl: "SCHUMAN"}, Location: Location{Latitude: 50.8432, Longitude: 4.3808}},
+			{Code: "8022", Name: i18nCell{Fr: "MAELBEEK", Nl: "MAELBEEK"}, Location: Location{Latitude: 50.8440, Longitude: 4.3775}},
+		},
+		Lines: []NetworkLine{
+			{
+				Code: "1", Direction: 0, Destination: i18nCell{Fr: "STOCKEL", Nl: "STOKKEL"},
+				Mode: "metro", Color: "#C4008F",
+				StopCodes: []string{"8022", "8032", "8042"},
+			},
+			{
+				Code: "1", Direction: 1, Destination: i18nCell{Fr: "GARE DE L'OUEST", Nl: "WESTSTATION"},
+				Mode: "metro", Color: "#C4008F",
+				StopCodes: []string{"8042", "8032", "8022", "9999"},
+			},
+		},
+	}
+}
+
+func addDashboard(t *testing.T, db *sql.DB, stopCode string) int64 {
+	t.Helper()
+
+	if _, err := db.Exec(`INSERT OR IGNORE INTO sessions (id) VALUES ('s1')`); err != nil {
+		t.Fatal(err)
+	}
+	res, err := db.Exec(`INSERT INTO dashboards (session_id, stop_id) SELECT 's1', id FROM stops WHERE code = ?`, stopCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func dashboardStop(t *testing.T, db *sql.DB, id int64) (code string, removed bool) {
+	t.Helper()
+
+	var removedAt sql.NullString
+	err := db.QueryRow(`
+		SELECT s.code, d.stop_removed_at FROM dashboards d JOIN stops s ON s.id = d.stop_id
+		WHERE d.id = ?
+	`, id).Scan(&code, &removedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, removedAt.Valid
+}
+
+func TestSyncNetwork(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	report, err := SyncNetwork(ctx, db, testNetwork())
+	if err != nil {
+		t.Fatalf("SyncNetwork() error = %v", err)
+	}
+	expected := SyncReport{StopsAdded: 3, StationsAdded: 3, LinesAdded: 2, LineStopsAdded: 7, UnknownStopFallbacks: 1}
+	if report != expected {
+		t.Errorf("first SyncNetwork() = %+v, want %+v", report, expected)
+	}
+
+	report, err = SyncNetwork(ctx, db, testNetwork())
+	if err != nil {
+		t.Fatalf("SyncNetwork() error = %v", err)
+	}
+	if report != (SyncReport{UnknownStopFallbacks: 1}) {
+		t.Errorf("second SyncNetwork() = %+v, want no changes", report)
+	}
+
+	merode := addDashboard(t, db, "8042")
+	maelbeek := addDashboard(t, db, "8022")
+
+	// Maelbeek is renumbered, Merode leaves the network and line 1 loses a direction
+	n := testNetwork()
+	n.Stops = []NetworkStop{
+		n.Stops[1],
+		{Code: "5710", Name: n.Stops[2].Name, Location: n.Stops[2].Location},
+	}
+	n.Lines = []NetworkLine{{
+		Code: "1", Direction: 0, Destination: i18nCell{Fr: "STOCKEL", Nl: "STOKKEL"},
+		Mode: "metro", Color: "#C4008F",
+		StopCodes: []string{"5710", "8032"},
+	}}
+
+	report, err = SyncNetwork(ctx, db, n)
+	if err != nil {
+		t.Fatalf("SyncNetwork() error = %v", err)
+	}
+	expected = SyncReport{
+		StopsAdded:         1,
+		StopsRemoved:       2,
+		StationsRemoved:    1,
+		LinesRemoved:       1,
+		LineStopsAdded:     1,
+		LineStopsRemoved:   6,
+		DashboardsRemapped: 1,
+		DashboardsFlagged:  1,
+	}
+	if report != expected {
+		t.Errorf("third SyncNetwork() = %+v, want %+v", report, expected)
+	}
+
+	if code, removed := dashboardStop(t, db, maelbeek); code != "5710" || removed {
+		t.Errorf("renumbered stop dashboard = (%s, %v), want (5710, false)", code, removed)
+	}
+	if code, removed := dashboardStop(t, db, merode); code != "8042" || !removed {
+		t.Errorf("removed stop dashboard = (%s, %v), want (8042, true)", code, removed)
+	}
+
+	var stops int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM stops WHERE code = '8022'`).Scan(&stops); err != nil {
+		t.Fatal(err)
+	}
+	if stops != 0 {
+		t.Errorf("stop 8022 was not removed")
+	}
+
+	if !stopRemoved(t, db, "8042") {
+		t.Errorf("stop 8042 kept for its dashboard isn't marked removed")
+	}
+
+	// Merode is still gone, it was already counted as removed
+	report, err = SyncNetwork(ctx, db, n)
+	if err != nil {
+		t.Fatalf("SyncNetwork() error = %v", err)
+	}
+	if report != (SyncReport{}) {
+		t.Errorf("repeated SyncNetwork() = %+v, want no changes", report)
+	}
+
+	// Merode comes back
+	report, err = SyncNetwork(ctx, db, testNetwork())
+	if err != nil {
+		t.Fatalf("SyncNetwork() error = %v", err)
+	}
+	if report.DashboardsRestored != 1 {
+		t.Errorf("fifth SyncNetwork() restored %d dashboards, want 1", report.DashboardsRestored)
+	}
+	if code, removed := dashboardStop(t, db, merode); code != "8042" || removed {
+		t.Errorf("restored stop dashboard = (%s, %v), want (8042, false)", code, removed)
+	}
+	if stopRemoved(t, db, "8042") {
+		t.Errorf("stop 8042 is still marked removed after coming back")
+	}
+}
+
+func stopRemoved(t *testing.T, db *sql.DB, code string) bool {
+	t.Helper()
+
+	var removed bool
+	if err := db.QueryRow(`SELECT removed_at IS NOT NULL FROM stops WHERE code = ?`, code).Scan(&removed); err != nil {
+		t.Fatal(err)
+	}
+	return removed
+}
+
+func TestSyncNetworkStations(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	maelbeek := i18nCell{Fr: "MAELBEEK", Nl: "MAALBEEK"}
+	n := Network{Stops: []NetworkStop{
+		{Code: "5710F", Name: maelbeek, Location: Location{Latitude: 50.8440, Longitude: 4.3770}},
+		{Code: "5710G", Name: maelbeek, Location: Location{Latitude: 50.8442, Longitude: 4.3780}},
+		{Code: "8032", Name: i18nCell{Fr: "SCHUMAN", Nl: "SCHUMAN"}, Location: Location{Latitude: 50.8432, Longitude: 4.3808}},
+	}}
+
+	report, err := SyncNetwork(ctx, db, n)
+	if err != nil {
+		t.Fatalf("SyncNetwork() error = %v", err)
+	}
+	if report.StopsAdded != 3 || report.StationsAdded != 2 {
+		t.Errorf("SyncNetwork() = %+v, want 3 stops and 2 stations added", report)
+	}
+
+	var stations int
+	var geo string
+	err = db.QueryRow(`
+		SELECT COUNT(DISTINCT s.station_id), st.geo FROM stops s JOIN stations st ON st.id = s.station_id
+		WHERE s.code IN ('5710F', '5710G')
+	`).Scan(&stations, &geo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stations != 1 {
+		t.Errorf("the platforms of MAELBEEK are in %d stations, want 1", stations)
+	}
+	var center Location
+	if err := json.Unmarshal([]byte(geo), &center); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(center.Latitude-50.8441) > 1e-9 || math.Abs(center.Longitude-4.3775) > 1e-9 {
+		t.Errorf("station location = %s, want the center of its platforms", geo)
+	}
+}
+
+func TestSyncNetworkStationsApartOrWithParents(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	// Two stops named CIMETIERE on both ends of the city, and a metro station whose
+	// platforms are given by their parent station even though their names differ
+	cimetiere := i18nCell{Fr: "CIMETIERE", Nl: "KERKHOF"}
+	n := Network{Stops: []NetworkStop{
+		{Code: "1001", Name: cimetiere, Location: Location{Latitude: 50.8100, Longitude: 4.2900}},
+		{Code: "1002", Name: cimetiere, Location: Location{Latitude: 50.8101, Longitude: 4.2902}},
+		{Code: "2001", Name: cimetiere, Location: Location{Latitude: 50.8900, Longitude: 4.4100}},
+		{Code: "8042", Name: i18nCell{Fr: "MERODE", Nl: "MERODE"}, Location: Location{Latitude: 50.8386, Longitude: 4.3986}, Station: "S1"},
+		{Code: "8041", Name: i18nCell{Fr: "MERODE (QUAI 2)", Nl: "MERODE (PERRON 2)"}, Location: Location{Latitude: 50.8387, Longitude: 4.3987}, Station: "S1"},
+	}}
+
+	report, err := SyncNetwork(ctx, db, n)
+	if err != nil {
+		t.Fatalf("SyncNetwork() error = %v", err)
+	}
+	if report.StationsAdded != 3 {
+		t.Errorf("SyncNetwork() added %d stations, want 3", report.StationsAdded)
+	}
+
+	sameStation := func(a, b string) bool {
+		t.Helper()
+		var n int
+		err := db.QueryRow(`SELECT COUNT(DISTINCT station_id) FROM stops WHERE code IN (?, ?) AND station_id IS NOT NULL`, a, b).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n == 1
+	}
+	if !sameStation("1001", "1002") {
+		t.Errorf("the neighbouring CIMETIERE platforms are in different stations")
+	}
+	if sameStation("1001", "2001") {
+		t.Errorf("the CIMETIERE stops kilometers apart are in the same station")
+	}
+	if !sameStation("8041", "8042") {
+		t.Errorf("the platforms of the parent station S1 are in different stations")
+	}
+
+	// Nothing moved, the stations keep their ids
+	report, err = SyncNetwork(ctx, db, n)
+	if err != nil {
+		t.Fatalf("second SyncNetwork() error = %v", err)
+	}
+	if report.StationsAdded != 0 || report.StationsChanged != 0 || report.StationsRemoved != 0 {
+		t.Errorf("second SyncNetwork() = %+v, want the stations untouched", report)
+	}
+}
+
+func TestSyncNetworkRemovedStopsLeaveSearch(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	queries := store.New(db)
+
+	if _, err := SyncNetwork(ctx, db, testNetwork()); err != nil {
+		t.Fatalf("SyncNetwork() error = %v", err)
+	}
+	addDashboard(t, db, "8042")
+
+	// Merode leaves the network, it's kept for its dashboard only
+	n := testNetwork()
+	n.Stops = n.Stops[1:]
+	if _, err := SyncNetwork(ctx, db, n); err != nil {
+		t.Fatalf("SyncNetwork() error = %v", err)
+	}
+
+	found := func() (search, list, box bool) {
+		t.Helper()
+
+		searched, err := queries.SearchStops(ctx, store.SearchStopsParams{Query: "merode*", UnknownStopCode: database.UnknownStopCode, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		listed, err := queries.ListStops(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		boxed, err := queries.ListStopsInBox(ctx, store.ListStopsInBoxParams{
+			MinLatitude: 50.83, MaxLatitude: 50.85, MinLongitude: 4.39, MaxLongitude: 4.41,
+			UnknownStopCode: database.UnknownStopCode,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		isMerode := func(s store.Stop) bool { return s.Code == "8042" }
+		return slices.ContainsFunc(searched, isMerode), slices.ContainsFunc(listed, isMerode), slices.ContainsFunc(boxed, isMerode)
+	}
+
+	if search, list, box := found(); search || list || box {
+		t.Errorf("the removed stop is still offered: search %v, list %v, nearby %v", search, list, box)
+	}
+
+	// Merode comes back
+	if _, err := SyncNetwork(ctx, db, testNetwork()); err != nil {
+		t.Fatalf("SyncNetwork() error = %v", err)
+	}
+	if search, list, box := found(); !search || !list || !box {
+		t.Errorf("the stop back in the network isn't offered: search %v, list %v, nearby %v", search, list, box)
+	}
+}
@@ -0,0 +1,120 @@
+package seeds
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Problem is something wrong found in an input file.
+type Problem struct {
+	File string
+	// Row is the 1-based row of the file, the header being row 1. It is 0 when
+	// the problem concerns the whole file.
+	Row int
+	// Column is empty when the problem concerns the whole row.
+	Column  string
+	Message string
+}
+
+func (p Problem) String() string {
+	var sb strings.Builder
+	sb.WriteString(p.File)
+	if p.Row > 0 {
+		fmt.Fprintf(&sb, ":%d", p.Row)
+	}
+	if p.Column != "" {
+		fmt.Fprintf(&sb, " [%s]", p.Column)
+	}
+	sb.WriteString(": ")
+	sb.WriteString(p.Message)
+	return sb.String()
+}
+
+// Report collects what went wrong while reading a network, so that every
+// problem is reported at once instead of stopping at the first one.
+type Report struct {
+	// Errors are the rows left out because they are invalid, or the files that
+	// couldn't be read.
+	Errors []Problem
+	// Warnings are the rows skipped on purpose, or read with a fallback.
+	Warnings []Problem
+
+	Stops int
+	Lines int
+	// UnknownStopFallbacks is the number of line stops missing from the stops,
+	// which will point to the unknown stop once seeded.
+	UnknownStopFallbacks int
+}
+
+func (r *Report) errorf(file string, row int, column, format string, args ...any) {
+	r.Errors = append(r.Errors, Problem{filepath.Base(file), row, column, fmt.Sprintf(format, args...)})
+}
+
+func (r *Report) warnf(file string, row int, column, format string, args ...any) {
+	r.Warnings = append(r.Warnings, Problem{filepath.Base(file), row, column, fmt.Sprintf(format, args...)})
+}
+
+// Err returns the errors of the report as a single error, or nil when there are none.
+func (r *Report) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	errs := make([]error, 0, len(r.Errors))
+	for _, p := range r.Errors {
+		errs = append(errs, errors.New(p.String()))
+	}
+	return errors.Join(errs...)
+}
+
+// summarize counts the stops, lines and unknown stop fallbacks of the network read.
+// The unknown stops are reported once per line, with the file of the lines.
+func (r *Report) summarize(n Network, linesFile string) {
+	r.Stops = len(n.Stops)
+	r.Lines = len(n.Lines)
+
+	known := make(map[string]bool, len(n.Stops))
+	for _, s := range n.Stops {
+		known[s.Code] = true
+	}
+
+	for _, l := range n.Lines {
+		var unknown []string
+		for _, code := range l.StopCodes {
+			if !known[code] {
+				unknown = append(unknown, code)
+			}
+		}
+		if len(unknown) == 0 {
+			continue
+		}
+		r.UnknownStopFallbacks += len(unknown)
+		sort.Strings(unknown)
+		r.warnf(linesFile, 0, "", "line %s (direction %d): unknown stops %s fall back to the unknown stop",
+			l.Code, l.Direction, strings.Join(unknown, ", "))
+	}
+}
+
+func (r Report) String() string {
+	var sb strings.Builder
+	for _, p := range r.Errors {
+		fmt.Fprintf(&sb, "error: %s\n", p)
+	}
+	for _, p := range r.Warnings {
+		fmt.Fprintf(&sb, "warning: %s\n", p)
+	}
+	fmt.Fprintf(&sb, "%d stops, %d lines, %d unknown stop fallbacks\n", r.Stops, r.Lines, r.UnknownStopFallbacks)
+	fmt.Fprintf(&sb, "%d errors, %d warnings", len(r.Errors), len(r.Warnings))
+	return sb.String()
+}
+
+// csvColumn names a column of a CSV file after its header, or its position
+// when the header is too short.
+func csvColumn(header []string, i int) string {
+	if i < len(header) && header[i] != "" {
+		return strings.TrimPrefix(header[i], "\ufeff")
+	}
+	return fmt.Sprintf("column %d", i+1)
+}
@@ -0,0 +1,99 @@
+package seeds
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeCSV(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadCSVReportsEveryProblem(t *testing.T) {
+	stopsPath := writeCSV(t, "stops.csv", "gpscoordinates;id;name\n"+
+		`{"latitude": 50.8386, "longitude": 4.3986};8042;{"fr": "MERODE", "nl": "MERODE"}`+"\n"+
+		`{"latitude": 50.8432;8032;{"fr": "SCHUMAN"}`+"\n"+
+		`{"latitude": 50.8440, "longitude": 4.3775};M-1;{"fr": "MAELBEEK", "nl": "MAELBEEK"}`+"\n"+
+		"too;short\n")
+	linesPath := writeCSV(t, "lines.csv", "destination;direction;lineid;points\n"+
+		`{"fr": "STOCKEL", "nl": "STOKKEL"};City;1;[{"id": "8042", "order": 1}, {"id": "8032", "order": 2}]`+"\n"+
+		`{"fr": "STOCKEL", "nl": "STOKKEL"};Suburb;N1;[{"id": "8042", "order": 1}]`+"\n"+
+		`{"fr": "STOCKEL"};City;5;not json`+"\n")
+
+	var r Report
+	n := Network{
+		Stops: readStops(stopsPath, &r),
+		Lines: readLines(linesPath, &r),
+	}
+	r.summarize(n, linesPath)
+
+	expectedErrors := []Problem{
+		{File: "stops.csv", Row: 3, Column: "gpscoordinates", Message: "invalid JSON: unexpected end of JSON input"},
+		{File: "stops.csv", Row: 4, Column: "id", Message: `invalid stop code "M-1" (must be alphanumeric)`},
+		{File: "stops.csv", Row: 5, Message: "incorrect number of columns: 2 instead of 3"},
+		{File: "lines.csv", Row: 4, Column: "points", Message: "invalid JSON: invalid character 'o' in literal null (expecting 'u')"},
+	}
+	if !reflect.DeepEqual(r.Errors, expectedErrors) {
+		t.Errorf("errors = %+v, want %+v", r.Errors, expectedErrors)
+	}
+
+	expectedWarnings := []Problem{
+		{File: "lines.csv", Message: "line 1 (direction 1): unknown stops 8032 fall back to the unknown stop"},
+	}
+	if !reflect.DeepEqual(r.Warnings, expectedWarnings) {
+		t.Errorf("warnings = %+v, want %+v", r.Warnings, expectedWarnings)
+	}
+
+	if r.Stops != 1 || r.Lines != 2 || r.UnknownStopFallbacks != 1 {
+		t.Errorf("summary = %d stops, %d lines, %d fallbacks, want 1, 2, 1", r.Stops, r.Lines, r.UnknownStopFallbacks)
+	}
+	if n.Lines[1].Code != "N1" {
+		t.Errorf("night line code = %q, want N1", n.Lines[1].Code)
+	}
+	if r.Err() == nil {
+		t.Errorf("Err() = nil, want the errors")
+	}
+}
+
+func TestValidateGTFS(t *testing.T) {
+	path := writeGTFS(t, map[string]string{
+		"stops.txt": "stop_id,stop_name,stop_lat,stop_lon\n" +
+			"8042,MERODE,50.8386,4.3986\n" +
+			"8032,SCHUMAN,north,4.3808\n",
+		"routes.txt": "route_id,route_short_name,route_type\n" +
+			"r1,1,1\n",
+		"trips.txt": "route_id,trip_id,direction_id\n" +
+			"r1,t1,0\n" +
+			"r1,t2,2\n",
+		"stop_times.txt": "trip_id,stop_id,stop_sequence\n" +
+			"t1,8042,1\n" +
+			"t1,8032,2\n" +
+			"t1,8022,first\n",
+	})
+
+	r := ValidateGTFS(path)
+
+	expectedErrors := []Problem{
+		{File: "stops.txt", Row: 3, Column: "stop_lat", Message: `invalid coordinate "north"`},
+		{File: "stop_times.txt", Row: 4, Column: "stop_sequence", Message: `invalid stop sequence "first"`},
+		{File: "trips.txt", Row: 3, Column: "direction_id", Message: `invalid direction "2" (must be 0 or 1)`},
+	}
+	if !reflect.DeepEqual(r.Errors, expectedErrors) {
+		t.Errorf("errors = %+v, want %+v", r.Errors, expectedErrors)
+	}
+	if r.UnknownStopFallbacks != 1 {
+		t.Errorf("UnknownStopFallbacks = %d, want 1", r.UnknownStopFallbacks)
+	}
+
+	if _, err := ReadGTFS(path); err == nil {
+		t.Errorf("ReadGTFS() expected an error for the invalid rows")
+	}
+}
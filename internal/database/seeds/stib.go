@@ -0,0 +1,38 @@
+package seeds
+
+// ReadSTIBCSV reads the STIB open data exports of internal/database/seeds/data into a Network.
+// The lines come with their stops from the stops by line export, and get their
+// mode and colors from the shapefiles and the hand-maintained text colors.
+//
+// It fails when any row is invalid, with every problem found.
+func ReadSTIBCSV() (Network, error) {
+	var r Report
+	n := readSTIBCSV(&r)
+	return n, r.Err()
+}
+
+// ValidateSTIBCSV reads the STIB open data exports like ReadSTIBCSV, and
+// reports what is wrong with them.
+func ValidateSTIBCSV() Report {
+	var r Report
+	n := readSTIBCSV(&r)
+	r.summarize(n, stopsByLineFilePath)
+	return r
+}
+
+func readSTIBCSV(r *Report) Network {
+	stops := readStops(stopDetailsFilePath, r)
+	lines := readLines(stopsByLineFilePath, r)
+	metadatas := readLinesMetadatas(shapeFilesPath, r)
+	textColors := readLinesTextColors(textColorsFilesPath, r)
+
+	for i, l := range lines {
+		if m, ok := metadatas[l.Code]; ok {
+			lines[i].Mode = m.Mode
+			lines[i].Color = m.Color
+		}
+		lines[i].TextColor = textColors[l.Code]
+	}
+
+	return Network{Stops: stops, Lines: lines}
+}
@@ -1,119 +1,76 @@
 package seeds
 
 import (
-	"context"
-	"database/sql"
 	"encoding/json"
-	"fmt"
-	"strconv"
 )
 
-const stopDetailsFilePath = "internal/database/seeds/data/stop-details-production.csv"
+const stopDetailsFilePath = DataDir + "/stop-details-production.csv"
 
-func SeedStops(ctx context.Context, db *sql.DB) error {
-	stopsResult, err := readCsvFile(stopDetailsFilePath)
+// readStops parses the stop details export: one stop per row with its
+// location and its name as JSON cells, and its code. Invalid rows are
+// reported and left out.
+//
+// Codes are kept verbatim: the platforms of a station, like "5710F" and
+// "5710G", are distinct stops for the real-time API.
+func readStops(path string, r *Report) []NetworkStop {
+	stopsResult, err := readCsvFile(path)
 	if err != nil {
-		return err
+		r.errorf(path, 0, "", "%v", err)
+		return nil
 	}
 
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-
-	stmt, err := tx.PrepareContext(ctx, `
-			INSERT INTO stops (code, geo, name)
-			VALUES (?, ?, ?)
-		`)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-	defer stmt.Close()
-
-	// Insert a fallback "unknown stop" as the first row in the stops table.
-	// This stop is used as a default reference in the stops_by_lines table
-	// when a stop cannot be resolved from the csv.
-	us, err := getUnknownStop()
-	if err != nil {
-		return fmt.Errorf("failed to generate the unknown stop: %v", err)
-	}
-
-	_, err = stmt.ExecContext(ctx, us.Code, us.Geo, us.Name)
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to insert unknown stop row: %v", err)
-	}
-
-	count := 0
+	var stops []NetworkStop
+	seen := make(map[string]bool)
 
+	var header []string
 	for i, row := range stopsResult {
 		if i == 0 {
+			header = row
 			continue // skip csv header
 		}
 
 		if len(row) != 3 {
-			return fmt.Errorf("row %d has incorrect number of columns: %v", i+1, row)
+			r.errorf(path, i+1, "", "incorrect number of columns: %d instead of 3", len(row))
+			continue
 		}
 		location := row[0]
 		code := row[1]
 		name := row[2]
+		valid := true
 
 		var l Location
 		if err := json.Unmarshal([]byte(location), &l); err != nil {
-			return fmt.Errorf("invalid JSON in 'location' at row %d: %v", i+1, err)
-		}
-
-		// TODO: migrate the db to make the column int64
-		codeInt, err := strconv.Atoi(removeTrailingLetter(code))
-		if err != nil {
-			return fmt.Errorf("invalid code at row %d: %s (must be valid integer)", i+1, code)
+			r.errorf(path, i+1, csvColumn(header, 0), "invalid JSON: %v", err)
+			valid = false
 		}
 
 		if !validString.MatchString(code) {
-			return fmt.Errorf("invalid stop ID at row %d: %q (must be alphanumeric)", i+1, code)
+			r.errorf(path, i+1, csvColumn(header, 1), "invalid stop code %q (must be alphanumeric)", code)
+			valid = false
 		}
 
 		var n i18nCell
 		if err := json.Unmarshal([]byte(name), &n); err != nil {
-			return fmt.Errorf("invalid JSON in 'name' at row %d: %v", i+1, err)
+			r.errorf(path, i+1, csvColumn(header, 2), "invalid JSON: %v", err)
+			valid = false
 		}
 
-		_, err = stmt.ExecContext(ctx, codeInt, location, name)
-		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to insert row %d: %v", i+1, err)
+		if !valid {
+			continue
 		}
 
-		count++
-
-		if count%batchSize == 0 {
-			if err := tx.Commit(); err != nil {
-				return err
-			}
-			fmt.Printf("'Stops' batch complete: #%d \n", count/batchSize)
-
-			tx, err = db.BeginTx(ctx, nil)
-			if err != nil {
-				return err
-			}
-
-			stmt, err = tx.PrepareContext(ctx, `INSERT INTO stops (code, geo, name) VALUES (?, ?, ?)`)
-			if err != nil {
-				tx.Rollback()
-				return err
-			}
-
-			defer stmt.Close()
+		if seen[code] {
+			r.warnf(path, i+1, csvColumn(header, 1), "duplicate stop code %q, the first row is kept", code)
+			continue
 		}
-	}
+		seen[code] = true
 
-	// Commit remaining rows if any
-	if count%batchSize != 0 {
-		if err := tx.Commit(); err != nil {
-			return err
-		}
+		stops = append(stops, NetworkStop{
+			Code:     code,
+			Name:     n,
+			Location: l,
+		})
 	}
 
-	return nil
+	return stops
 }
@@ -3,92 +3,60 @@ package seeds
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
-	"fmt"
-	"strconv"
-
-	"github.com/jp-roisin/catch-and-go/internal/database"
-	"github.com/jp-roisin/catch-and-go/internal/database/store"
+	"slices"
 )
 
-type lineStop struct {
-	Order int    `json:"order"`
-	Code  string `json:"id"`
-}
-
-func SeedStopsByLines(ctx context.Context, db *sql.DB, service database.Service) error {
-	linesResult, err := readCsvFile(stopsByLineFilePath)
+// syncLineStops replaces the ordered stops of a line when they changed, and
+// returns how many rows were added and removed. The order of a row is its
+// position in the list, starting at 1.
+func syncLineStops(ctx context.Context, tx *sql.Tx, lineID int64, stopIDs []int64) (added, removed int, err error) {
+	rows, err := tx.QueryContext(ctx, `SELECT stop_id FROM stops_by_lines WHERE line_id = ? ORDER BY "order"`, lineID)
 	if err != nil {
-		return err
+		return 0, 0, err
+	}
+	var current []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		current = append(current, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
 	}
 
-	for i, row := range linesResult {
-		if i == 0 {
-			continue // skip csv header
-		}
-		if len(row) != 4 {
-			return fmt.Errorf("row %d has incorrect number of columns: %v", i+1, row)
-		}
-
-		tx, err := db.BeginTx(ctx, nil)
-		if err != nil {
-			return err
-		}
-
-		stmt, err := tx.PrepareContext(ctx, `INSERT INTO stops_by_lines (stop_id, line_id, "order") VALUES (?, ?, ?)`)
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
-		defer stmt.Close()
-
-		direction := row[1]
-		code := row[2]      // lineCode
-		lineStops := row[3] // stopCode
-
-		// Filtering out lineIds (like "N12" which is the Noctis / night shift for the line)
-		// that have not been inserted in `lines`
-		codeInt, err := strconv.Atoi(removeTrailingLetter(code))
-		if err != nil {
-			continue
-		}
-
-		var ls []lineStop
-		if err := json.Unmarshal([]byte(lineStops), &ls); err != nil {
-			return fmt.Errorf("invalid JSON in 'line_stops' at row %d: %v", i+1, err)
-		}
-
-		line, err := service.GetLine(ctx, store.GetLineParams{
-			Code:      strconv.FormatInt(int64(codeInt), 10),
-			Direction: int64(directionToBoolean(direction)),
-		})
-		if err != nil {
-			return fmt.Errorf("Line ID: %s was not found in lines at row %d: %v", code, i+1, err)
-		}
-
-		for _, st := range ls {
-			var stop store.Stop
-			sanitazedStopId, err := strconv.Atoi(removeTrailingLetter(st.Code))
-			if err != nil {
-				stop.ID = 1 // Fallback to the first row inserted in `stops` (see getUnknownStop())
-			}
-			stop, err = service.GetStop(ctx, strconv.FormatInt(int64(sanitazedStopId), 10))
-			if err != nil {
-				stop.ID = 1 // Fallback to the first row inserted in `stops` (see getUnknownStop())
-			}
+	if slices.Equal(current, stopIDs) {
+		return 0, 0, nil
+	}
 
-			_, err = stmt.ExecContext(ctx, stop.ID, line.ID, st.Order)
-			if err != nil {
-				tx.Rollback()
-				return fmt.Errorf("failed to insert row %d: %v", i+1, err)
-			}
+	// Reordering a line rewrites its rows, but only counts the stops that
+	// joined or left it.
+	counts := make(map[int64]int, len(current))
+	for _, id := range current {
+		counts[id]++
+	}
+	for _, id := range stopIDs {
+		if counts[id] > 0 {
+			counts[id]--
+		} else {
+			added++
 		}
+	}
+	for _, c := range counts {
+		removed += c
+	}
 
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("failed to commit: %v", err)
+	if _, err := tx.ExecContext(ctx, `DELETE FROM stops_by_lines WHERE line_id = ?`, lineID); err != nil {
+		return 0, 0, err
+	}
+	for i, id := range stopIDs {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO stops_by_lines (stop_id, line_id, "order") VALUES (?, ?, ?)`, id, lineID, i+1); err != nil {
+			return 0, 0, err
 		}
-
 	}
 
-	return nil
+	return added, removed, nil
 }
@@ -2,12 +2,10 @@ package seeds
 
 import (
 	"encoding/csv"
-	"encoding/json"
-	"fmt"
 	"os"
 	"regexp"
-	"unicode"
 
+	"github.com/jp-roisin/catch-and-go/internal/database"
 	"github.com/jp-roisin/catch-and-go/internal/database/store"
 )
 
@@ -22,9 +20,8 @@ type Location struct {
 }
 
 var validString = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
-var validInteger = regexp.MustCompile(`^\d+$`)
 var validHexColor = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}){1,2}$`)
-var validLineIdWithMode = regexp.MustCompile(`^(\d+)([a-zA-Z])$`)
+var validLineIdWithMode = regexp.MustCompile(`^([a-zA-Z]?\d+)([a-zA-Z])$`)
 
 const batchSize = 100
 
@@ -44,10 +41,11 @@ func readCsvFile(filePath string) ([][]string, error) {
 	csvReader := csv.NewReader(f)
 	csvReader.Comma = ';'
 	csvReader.LazyQuotes = true
+	// The number of columns is checked row by row by the readers
+	csvReader.FieldsPerRecord = -1
 
 	records, err := csvReader.ReadAll()
 	if err != nil {
-		fmt.Println(err)
 		return nil, err
 	}
 
@@ -67,41 +65,12 @@ func directionToBoolean(direction string) int {
 // Returns a fallback Stop struct representing an "unknown stop" location.
 // The coordinates are set to the Brussels Grand Place as a neutral central location.
 // The stop name is localized in French and Dutch with a clear "not found" label.
-func getUnknownStop() (store.Stop, error) {
-	bxl, err := json.Marshal(Location{
-		Latitude:  50.8468, // Brussels Grand Place latitude
-		Longitude: 4.3524,  // Brussels Grand Place longitude
-	})
-	if err != nil {
-		return store.Stop{}, err
-	}
-
-	unknownName, err := json.Marshal(i18nCell{
-		Fr: "ARRÊT NON TROUVÉ",
-		Nl: "STOP NIET GEVONDEN",
-	})
-	if err != nil {
-		return store.Stop{}, err
-	}
-
+func getUnknownStop() store.Stop {
 	return store.Stop{
-		Code: "0001",
-		Geo:  string(bxl),
-		Name: string(unknownName),
-	}, nil
-}
-
-// removeTrailingLetter removes the last character from the input string
-// if it is a Unicode letter. Otherwise, it returns the string unchanged.
-func removeTrailingLetter(code string) string {
-	if len(code) == 0 {
-		return code
+		Code:   database.UnknownStopCode,
+		Lat:    50.8468, // Brussels Grand Place latitude
+		Lon:    4.3524,  // Brussels Grand Place longitude
+		NameFr: "ARRÊT NON TROUVÉ",
+		NameNl: "STOP NIET GEVONDEN",
 	}
-
-	lastRune := rune(code[len(code)-1])
-	if unicode.IsLetter(lastRune) {
-		return code[:len(code)-1]
-	}
-	return code
 }
-
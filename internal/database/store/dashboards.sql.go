@@ -13,26 +13,30 @@ import (
 const createdashboard = `-- name: Createdashboard :one
 INSERT INTO dashboards (
     session_id,
-    stop_id
+    stop_id,
+    follow_station
 ) VALUES (
-    ?, ?
+    ?, ?, ?
 )
-RETURNING id, session_id, stop_id, created_at
+RETURNING id, session_id, stop_id, created_at, stop_removed_at, follow_station
 `
 
 type CreatedashboardParams struct {
-	SessionID string
-	StopID    int64
+	SessionID     string
+	StopID        int64
+	FollowStation bool
 }
 
 func (q *Queries) Createdashboard(ctx context.Context, arg CreatedashboardParams) (Dashboard, error) {
-	row := q.db.QueryRowContext(ctx, createdashboard, arg.SessionID, arg.StopID)
+	row := q.db.QueryRowContext(ctx, createdashboard, arg.SessionID, arg.StopID, arg.FollowStation)
 	var i Dashboard
 	err := row.Scan(
 		&i.ID,
 		&i.SessionID,
 		&i.StopID,
 		&i.CreatedAt,
+		&i.StopRemovedAt,
+		&i.FollowStation,
 	)
 	return i, err
 }
@@ -53,7 +57,7 @@ func (q *Queries) DeleteDashboard(ctx context.Context, arg DeleteDashboardParams
 }
 
 const getDashboardById = `-- name: GetDashboardById :one
-SELECT id, session_id, stop_id, created_at FROM dashboards
+SELECT id, session_id, stop_id, created_at, stop_removed_at, follow_station FROM dashboards
 WHERE id = ? AND session_id = ?
 `
 
@@ -70,6 +74,8 @@ func (q *Queries) GetDashboardById(ctx context.Context, arg GetDashboardByIdPara
 		&i.SessionID,
 		&i.StopID,
 		&i.CreatedAt,
+		&i.StopRemovedAt,
+		&i.FollowStation,
 	)
 	return i, err
 }
@@ -82,9 +88,14 @@ SELECT
   d.created_at AS dashboard_created_at,
   s.id AS stop_id,
   s.code AS stop_code,
-  s.geo AS stop_geo,
-  s.name AS stop_name,
-  s.created_at AS stop_created_at
+  s.lat AS stop_lat,
+  s.lon AS stop_lon,
+  s.name_fr AS stop_name_fr,
+  s.name_nl AS stop_name_nl,
+  s.created_at AS stop_created_at,
+  d.stop_removed_at,
+  s.station_id AS stop_station_id,
+  d.follow_station
 FROM dashboards d
 JOIN stops s ON s.id = d.stop_id
 WHERE d.id = ? AND d.session_id = ?
@@ -102,9 +113,14 @@ type GetDashboardByIdWithStopInfoRow struct {
 	DashboardCreatedAt sql.NullTime
 	StopID_2           int64
 	StopCode           string
-	StopGeo            string
-	StopName           string
+	StopLat            float64
+	StopLon            float64
+	StopNameFr         string
+	StopNameNl         string
 	StopCreatedAt      sql.NullTime
+	StopRemovedAt      sql.NullTime
+	StopStationID      sql.NullInt64
+	FollowStation      bool
 }
 
 func (q *Queries) GetDashboardByIdWithStopInfo(ctx context.Context, arg GetDashboardByIdWithStopInfoParams) (GetDashboardByIdWithStopInfoRow, error) {
@@ -117,9 +133,14 @@ func (q *Queries) GetDashboardByIdWithStopInfo(ctx context.Context, arg GetDashb
 		&i.DashboardCreatedAt,
 		&i.StopID_2,
 		&i.StopCode,
-		&i.StopGeo,
-		&i.StopName,
+		&i.StopLat,
+		&i.StopLon,
+		&i.StopNameFr,
+		&i.StopNameNl,
 		&i.StopCreatedAt,
+		&i.StopRemovedAt,
+		&i.StopStationID,
+		&i.FollowStation,
 	)
 	return i, err
 }
@@ -132,9 +153,13 @@ SELECT
   d.created_at AS dashboard_created_at,
   s.id AS stop_id,
   s.code AS stop_code,
-  s.geo AS stop_geo,
-  s.name AS stop_name,
-  s.created_at AS stop_created_at
+  s.lat AS stop_lat,
+  s.lon AS stop_lon,
+  s.name_fr AS stop_name_fr,
+  s.name_nl AS stop_name_nl,
+  s.created_at AS stop_created_at,
+  s.station_id AS stop_station_id,
+  d.follow_station
 FROM dashboards d
 JOIN stops s ON s.id = d.stop_id
 WHERE d.session_id = ?
@@ -148,9 +173,13 @@ type ListDashboardsFromSessionRow struct {
 	DashboardCreatedAt sql.NullTime
 	StopID_2           int64
 	StopCode           string
-	StopGeo            string
-	StopName           string
+	StopLat            float64
+	StopLon            float64
+	StopNameFr         string
+	StopNameNl         string
 	StopCreatedAt      sql.NullTime
+	StopStationID      sql.NullInt64
+	FollowStation      bool
 }
 
 func (q *Queries) ListDashboardsFromSession(ctx context.Context, sessionID string) ([]ListDashboardsFromSessionRow, error) {
@@ -169,9 +198,13 @@ func (q *Queries) ListDashboardsFromSession(ctx context.Context, sessionID strin
 			&i.DashboardCreatedAt,
 			&i.StopID_2,
 			&i.StopCode,
-			&i.StopGeo,
-			&i.StopName,
+			&i.StopLat,
+			&i.StopLon,
+			&i.StopNameFr,
+			&i.StopNameNl,
 			&i.StopCreatedAt,
+			&i.StopStationID,
+			&i.FollowStation,
 		); err != nil {
 			return nil, err
 		}
@@ -185,3 +218,37 @@ func (q *Queries) ListDashboardsFromSession(ctx context.Context, sessionID strin
 	}
 	return items, nil
 }
+
+const listWatchedStopCodes = `-- name: ListWatchedStopCodes :many
+SELECT s.code
+FROM dashboards d
+JOIN stops ds ON ds.id = d.stop_id
+JOIN stops s ON s.id = ds.id OR (d.follow_station AND s.station_id = ds.station_id)
+JOIN sessions se ON se.id = d.session_id
+WHERE se.last_seen_at >= ? AND d.stop_removed_at IS NULL
+GROUP BY s.code
+ORDER BY MAX(se.last_seen_at) DESC
+`
+
+func (q *Queries) ListWatchedStopCodes(ctx context.Context, lastSeenAt sql.NullTime) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listWatchedStopCodes, lastSeenAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		items = append(items, code)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
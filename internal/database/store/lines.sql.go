@@ -10,7 +10,7 @@ import (
 )
 
 const getLine = `-- name: GetLine :one
-SELECT id, code, destination, direction, created_at, mode, color, text_color FROM lines
+SELECT id, code, direction, created_at, mode, color, text_color, destination_fr, destination_nl FROM lines
 WHERE code = ? AND direction = ? LIMIT 1
 `
 
@@ -25,18 +25,41 @@ func (q *Queries) GetLine(ctx context.Context, arg GetLineParams) (Line, error)
 	err := row.Scan(
 		&i.ID,
 		&i.Code,
-		&i.Destination,
 		&i.Direction,
 		&i.CreatedAt,
 		&i.Mode,
 		&i.Color,
 		&i.TextColor,
+		&i.DestinationFr,
+		&i.DestinationNl,
+	)
+	return i, err
+}
+
+const getLineById = `-- name: GetLineById :one
+SELECT id, code, direction, created_at, mode, color, text_color, destination_fr, destination_nl FROM lines
+WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetLineById(ctx context.Context, id int64) (Line, error) {
+	row := q.db.QueryRowContext(ctx, getLineById, id)
+	var i Line
+	err := row.Scan(
+		&i.ID,
+		&i.Code,
+		&i.Direction,
+		&i.CreatedAt,
+		&i.Mode,
+		&i.Color,
+		&i.TextColor,
+		&i.DestinationFr,
+		&i.DestinationNl,
 	)
 	return i, err
 }
 
 const listLines = `-- name: ListLines :many
-SELECT id, code, destination, direction, created_at, mode, color, text_color FROM lines
+SELECT id, code, direction, created_at, mode, color, text_color, destination_fr, destination_nl FROM lines
 ORDER BY code ASC
 `
 
@@ -52,12 +75,13 @@ func (q *Queries) ListLines(ctx context.Context) ([]Line, error) {
 		if err := rows.Scan(
 			&i.ID,
 			&i.Code,
-			&i.Destination,
 			&i.Direction,
 			&i.CreatedAt,
 			&i.Mode,
 			&i.Color,
 			&i.TextColor,
+			&i.DestinationFr,
+			&i.DestinationNl,
 		); err != nil {
 			return nil, err
 		}
@@ -73,7 +97,7 @@ func (q *Queries) ListLines(ctx context.Context) ([]Line, error) {
 }
 
 const listLinesByCode = `-- name: ListLinesByCode :many
-SELECT id, code, destination, direction, created_at, mode, color, text_color FROM lines
+SELECT id, code, direction, created_at, mode, color, text_color, destination_fr, destination_nl FROM lines
 WHERE CODE = ?
 `
 
@@ -89,12 +113,13 @@ func (q *Queries) ListLinesByCode(ctx context.Context, code string) ([]Line, err
 		if err := rows.Scan(
 			&i.ID,
 			&i.Code,
-			&i.Destination,
 			&i.Direction,
 			&i.CreatedAt,
 			&i.Mode,
 			&i.Color,
 			&i.TextColor,
+			&i.DestinationFr,
+			&i.DestinationNl,
 		); err != nil {
 			return nil, err
 		}
@@ -110,7 +135,7 @@ func (q *Queries) ListLinesByCode(ctx context.Context, code string) ([]Line, err
 }
 
 const listLinesByDirection = `-- name: ListLinesByDirection :many
-SELECT id, code, destination, direction, created_at, mode, color, text_color FROM lines
+SELECT id, code, direction, created_at, mode, color, text_color, destination_fr, destination_nl FROM lines
 WHERE direction = ?
 ORDER BY code ASC
 `
@@ -127,12 +152,13 @@ func (q *Queries) ListLinesByDirection(ctx context.Context, direction int64) ([]
 		if err := rows.Scan(
 			&i.ID,
 			&i.Code,
-			&i.Destination,
 			&i.Direction,
 			&i.CreatedAt,
 			&i.Mode,
 			&i.Color,
 			&i.TextColor,
+			&i.DestinationFr,
+			&i.DestinationNl,
 		); err != nil {
 			return nil, err
 		}
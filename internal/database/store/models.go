@@ -9,10 +9,12 @@ import (
 )
 
 type Dashboard struct {
-	ID        int64
-	SessionID string
-	StopID    int64
-	CreatedAt sql.NullTime
+	ID            int64
+	SessionID     string
+	StopID        int64
+	CreatedAt     sql.NullTime
+	StopRemovedAt sql.NullTime
+	FollowStation bool
 }
 
 type GooseDbVersion struct {
@@ -23,21 +25,23 @@ type GooseDbVersion struct {
 }
 
 type Line struct {
-	ID          int64
-	Code        string
-	Destination string
-	Direction   int64
-	CreatedAt   sql.NullTime
-	Mode        sql.NullString
-	Color       sql.NullString
-	TextColor   string
+	ID            int64
+	Code          string
+	Direction     int64
+	CreatedAt     sql.NullTime
+	Mode          sql.NullString
+	Color         sql.NullString
+	TextColor     string
+	DestinationFr string
+	DestinationNl string
 }
 
 type Session struct {
-	ID        string
-	CreatedAt sql.NullTime
-	Locale    string
-	Theme     string
+	ID         string
+	CreatedAt  sql.NullTime
+	Locale     string
+	Theme      string
+	LastSeenAt sql.NullTime
 }
 
 type SqliteSequence struct {
@@ -45,12 +49,24 @@ type SqliteSequence struct {
 	Seq  interface{}
 }
 
+type Station struct {
+	ID        int64
+	Name      string
+	Geo       string
+	CreatedAt sql.NullTime
+	Key       string
+}
+
 type Stop struct {
 	ID        int64
 	Code      string
-	Geo       string
-	Name      string
 	CreatedAt sql.NullTime
+	StationID sql.NullInt64
+	Lat       float64
+	Lon       float64
+	NameFr    string
+	NameNl    string
+	RemovedAt sql.NullTime
 }
 
 type StopsByLine struct {
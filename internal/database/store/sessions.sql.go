@@ -7,6 +7,7 @@ package store
 
 import (
 	"context"
+	"database/sql"
 )
 
 const createSession = `-- name: CreateSession :one
@@ -15,7 +16,7 @@ INSERT INTO sessions (
 ) VALUES (
     ?
 )
-RETURNING id, created_at, locale, theme
+RETURNING id, created_at, locale, theme, last_seen_at
 `
 
 func (q *Queries) CreateSession(ctx context.Context, id string) (Session, error) {
@@ -26,6 +27,7 @@ func (q *Queries) CreateSession(ctx context.Context, id string) (Session, error)
 		&i.CreatedAt,
 		&i.Locale,
 		&i.Theme,
+		&i.LastSeenAt,
 	)
 	return i, err
 }
@@ -41,7 +43,7 @@ func (q *Queries) DeleteSession(ctx context.Context, id string) error {
 }
 
 const getSession = `-- name: GetSession :one
-SELECT id, created_at, locale, theme FROM sessions
+SELECT id, created_at, locale, theme, last_seen_at FROM sessions
 WHERE id = ? LIMIT 1
 `
 
@@ -53,12 +55,13 @@ func (q *Queries) GetSession(ctx context.Context, id string) (Session, error) {
 		&i.CreatedAt,
 		&i.Locale,
 		&i.Theme,
+		&i.LastSeenAt,
 	)
 	return i, err
 }
 
 const listSessions = `-- name: ListSessions :many
-SELECT id, created_at, locale, theme FROM sessions
+SELECT id, created_at, locale, theme, last_seen_at FROM sessions
 ORDER BY created_at DESC
 `
 
@@ -76,6 +79,7 @@ func (q *Queries) ListSessions(ctx context.Context) ([]Session, error) {
 			&i.CreatedAt,
 			&i.Locale,
 			&i.Theme,
+			&i.LastSeenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -90,6 +94,22 @@ func (q *Queries) ListSessions(ctx context.Context) ([]Session, error) {
 	return items, nil
 }
 
+const touchSession = `-- name: TouchSession :exec
+UPDATE sessions
+set last_seen_at = ?
+WHERE id = ?
+`
+
+type TouchSessionParams struct {
+	LastSeenAt sql.NullTime
+	ID         string
+}
+
+func (q *Queries) TouchSession(ctx context.Context, arg TouchSessionParams) error {
+	_, err := q.db.ExecContext(ctx, touchSession, arg.LastSeenAt, arg.ID)
+	return err
+}
+
 const updateLocale = `-- name: UpdateLocale :exec
 UPDATE sessions
 set locale = ?
@@ -7,10 +7,11 @@ package store
 
 import (
 	"context"
+	"database/sql"
 )
 
 const getStop = `-- name: GetStop :one
-SELECT id, code, geo, name, created_at FROM stops
+SELECT id, code, created_at, station_id, lat, lon, name_fr, name_nl, removed_at FROM stops
 WHERE code = ? LIMIT 1
 `
 
@@ -20,18 +21,75 @@ func (q *Queries) GetStop(ctx context.Context, code string) (Stop, error) {
 	err := row.Scan(
 		&i.ID,
 		&i.Code,
-		&i.Geo,
-		&i.Name,
 		&i.CreatedAt,
+		&i.StationID,
+		&i.Lat,
+		&i.Lon,
+		&i.NameFr,
+		&i.NameNl,
+		&i.RemovedAt,
 	)
 	return i, err
 }
 
+const getStopById = `-- name: GetStopById :one
+SELECT id, code, created_at, station_id, lat, lon, name_fr, name_nl, removed_at FROM stops
+WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetStopById(ctx context.Context, id int64) (Stop, error) {
+	row := q.db.QueryRowContext(ctx, getStopById, id)
+	var i Stop
+	err := row.Scan(
+		&i.ID,
+		&i.Code,
+		&i.CreatedAt,
+		&i.StationID,
+		&i.Lat,
+		&i.Lon,
+		&i.NameFr,
+		&i.NameNl,
+		&i.RemovedAt,
+	)
+	return i, err
+}
+
+const listStopCodesFromStation = `-- name: ListStopCodesFromStation :many
+SELECT code FROM stops
+WHERE station_id = ?
+ORDER BY code ASC
+`
+
+func (q *Queries) ListStopCodesFromStation(ctx context.Context, stationID sql.NullInt64) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listStopCodesFromStation, stationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		items = append(items, code)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listStops = `-- name: ListStops :many
-SELECT id, code, geo, name, created_at FROM stops
+SELECT id, code, created_at, station_id, lat, lon, name_fr, name_nl, removed_at FROM stops
+WHERE removed_at IS NULL
 ORDER BY code ASC
 `
 
+// The stops that left the network are only kept for their dashboards.
 func (q *Queries) ListStops(ctx context.Context) ([]Stop, error) {
 	rows, err := q.db.QueryContext(ctx, listStops)
 	if err != nil {
@@ -44,9 +102,116 @@ func (q *Queries) ListStops(ctx context.Context) ([]Stop, error) {
 		if err := rows.Scan(
 			&i.ID,
 			&i.Code,
-			&i.Geo,
-			&i.Name,
 			&i.CreatedAt,
+			&i.StationID,
+			&i.Lat,
+			&i.Lon,
+			&i.NameFr,
+			&i.NameNl,
+			&i.RemovedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchStops = `-- name: SearchStops :many
+SELECT stops.id, stops.code, stops.created_at, stops.station_id, stops.lat, stops.lon, stops.name_fr, stops.name_nl, stops.removed_at FROM stops
+JOIN stops_search ON stops_search.rowid = stops.id
+WHERE stops_search MATCH ?1 AND stops.code <> ?2 AND stops.removed_at IS NULL
+ORDER BY stops.code ASC
+LIMIT ?3
+`
+
+type SearchStopsParams struct {
+	Query           string
+	UnknownStopCode string
+	Limit           int64
+}
+
+// The unknown stop is the placeholder the seeds map unknown stops to.
+func (q *Queries) SearchStops(ctx context.Context, arg SearchStopsParams) ([]Stop, error) {
+	rows, err := q.db.QueryContext(ctx, searchStops, arg.Query, arg.UnknownStopCode, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Stop
+	for rows.Next() {
+		var i Stop
+		if err := rows.Scan(
+			&i.ID,
+			&i.Code,
+			&i.CreatedAt,
+			&i.StationID,
+			&i.Lat,
+			&i.Lon,
+			&i.NameFr,
+			&i.NameNl,
+			&i.RemovedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStopsInBox = `-- name: ListStopsInBox :many
+SELECT stops.id, stops.code, stops.created_at, stops.station_id, stops.lat, stops.lon, stops.name_fr, stops.name_nl, stops.removed_at FROM stops
+JOIN stops_rtree r ON r.id = stops.id
+WHERE r.min_lat >= ?1 AND r.max_lat <= ?2
+  AND r.min_lon >= ?3 AND r.max_lon <= ?4
+  AND stops.code <> ?5 AND stops.removed_at IS NULL
+`
+
+type ListStopsInBoxParams struct {
+	MinLatitude     float64
+	MaxLatitude     float64
+	MinLongitude    float64
+	MaxLongitude    float64
+	UnknownStopCode string
+}
+
+func (q *Queries) ListStopsInBox(ctx context.Context, arg ListStopsInBoxParams) ([]Stop, error) {
+	rows, err := q.db.QueryContext(ctx, listStopsInBox,
+		arg.MinLatitude,
+		arg.MaxLatitude,
+		arg.MinLongitude,
+		arg.MaxLongitude,
+		arg.UnknownStopCode,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Stop
+	for rows.Next() {
+		var i Stop
+		if err := rows.Scan(
+			&i.ID,
+			&i.Code,
+			&i.CreatedAt,
+			&i.StationID,
+			&i.Lat,
+			&i.Lon,
+			&i.NameFr,
+			&i.NameNl,
+			&i.RemovedAt,
 		); err != nil {
 			return nil, err
 		}
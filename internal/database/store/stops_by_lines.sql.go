@@ -9,8 +9,39 @@ import (
 	"context"
 )
 
+const listLineCodesFromStop = `-- name: ListLineCodesFromStop :many
+SELECT DISTINCT l.code
+FROM stops_by_lines sbl
+JOIN lines l ON l.id = sbl.line_id
+WHERE sbl.stop_id = ?
+ORDER BY l.code ASC
+`
+
+func (q *Queries) ListLineCodesFromStop(ctx context.Context, stopID int64) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listLineCodesFromStop, stopID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		items = append(items, code)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listStopsFromLine = `-- name: ListStopsFromLine :many
-SELECT s.id, s.code, s.geo, s.name, s.created_at
+SELECT s.id, s.code, s.created_at, s.station_id, s.lat, s.lon, s.name_fr, s.name_nl, s.removed_at
 FROM stops_by_lines sbl
 JOIN stops s ON s.id = sbl.stop_id
 WHERE sbl.line_id = ?
@@ -29,9 +60,13 @@ func (q *Queries) ListStopsFromLine(ctx context.Context, lineID int64) ([]Stop,
 		if err := rows.Scan(
 			&i.ID,
 			&i.Code,
-			&i.Geo,
-			&i.Name,
 			&i.CreatedAt,
+			&i.StationID,
+			&i.Lat,
+			&i.Lon,
+			&i.NameFr,
+			&i.NameNl,
+			&i.RemovedAt,
 		); err != nil {
 			return nil, err
 		}
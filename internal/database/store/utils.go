@@ -1,8 +1,8 @@
 package store
 
 import (
-	"encoding/json"
-	"fmt"
+	"strconv"
+	"strings"
 )
 
 const fallbackMode = "bus"
@@ -16,13 +16,12 @@ const (
 )
 
 type LineWithFallback struct {
-	ID          int
-	Code        string
-	Destination string
-	Direction   int
-	Mode        string
-	Color       string
-	TextColor   string
+	ID        int
+	Code      string
+	Direction int
+	Mode      string
+	Color     string
+	TextColor string
 }
 
 func (l *Line) AddFallback() LineWithFallback {
@@ -41,100 +40,94 @@ func (l *Line) AddFallback() LineWithFallback {
 	}
 
 	return LineWithFallback{
-		ID:          int(l.ID),
-		Code:        l.Code,
-		Destination: l.Destination,
-		Direction:   int(l.Direction),
-		Mode:        mode,
-		Color:       color,
-		TextColor:   l.TextColor,
+		ID:        int(l.ID),
+		Code:      l.Code,
+		Direction: int(l.Direction),
+		Mode:      mode,
+		Color:     color,
+		TextColor: l.TextColor,
 	}
 }
 
-type i18n struct {
-	Fr string `json:"fr"`
-	Nl string `json:"nl"`
+// NormalizeLineCode returns a line code as stored in the lines table. The
+// sources pad numeric codes differently ("012" in the shapefiles, "12" in the
+// stops by line export), while lettered ones like "N04" or "T92" are kept as is.
+func NormalizeLineCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if n, err := strconv.Atoi(code); err == nil && n >= 0 {
+		return strconv.Itoa(n)
+	}
+	return code
 }
 
-func (s *Stop) Translate(locale string) (Stop, error) {
-	if locale != "fr" && locale != "nl" {
-		return Stop{}, fmt.Errorf("%s is not a valid locale", locale)
-	}
-	var obj i18n
-	if err := json.Unmarshal([]byte(s.Name), &obj); err != nil {
-		return Stop{}, err
+// IsNightLine tells whether a line belongs to the Noctis night network,
+// whose codes are an "N" followed by digits.
+func IsNightLine(code string) bool {
+	prefix, number, rest := splitLineCode(code)
+	return prefix == "N" && number != "" && rest == ""
+}
+
+// CompareLineCodes orders the line codes naturally: the numeric codes first in
+// numeric order, then the lettered ones by prefix and number ("1", "2", "11",
+// "N04", "N12", "T92").
+func CompareLineCodes(a, b string) int {
+	ap, an, ar := splitLineCode(a)
+	bp, bn, br := splitLineCode(b)
+
+	if ap != bp {
+		// No prefix sorts first
+		return strings.Compare(ap, bp)
 	}
 
-	var translatedName string
-	switch locale {
-	case "fr":
-		translatedName = obj.Fr
-	case "nl":
-		translatedName = obj.Nl
+	ai, aErr := strconv.Atoi(an)
+	bi, bErr := strconv.Atoi(bn)
+	switch {
+	case aErr == nil && bErr == nil && ai != bi:
+		return ai - bi
+	case aErr == nil && bErr != nil:
+		return -1
+	case aErr != nil && bErr == nil:
+		return 1
 	}
 
-	return Stop{
-		ID:        s.ID,
-		Code:      s.Code,
-		Geo:       s.Geo,
-		Name:      translatedName,
-		CreatedAt: s.CreatedAt,
-	}, nil
+	if ar != br {
+		return strings.Compare(ar, br)
+	}
+	return strings.Compare(a, b)
 }
 
-func (d *ListDashboardsFromSessionRow) Translate(locale string) (ListDashboardsFromSessionRow, error) {
-	if locale != "fr" && locale != "nl" {
-		return ListDashboardsFromSessionRow{}, fmt.Errorf("%s is not a valid locale", locale)
+// splitLineCode splits a code into its letter prefix, its number and what follows.
+func splitLineCode(code string) (prefix, number, rest string) {
+	i := 0
+	for i < len(code) && (code[i] < '0' || code[i] > '9') {
+		i++
 	}
-	var obj i18n
-	if err := json.Unmarshal([]byte(d.StopName), &obj); err != nil {
-		return ListDashboardsFromSessionRow{}, err
+	j := i
+	for j < len(code) && code[j] >= '0' && code[j] <= '9' {
+		j++
 	}
+	return code[:i], code[i:j], code[j:]
+}
 
-	var translatedName string
-	switch locale {
-	case "fr":
-		translatedName = obj.Fr
-	case "nl":
-		translatedName = obj.Nl
+// The texts are stored in French and in Dutch, French being the default locale.
+func localized(locale, fr, nl string) string {
+	if locale == "nl" {
+		return nl
 	}
-
-	return ListDashboardsFromSessionRow{
-		DashboardID:        d.DashboardID,
-		SessionID:          d.SessionID,
-		StopID:             d.StopID,
-		DashboardCreatedAt: d.DashboardCreatedAt,
-		StopID_2:           d.StopID_2,
-		StopCode:           d.StopCode,
-		StopGeo:            d.StopGeo,
-		StopName:           translatedName,
-		StopCreatedAt:      d.StopCreatedAt,
-	}, nil
+	return fr
 }
 
-func (l *Line) Translate(locale string) (Line, error) {
-	var line Line
-	if locale != "fr" && locale != "nl" {
-		return line, fmt.Errorf("%s is not a valid locale", locale)
-	}
-	var obj i18n
-	if err := json.Unmarshal([]byte(l.Destination), &obj); err != nil {
-		return line, err
-	}
+// Name returns the name of the stop in the locale of a session.
+func (s *Stop) Name(locale string) string {
+	return localized(locale, s.NameFr, s.NameNl)
+}
 
-	var translatedDestination string
-	switch locale {
-	case "fr":
-		translatedDestination = obj.Fr
-	case "nl":
-		translatedDestination = obj.Nl
-	}
+// StopName returns the name of the stop of the dashboard in the locale of a session.
+func (d *ListDashboardsFromSessionRow) StopName(locale string) string {
+	return localized(locale, d.StopNameFr, d.StopNameNl)
+}
 
-	return Line{
-		ID:          l.ID,
-		Code:        l.Code,
-		Direction:   l.Direction,
-		Destination: translatedDestination,
-		CreatedAt:   l.CreatedAt,
-	}, nil
+// Destination returns the destination of the line in the locale of a session.
+func (l *Line) Destination(locale string) string {
+	return localized(locale, l.DestinationFr, l.DestinationNl)
 }
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestCompareLineCodes(t *testing.T) {
+	codes := []string{"T92", "N12", "11", "N04", "2", "92", "1", "N4A"}
+	slices.SortFunc(codes, CompareLineCodes)
+
+	expected := []string{"1", "2", "11", "92", "N04", "N4A", "N12", "T92"}
+	if !reflect.DeepEqual(codes, expected) {
+		t.Errorf("sorted codes = %v, want %v", codes, expected)
+	}
+}
+
+func TestNormalizeLineCode(t *testing.T) {
+	tests := map[string]string{
+		"012":  "12",
+		"12":   "12",
+		" n04": "N04",
+		"T92":  "T92",
+	}
+	for code, expected := range tests {
+		if got := NormalizeLineCode(code); got != expected {
+			t.Errorf("NormalizeLineCode(%q) = %q, want %q", code, got, expected)
+		}
+	}
+}
+
+func TestIsNightLine(t *testing.T) {
+	for code, expected := range map[string]bool{"N04": true, "N12": true, "12": false, "T92": false, "N": false} {
+		if got := IsNightLine(code); got != expected {
+			t.Errorf("IsNightLine(%q) = %v, want %v", code, got, expected)
+		}
+	}
+}
+
+func TestLocalizedColumns(t *testing.T) {
+	stop := Stop{NameFr: "GARE DE L'OUEST", NameNl: "WESTSTATION"}
+	line := Line{DestinationFr: "STOCKEL", DestinationNl: "STOKKEL"}
+
+	for locale, expected := range map[string][2]string{
+		"fr": {"GARE DE L'OUEST", "STOCKEL"},
+		"nl": {"WESTSTATION", "STOKKEL"},
+		// French is the default
+		"en": {"GARE DE L'OUEST", "STOCKEL"},
+	} {
+		if got := stop.Name(locale); got != expected[0] {
+			t.Errorf("Stop.Name(%q) = %q, want %q", locale, got, expected[0])
+		}
+		if got := line.Destination(locale); got != expected[1] {
+			t.Errorf("Line.Destination(%q) = %q, want %q", locale, got, expected[1])
+		}
+	}
+}
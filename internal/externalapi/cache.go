@@ -1,36 +1,206 @@
 package externalapi
 
 import (
+	"container/list"
 	"sync"
 	"time"
 )
 
-const cacheTTL time.Duration = 1 * time.Minute
+// By default entries are fresh for a minute. After that, and up to 15 minutes after
+// they were fetched, they are still served (flagged as stale) while a refresh happens
+// in the background, or when upstream is down.
+const (
+	defaultCacheTTL        = 1 * time.Minute
+	defaultCacheMaxStale   = 15 * time.Minute
+	defaultCacheMaxEntries = 5000 // a few times the number of stops of the network
+	defaultJanitorInterval = 5 * time.Minute
+)
+
+type CacheState int
+
+const (
+	CacheMiss CacheState = iota
+	CacheFresh
+	CacheStale
+)
 
 type CacheEntry struct {
-	Data      []byte
-	ExpiresAt time.Time
+	Data       []byte
+	FetchedAt  time.Time
+	FreshUntil time.Time
+	StaleUntil time.Time
+}
+
+type CacheOptions struct {
+	// TTL is how long an entry is fresh.
+	TTL time.Duration
+	// MaxStale is how long after being fetched an entry can still be served as stale.
+	// It is at least the TTL: a shorter one is raised to the TTL, so that entries
+	// are never served stale.
+	MaxStale time.Duration
+	// MaxEntries caps the size of the cache, the least recently used entries are
+	// evicted first.
+	MaxEntries int
+	// JanitorInterval is the period of the sweeps removing expired entries.
+	// A negative value disables the janitor.
+	JanitorInterval time.Duration
+}
+
+type CacheStats struct {
+	Hits      uint64
+	StaleHits uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+}
+
+// Cache is a bounded LRU cache for upstream payloads, safe for concurrent use.
+type Cache struct {
+	mu    sync.Mutex
+	opts  CacheOptions
+	items map[string]*list.Element
+	lru   *list.List // front is the most recently used
+	stats CacheStats
+	now   func() time.Time
+	stop  chan struct{}
+	once  sync.Once
+}
+
+type cacheItem struct {
+	key   string
+	entry CacheEntry
 }
 
-var cache sync.Map
+// NewCache returns a cache, using the defaults for the zero options.
+// Unless disabled, a janitor goroutine runs until Close is called.
+func NewCache(opts CacheOptions) *Cache {
+	if opts.TTL <= 0 {
+		opts.TTL = defaultCacheTTL
+	}
+	if opts.MaxStale <= 0 {
+		opts.MaxStale = max(defaultCacheMaxStale, opts.TTL)
+	}
+	opts.MaxStale = max(opts.MaxStale, opts.TTL)
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultCacheMaxEntries
+	}
+	if opts.JanitorInterval == 0 {
+		opts.JanitorInterval = defaultJanitorInterval
+	}
+
+	c := &Cache{
+		opts:  opts,
+		items: make(map[string]*list.Element),
+		lru:   list.New(),
+		now:   time.Now,
+		stop:  make(chan struct{}),
+	}
 
-func GetFromCache(key string) ([]byte, bool) {
-	val, ok := cache.Load(key)
+	if opts.JanitorInterval > 0 {
+		go c.janitor(opts.JanitorInterval)
+	}
+
+	return c
+}
+
+func (c *Cache) Get(key string) (CacheEntry, CacheState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
 	if !ok {
-		return nil, false
+		c.stats.Misses++
+		return CacheEntry{}, CacheMiss
 	}
-	entry := val.(CacheEntry)
-	if time.Now().After(entry.ExpiresAt) {
-		cache.Delete(key)
-		return nil, false
+
+	item := el.Value.(*cacheItem)
+	now := c.now()
+	if now.After(item.entry.StaleUntil) {
+		c.remove(el)
+		c.stats.Misses++
+		return CacheEntry{}, CacheMiss
+	}
+
+	c.lru.MoveToFront(el)
+	if now.After(item.entry.FreshUntil) {
+		c.stats.StaleHits++
+		return item.entry, CacheStale
+	}
+	c.stats.Hits++
+	return item.entry, CacheFresh
+}
+
+func (c *Cache) Set(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	entry := CacheEntry{
+		Data:       data,
+		FetchedAt:  now,
+		FreshUntil: now.Add(c.opts.TTL),
+		StaleUntil: now.Add(c.opts.MaxStale),
+	}
+
+	if el, ok := c.items[key]; ok {
+		el.Value.(*cacheItem).entry = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.lru.PushFront(&cacheItem{key: key, entry: entry})
+
+	for c.lru.Len() > c.opts.MaxEntries {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
 	}
-	return entry.Data, true
 }
 
-func SetCache(key string, data []byte) {
-	cache.Store(key, CacheEntry{
-		Data:      data,
-		ExpiresAt: time.Now().Add(cacheTTL),
-	})
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
 }
 
+// Close stops the janitor.
+func (c *Cache) Close() {
+	c.once.Do(func() { close(c.stop) })
+}
+
+// Sweep removes the entries that can't be served anymore, even stale.
+func (c *Cache) Sweep() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for el := c.lru.Back(); el != nil; {
+		prev := el.Prev()
+		if now.After(el.Value.(*cacheItem).entry.StaleUntil) {
+			c.remove(el)
+			c.stats.Evictions++
+		}
+		el = prev
+	}
+}
+
+func (c *Cache) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Sweep()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.items, el.Value.(*cacheItem).key)
+}
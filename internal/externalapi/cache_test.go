@@ -0,0 +1,219 @@
+package externalapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jp-roisin/catch-and-go/internal/externalapi/stibmock"
+)
+
+func newTestCache(opts CacheOptions) (*Cache, *time.Time) {
+	now := time.Date(2025, 8, 1, 8, 0, 0, 0, time.UTC)
+	opts.JanitorInterval = -1
+	c := NewCache(opts)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestCacheStates(t *testing.T) {
+	c, now := newTestCache(CacheOptions{TTL: time.Minute, MaxStale: 10 * time.Minute})
+
+	c.Set("8042", []byte("{}"))
+
+	if _, state := c.Get("8042"); state != CacheFresh {
+		t.Errorf("Get() state = %v, want fresh", state)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	if _, state := c.Get("8042"); state != CacheStale {
+		t.Errorf("Get() state = %v, want stale", state)
+	}
+
+	*now = now.Add(10 * time.Minute)
+	if _, state := c.Get("8042"); state != CacheMiss {
+		t.Errorf("Get() state = %v, want miss", state)
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.StaleHits != 1 || stats.Misses != 1 || stats.Entries != 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestCacheMaxStale(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     CacheOptions
+		maxStale time.Duration
+	}{
+		{name: "default", opts: CacheOptions{TTL: time.Minute}, maxStale: defaultCacheMaxStale},
+		{name: "default below the TTL", opts: CacheOptions{TTL: time.Hour}, maxStale: time.Hour},
+		{name: "set", opts: CacheOptions{TTL: time.Minute, MaxStale: 5 * time.Minute}, maxStale: 5 * time.Minute},
+		{name: "below the TTL", opts: CacheOptions{TTL: 5 * time.Minute, MaxStale: time.Minute}, maxStale: 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestCache(tt.opts)
+			if c.opts.MaxStale != tt.maxStale {
+				t.Errorf("MaxStale = %s, want %s", c.opts.MaxStale, tt.maxStale)
+			}
+		})
+	}
+
+	// Raised to the TTL, the entries expire without being served stale
+	c, now := newTestCache(CacheOptions{TTL: 5 * time.Minute, MaxStale: time.Minute})
+	c.Set("8042", []byte("{}"))
+
+	*now = now.Add(4 * time.Minute)
+	if _, state := c.Get("8042"); state != CacheFresh {
+		t.Errorf("Get() state = %v, want fresh", state)
+	}
+	*now = now.Add(2 * time.Minute)
+	if _, state := c.Get("8042"); state != CacheMiss {
+		t.Errorf("Get() state = %v, want miss", state)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c, _ := newTestCache(CacheOptions{MaxEntries: 2})
+
+	c.Set("a", nil)
+	c.Set("b", nil)
+	c.Get("a") // "b" becomes the least recently used
+	c.Set("c", nil)
+
+	if _, state := c.Get("b"); state != CacheMiss {
+		t.Errorf("expected %q to be evicted", "b")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, state := c.Get(key); state == CacheMiss {
+			t.Errorf("expected %q to be kept", key)
+		}
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestCacheSweep(t *testing.T) {
+	c, now := newTestCache(CacheOptions{TTL: time.Minute, MaxStale: 5 * time.Minute})
+
+	c.Set("old", nil)
+	*now = now.Add(4 * time.Minute)
+	c.Set("recent", nil)
+	*now = now.Add(2 * time.Minute)
+
+	c.Sweep()
+
+	if stats := c.Stats(); stats.Entries != 1 || stats.Evictions != 1 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+	if _, state := c.Get("recent"); state != CacheStale {
+		t.Errorf("Get() state = %v, want stale", state)
+	}
+}
+
+func stopServedBy(lineID string) stibmock.Stop {
+	return stibmock.Stop{WaitingTimes: []stibmock.WaitingTime{{
+		LineID: lineID,
+		PassingTimes: []stibmock.PassingTime{
+			{Destination: stibmock.I18n{FR: "STOCKEL", NL: "STOKKEL"}, ExpectedArrivalTime: "3m", LineID: lineID},
+		},
+	}}}
+}
+
+// waitFor polls cond until it holds, the background refreshes don't report back.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSTIBClientServesStaleWhileRevalidating(t *testing.T) {
+	srv, mock := stibmock.NewServer(stibmock.Scenario{Stops: map[string]stibmock.Stop{"8042": stopServedBy("1")}})
+	defer srv.Close()
+
+	cache, now := newTestCache(CacheOptions{TTL: time.Minute, MaxStale: 10 * time.Minute})
+	client := NewSTIBClient(srv.URL+stibmock.DatasetsPath, "", ClientOptions{Cache: cache})
+	ctx := context.Background()
+
+	if _, err := client.GetWaitingTimeForStop(ctx, "8042"); err != nil {
+		t.Fatalf("GetWaitingTimeForStop() error = %v", err)
+	}
+
+	// Upstream moved on, the cached entry is past its TTL
+	mock.SetScenario(stibmock.Scenario{Stops: map[string]stibmock.Stop{"8042": stopServedBy("2")}})
+	*now = now.Add(2 * time.Minute)
+
+	res, err := client.GetWaitingTimeForStop(ctx, "8042")
+	if err != nil {
+		t.Fatalf("GetWaitingTimeForStop() error = %v", err)
+	}
+	if !res.Stale || res.WaitingTimes[0].LineID != "1" {
+		t.Errorf("got line %s (stale %v), want the stale line 1 without waiting for upstream", res.WaitingTimes[0].LineID, res.Stale)
+	}
+
+	waitFor(t, "the background refresh", func() bool {
+		_, state := cache.Get("8042")
+		return state == CacheFresh
+	})
+
+	res, err = client.GetWaitingTimeForStop(ctx, "8042")
+	if err != nil {
+		t.Fatalf("GetWaitingTimeForStop() error = %v", err)
+	}
+	if res.Stale || res.WaitingTimes[0].LineID != "2" {
+		t.Errorf("got line %s (stale %v), want the refreshed line 2", res.WaitingTimes[0].LineID, res.Stale)
+	}
+	if n := mock.Requests("8042"); n != 2 {
+		t.Errorf("expected one lookup and one refresh upstream, got %d requests", n)
+	}
+}
+
+func TestSTIBClientServesStaleOnUpstreamError(t *testing.T) {
+	srv, mock := stibmock.NewServer(stibmock.Scenario{Stops: map[string]stibmock.Stop{"8042": stopServedBy("1")}})
+	defer srv.Close()
+
+	cache, now := newTestCache(CacheOptions{TTL: time.Minute, MaxStale: 10 * time.Minute})
+	client := NewSTIBClient(srv.URL+stibmock.DatasetsPath, "", ClientOptions{Cache: cache, MaxRetries: NoRetries})
+	ctx := context.Background()
+
+	fetchedAt := *now
+	if _, err := client.GetWaitingTimeForStop(ctx, "8042"); err != nil {
+		t.Fatalf("GetWaitingTimeForStop() error = %v", err)
+	}
+
+	mock.SetScenario(stibmock.Scenario{Stops: map[string]stibmock.Stop{"8042": {Status: 503, Body: "Service Unavailable"}}})
+	*now = now.Add(2 * time.Minute)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		res, err := client.GetWaitingTimeForStop(ctx, "8042")
+		if err != nil {
+			t.Fatalf("attempt %d: GetWaitingTimeForStop() error = %v, want the stale entry", attempt, err)
+		}
+		if !res.Stale || len(res.WaitingTimes) != 1 || !res.FetchedAt.Equal(fetchedAt) {
+			t.Errorf("attempt %d: got %+v, want the entry fetched at %s marked stale", attempt, res, fetchedAt)
+		}
+
+		// The failed refresh keeps the stale entry, and the next lookup tries again
+		waitFor(t, "the background refresh to fail", func() bool {
+			_, refreshing := client.refreshing.Load("8042")
+			return mock.Requests("8042") == attempt+1 && !refreshing
+		})
+	}
+
+	// Past MaxStale, the error surfaces
+	*now = now.Add(10 * time.Minute)
+	if _, err := client.GetWaitingTimeForStop(ctx, "8042"); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("GetWaitingTimeForStop() error = %v, want %v once the entry expired", err, ErrUpstreamUnavailable)
+	}
+}
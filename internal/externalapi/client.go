@@ -0,0 +1,276 @@
+package externalapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ClientOptions configures how the STIB client talks to upstream.
+type ClientOptions struct {
+	// Timeout is the deadline of a single attempt. Defaults to 5s.
+	Timeout time.Duration
+	// MaxRetries is the number of retries after a 429, a 5xx or a network error.
+	// Defaults to 2 when left at 0, NoRetries (or any negative value) disables retries.
+	MaxRetries int
+	// Retries wait RetryBaseDelay, doubled at each attempt and capped to RetryMaxDelay,
+	// unless upstream asks for a specific delay with a Retry-After header.
+	// Defaults to 250ms and 5s.
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// After BreakerThreshold consecutive failed calls, upstream is not called anymore
+	// for BreakerCooldown: lookups are served from the cache, stale or not, or fail fast.
+	// Defaults to 5 and 30s.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// Cache stores the responses. Defaults to a cache with the default options.
+	Cache *Cache
+}
+
+// NoRetries is the MaxRetries of a client giving up after the first failed attempt,
+// the zero value standing for the default.
+const NoRetries = -1
+
+func (o ClientOptions) withDefaults() ClientOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = 5 * time.Second
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 2
+	}
+	if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.RetryBaseDelay <= 0 {
+		o.RetryBaseDelay = 250 * time.Millisecond
+	}
+	if o.RetryMaxDelay <= 0 {
+		o.RetryMaxDelay = 5 * time.Second
+	}
+	if o.BreakerThreshold <= 0 {
+		o.BreakerThreshold = 5
+	}
+	if o.BreakerCooldown <= 0 {
+		o.BreakerCooldown = 30 * time.Second
+	}
+	if o.Cache == nil {
+		o.Cache = NewCache(CacheOptions{})
+	}
+	return o
+}
+
+// ClientOptionsFromEnv reads STIB_TIMEOUT, STIB_MAX_RETRIES, STIB_BREAKER_THRESHOLD
+// and STIB_BREAKER_COOLDOWN. Unset variables keep their defaults, while
+// STIB_MAX_RETRIES=0 disables the retries.
+func ClientOptionsFromEnv() (ClientOptions, error) {
+	var opts ClientOptions
+
+	durations := map[string]*time.Duration{
+		"STIB_TIMEOUT":          &opts.Timeout,
+		"STIB_BREAKER_COOLDOWN": &opts.BreakerCooldown,
+	}
+	for name, d := range durations {
+		if v := os.Getenv(name); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %s %q: %w", name, v, err)
+			}
+			*d = parsed
+		}
+	}
+
+	ints := map[string]*int{
+		"STIB_MAX_RETRIES":       &opts.MaxRetries,
+		"STIB_BREAKER_THRESHOLD": &opts.BreakerThreshold,
+	}
+	for name, n := range ints {
+		if v := os.Getenv(name); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %s %q: %w", name, v, err)
+			}
+			*n = parsed
+		}
+	}
+
+	// Set to 0, the option would fall back to the default
+	if os.Getenv("STIB_MAX_RETRIES") != "" && opts.MaxRetries == 0 {
+		opts.MaxRetries = NoRetries
+	}
+
+	return opts, nil
+}
+
+type clientStats struct {
+	requests      atomic.Uint64
+	retries       atomic.Uint64
+	failures      atomic.Uint64
+	shortCircuits atomic.Uint64
+}
+
+// Health returns statistics about the client and its cache, in the same
+// shape as the database health report.
+func (c *STIBClient) Health() map[string]string {
+	state, openings := c.breaker.snapshot()
+	cache := c.cache.Stats()
+
+	return map[string]string{
+		"stib_breaker":          state.String(),
+		"stib_breaker_openings": strconv.FormatUint(openings, 10),
+		"stib_requests":         strconv.FormatUint(c.stats.requests.Load(), 10),
+		"stib_retries":          strconv.FormatUint(c.stats.retries.Load(), 10),
+		"stib_failures":         strconv.FormatUint(c.stats.failures.Load(), 10),
+		"stib_short_circuits":   strconv.FormatUint(c.stats.shortCircuits.Load(), 10),
+		"cache_entries":         strconv.Itoa(cache.Entries),
+		"cache_hits":            strconv.FormatUint(cache.Hits, 10),
+		"cache_stale_hits":      strconv.FormatUint(cache.StaleHits, 10),
+		"cache_misses":          strconv.FormatUint(cache.Misses, 10),
+		"cache_evictions":       strconv.FormatUint(cache.Evictions, 10),
+	}
+}
+
+// fetch runs a query against the records endpoint of a dataset and returns the raw body.
+// An empty where clause, a limit or an offset of 0 keep the API defaults.
+func (c *STIBClient) fetch(ctx context.Context, dataset string, where string, limit, offset int) ([]byte, error) {
+	query := url.Values{}
+	if where != "" {
+		query.Set("where", where)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+
+	return c.get(ctx, dataset+"/records", query)
+}
+
+// get requests a path of the catalog and returns the raw body.
+//
+// Each attempt has its own deadline. 429, 5xx and network errors are retried
+// with an exponential backoff, and count towards opening the circuit breaker
+// once the retries are exhausted.
+func (c *STIBClient) get(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	if !c.breaker.allow() {
+		c.stats.shortCircuits.Add(1)
+		return nil, ErrCircuitOpen
+	}
+
+	for attempt := 0; ; attempt++ {
+		body, err := c.attempt(ctx, path, query)
+		if err == nil {
+			c.breaker.success()
+			return body, nil
+		}
+
+		if ctx.Err() != nil {
+			c.breaker.neutral()
+			return nil, ctx.Err()
+		}
+
+		if !retryable(err) {
+			// Upstream answered, it's the request that is wrong
+			c.breaker.success()
+			return nil, err
+		}
+
+		delay := c.backoff(attempt, err)
+		if attempt >= c.opts.MaxRetries || delay < 0 {
+			c.stats.failures.Add(1)
+			c.breaker.failure()
+			return nil, err
+		}
+
+		c.stats.retries.Add(1)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			c.breaker.neutral()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *STIBClient) attempt(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/%s?%s", c.baseUrl, path, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Apikey %s", c.apiKey))
+
+	c.stats.requests.Add(1)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, &UpstreamError{Kind: ErrUpstreamUnavailable, Err: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		body, _ := io.ReadAll(res.Body)
+		return nil, &UpstreamError{
+			Kind:       kindFromStatus(res.StatusCode),
+			Status:     res.StatusCode,
+			Body:       string(body),
+			retryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		}
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, &UpstreamError{Kind: ErrUpstreamUnavailable, Err: fmt.Errorf("failed to read response body: %w", err)}
+	}
+
+	return body, nil
+}
+
+func retryable(err error) bool {
+	var ue *UpstreamError
+	if errors.As(err, &ue) && ue.Status != 0 {
+		return ue.Status == http.StatusTooManyRequests || ue.Status >= 500
+	}
+	// Network errors and attempt timeouts
+	return true
+}
+
+// backoff returns the delay before the next attempt, or -1 when upstream
+// asks to wait longer than we are willing to.
+func (c *STIBClient) backoff(attempt int, err error) time.Duration {
+	var ue *UpstreamError
+	if errors.As(err, &ue) && ue.retryAfter > 0 {
+		if ue.retryAfter > c.opts.RetryMaxDelay {
+			return -1
+		}
+		return ue.retryAfter
+	}
+
+	delay := min(c.opts.RetryBaseDelay<<attempt, c.opts.RetryMaxDelay)
+	// Jitter on the upper half of the delay, so that concurrent clients don't retry in lockstep
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// parseRetryAfter reads a Retry-After header, given in seconds or as an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+package externalapi
+
+import (
+	"fmt"
+	"time"
+)
+
+// Clock returns the current time. It is injected where departures are computed
+// so that tests can pin it.
+type Clock func() time.Time
+
+type DepartureState int
+
+const (
+	// DepartureUpcoming is more than a minute away.
+	DepartureUpcoming DepartureState = iota
+	// DepartureDue is arriving within the minute, or has just been expected
+	// (vehicles often wait a bit at the stop).
+	DepartureDue
+	// DepartureDeparted is past the grace period: the vehicle has most likely left.
+	DepartureDeparted
+)
+
+// departedGrace is how long after its expected time a departure is still shown as due.
+const departedGrace = 30 * time.Second
+
+// Departure is a passing time parsed and evaluated against a point in time.
+type Departure struct {
+	LineID      string
+	Destination I18n
+	ExpectedAt  time.Time
+	// Minutes is the number of whole minutes until ExpectedAt, 0 when due.
+	Minutes int
+	State   DepartureState
+}
+
+// NewDeparture parses the expected arrival time of a passing time and
+// evaluates it at now.
+func NewDeparture(pt PassingTime, now time.Time) (Departure, error) {
+	expectedAt, err := time.Parse(time.RFC3339, pt.ExpectedArrivalTime)
+	if err != nil {
+		return Departure{}, fmt.Errorf("%w: invalid expected arrival time %q", ErrDecode, pt.ExpectedArrivalTime)
+	}
+
+	d := Departure{
+		LineID:      pt.LineID,
+		Destination: pt.Destination,
+		ExpectedAt:  expectedAt,
+	}
+
+	diff := expectedAt.Sub(now)
+	switch {
+	case diff < -departedGrace:
+		d.State = DepartureDeparted
+		d.Minutes = int(diff.Minutes())
+	case diff < time.Minute:
+		d.State = DepartureDue
+	default:
+		d.State = DepartureUpcoming
+		d.Minutes = int(diff.Minutes())
+	}
+
+	return d, nil
+}
@@ -0,0 +1,39 @@
+package externalapi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewDeparture(t *testing.T) {
+	now := time.Date(2025, 8, 1, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		expected    string
+		wantState   DepartureState
+		wantMinutes int
+		wantErr     bool
+	}{
+		{name: "upcoming", expected: "2025-08-01T10:05:30+02:00", wantState: DepartureUpcoming, wantMinutes: 5},
+		{name: "due", expected: "2025-08-01T10:00:40+02:00", wantState: DepartureDue, wantMinutes: 0},
+		{name: "just expected", expected: "2025-08-01T09:59:45+02:00", wantState: DepartureDue, wantMinutes: 0},
+		{name: "departed", expected: "2025-08-01T09:58:00+02:00", wantState: DepartureDeparted, wantMinutes: -2},
+		{name: "unparsable", expected: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDeparture(PassingTime{ExpectedArrivalTime: tt.expected}, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewDeparture() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if d.State != tt.wantState || d.Minutes != tt.wantMinutes {
+				t.Errorf("NewDeparture() = state %v, %d min, want state %v, %d min", d.State, d.Minutes, tt.wantState, tt.wantMinutes)
+			}
+		})
+	}
+}
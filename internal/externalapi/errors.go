@@ -0,0 +1,70 @@
+package externalapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Kinds of upstream failures. Errors returned by the providers match one of them
+// with errors.Is, so callers can pick what to show without parsing messages.
+var (
+	ErrUnauthorized        = errors.New("the API key is missing or invalid")
+	ErrQuotaExceeded       = errors.New("the API quota is exceeded")
+	ErrUpstreamUnavailable = errors.New("the real-time API is unavailable")
+	ErrStopUnknown         = errors.New("the stop is unknown to the real-time API")
+	ErrDecode              = errors.New("the real-time API response couldn't be decoded")
+)
+
+// ErrCircuitOpen is returned without calling upstream while the circuit breaker is open.
+var ErrCircuitOpen = fmt.Errorf("%w: calls are suspended after repeated failures", ErrUpstreamUnavailable)
+
+// UpstreamError is a failed call to upstream. Body is the raw response, meant for
+// the logs only: it must not be shown to users.
+type UpstreamError struct {
+	Kind   error
+	Status int
+	Body   string
+	Err    error
+
+	retryAfter time.Duration
+}
+
+func (e *UpstreamError) Error() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+	case e.Status != 0:
+		return fmt.Sprintf("%v (status %d): %s", e.Kind, e.Status, e.Body)
+	default:
+		return e.Kind.Error()
+	}
+}
+
+func (e *UpstreamError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// kindFromStatus maps an upstream error status to its kind.
+func kindFromStatus(status int) error {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrUnauthorized
+	case status == http.StatusTooManyRequests:
+		return ErrQuotaExceeded
+	case status == http.StatusBadRequest || status == http.StatusNotFound:
+		// The where clause is built from the stop code
+		return ErrStopUnknown
+	default:
+		return ErrUpstreamUnavailable
+	}
+}
+
+func decodeError(err error) error {
+	return fmt.Errorf("%w: %v", ErrDecode, err)
+}
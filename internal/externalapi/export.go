@@ -0,0 +1,21 @@
+package externalapi
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// ExportDataset downloads a whole dataset through the Opendatasoft export API,
+// as a CSV with semicolon-separated columns, limited to the given columns in
+// that order. Exports bypass the cache, and are retried like the other requests:
+// the client Timeout must leave enough time to download the whole file.
+func (c *STIBClient) ExportDataset(ctx context.Context, dataset string, columns []string) ([]byte, error) {
+	query := url.Values{}
+	query.Set("delimiter", ";")
+	if len(columns) > 0 {
+		query.Set("select", strings.Join(columns, ","))
+	}
+
+	return c.get(ctx, dataset+"/exports/csv", query)
+}
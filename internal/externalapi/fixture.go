@@ -0,0 +1,107 @@
+package externalapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FixtureProvider serves waiting times from memory, without any network access.
+type FixtureProvider struct {
+	mu        sync.RWMutex
+	responses map[string]Response
+	messages  []Message
+	vehicles  map[string][]VehiclePosition
+}
+
+func NewFixtureProvider() *FixtureProvider {
+	return &FixtureProvider{
+		responses: make(map[string]Response),
+		vehicles:  make(map[string][]VehiclePosition),
+	}
+}
+
+// LoadFixtureProvider reads a file shaped like a `waiting-time-rt-production/records`
+// response (so a captured API payload can be reused as is) and indexes its results
+// by stop code.
+func LoadFixtureProvider(path string) (*FixtureProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture file: %w", err)
+	}
+
+	var res Response
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("json decode failed: %w", err)
+	}
+
+	p := NewFixtureProvider()
+	for _, wt := range res.WaitingTimes {
+		p.Add(wt)
+	}
+
+	return p, nil
+}
+
+// Add appends a waiting time to the response of its stop.
+func (p *FixtureProvider) Add(wt WaitingTime) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	res := p.responses[wt.PointID]
+	res.WaitingTimes = append(res.WaitingTimes, wt)
+	res.TotalCount = len(res.WaitingTimes)
+	p.responses[wt.PointID] = res
+}
+
+// GetWaitingTimeForStop returns the stored response, or an empty one for unknown stops
+// (which is what the STIB API does as well).
+func (p *FixtureProvider) GetWaitingTimeForStop(ctx context.Context, stopCode string) (Response, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.responses[stopCode], nil
+}
+
+func (p *FixtureProvider) GetWaitingTimesForStops(ctx context.Context, stopCodes []string) (map[string]Response, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	results := make(map[string]Response, len(stopCodes))
+	for _, code := range stopCodes {
+		results[code] = p.responses[code]
+	}
+	return results, nil
+}
+
+// AddMessage publishes a traveller information message.
+func (p *FixtureProvider) AddMessage(m Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages = append(p.messages, m)
+}
+
+func (p *FixtureProvider) GetDisruptions(ctx context.Context) (Disruptions, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return NewDisruptions(p.messages), nil
+}
+
+// AddVehicle places a vehicle on a line.
+func (p *FixtureProvider) AddVehicle(lineCode string, v VehiclePosition) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.vehicles[lineCode] = append(p.vehicles[lineCode], v)
+}
+
+func (p *FixtureProvider) GetVehiclePositions(ctx context.Context, lineCode string) (VehiclePositions, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return VehiclePositions{LineID: lineCode, Vehicles: p.vehicles[lineCode]}, nil
+}
@@ -0,0 +1,326 @@
+package externalapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jp-roisin/catch-and-go/internal/externalapi/gtfsrt"
+	"golang.org/x/sync/singleflight"
+)
+
+// GTFS-RT feeds are usually regenerated every 30 seconds.
+const defaultGTFSRTRefresh = 30 * time.Second
+
+// GTFSRTOptions configures the GTFS-Realtime provider.
+type GTFSRTOptions struct {
+	// Timeout is the deadline of a feed download. Defaults to 10s, feeds cover
+	// the whole network and are much bigger than the STIB API responses.
+	Timeout time.Duration
+	// Refresh is how long a downloaded feed is fresh. Defaults to 30s.
+	Refresh time.Duration
+	// MaxStale is how long after being downloaded a feed is still served,
+	// flagged as stale, while upstream fails. Defaults to 15 minutes.
+	MaxStale time.Duration
+}
+
+func (o GTFSRTOptions) withDefaults() GTFSRTOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.Refresh <= 0 {
+		o.Refresh = defaultGTFSRTRefresh
+	}
+	if o.MaxStale < o.Refresh {
+		o.MaxStale = max(defaultCacheMaxStale, o.Refresh)
+	}
+	return o
+}
+
+// GTFSRTOptionsFromEnv reads GTFSRT_TIMEOUT and GTFSRT_REFRESH.
+// Unset variables keep their defaults.
+func GTFSRTOptionsFromEnv() (GTFSRTOptions, error) {
+	var opts GTFSRTOptions
+
+	durations := map[string]*time.Duration{
+		"GTFSRT_TIMEOUT": &opts.Timeout,
+		"GTFSRT_REFRESH": &opts.Refresh,
+	}
+	for name, d := range durations {
+		if v := os.Getenv(name); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %s %q: %w", name, v, err)
+			}
+			*d = parsed
+		}
+	}
+
+	return opts, nil
+}
+
+// GTFSRTProvider serves waiting times from a GTFS-Realtime TripUpdates feed.
+// The feed covers the whole network: it is downloaded once per refresh period
+// and indexed by stop, so lookups never wait on upstream while it is fresh.
+type GTFSRTProvider struct {
+	feedUrl    string
+	httpClient *http.Client
+	opts       GTFSRTOptions
+	now        func() time.Time
+
+	mu       sync.RWMutex
+	byStop   map[string][]WaitingTime
+	loadedAt time.Time
+
+	inflight   singleflight.Group
+	refreshing atomic.Bool
+
+	downloads atomic.Uint64
+	failures  atomic.Uint64
+}
+
+func NewGTFSRTProvider(feedUrl string, opts GTFSRTOptions) *GTFSRTProvider {
+	opts = opts.withDefaults()
+
+	return &GTFSRTProvider{
+		feedUrl:    feedUrl,
+		httpClient: &http.Client{Timeout: 2 * opts.Timeout},
+		opts:       opts,
+		now:        time.Now,
+	}
+}
+
+func (p *GTFSRTProvider) GetWaitingTimeForStop(ctx context.Context, stopCode string) (Response, error) {
+	results, err := p.GetWaitingTimesForStops(ctx, []string{stopCode})
+	return results[stopCode], err
+}
+
+// GetWaitingTimesForStops answers from the current feed, downloading it first
+// if there is none or if it is too old to be served.
+func (p *GTFSRTProvider) GetWaitingTimesForStops(ctx context.Context, stopCodes []string) (map[string]Response, error) {
+	p.mu.RLock()
+	loadedAt := p.loadedAt
+	p.mu.RUnlock()
+
+	age := p.now().Sub(loadedAt)
+	stale := false
+	switch {
+	case loadedAt.IsZero() || age > p.opts.MaxStale:
+		ch := p.inflight.DoChan("feed", func() (any, error) {
+			fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+			defer cancel()
+			return nil, p.refresh(fetchCtx)
+		})
+		select {
+		case res := <-ch:
+			if res.Err != nil {
+				return nil, res.Err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	case age > p.opts.Refresh:
+		stale = true
+		p.refreshInBackground()
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	results := make(map[string]Response, len(stopCodes))
+	for _, code := range stopCodes {
+		results[code] = Response{
+			TotalCount:   len(p.byStop[code]),
+			WaitingTimes: p.byStop[code],
+			FetchedAt:    p.loadedAt,
+			Stale:        stale,
+		}
+	}
+	return results, nil
+}
+
+// RefreshStops downloads the feed again. It covers every stop, so the codes don't matter.
+func (p *GTFSRTProvider) RefreshStops(ctx context.Context, stopCodes []string) error {
+	_, err, _ := p.inflight.Do("feed", func() (any, error) {
+		return nil, p.refresh(ctx)
+	})
+	return err
+}
+
+func (p *GTFSRTProvider) refreshInBackground() {
+	if !p.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer p.refreshing.Store(false)
+
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+
+		if err := p.RefreshStops(ctx, nil); err != nil {
+			log.Printf("Background refresh of the GTFS-RT feed failed, serving stale data: %v", err)
+		}
+	}()
+}
+
+func (p *GTFSRTProvider) refresh(ctx context.Context) error {
+	body, err := p.download(ctx)
+	if err != nil {
+		p.failures.Add(1)
+		return err
+	}
+
+	feed, err := gtfsrt.Decode(body)
+	if err != nil {
+		p.failures.Add(1)
+		return decodeError(err)
+	}
+
+	byStop := waitingTimesFromFeed(feed)
+
+	p.mu.Lock()
+	p.byStop = byStop
+	p.loadedAt = p.now()
+	p.mu.Unlock()
+
+	return nil
+}
+
+func (p *GTFSRTProvider) download(ctx context.Context) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", p.feedUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/x-protobuf")
+
+	p.downloads.Add(1)
+	res, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, &UpstreamError{Kind: ErrUpstreamUnavailable, Err: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		kind := kindFromStatus(res.StatusCode)
+		if kind == ErrStopUnknown {
+			// There's no per-stop query here, a 404 means the feed itself is missing
+			kind = ErrUpstreamUnavailable
+		}
+		return nil, &UpstreamError{Kind: kind, Status: res.StatusCode, Body: string(body)}
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, &UpstreamError{Kind: ErrUpstreamUnavailable, Err: fmt.Errorf("failed to read response body: %w", err)}
+	}
+
+	return body, nil
+}
+
+// Health reports the feed downloads and the age of the served data.
+func (p *GTFSRTProvider) Health() map[string]string {
+	p.mu.RLock()
+	loadedAt := p.loadedAt
+	p.mu.RUnlock()
+
+	age := "never"
+	if !loadedAt.IsZero() {
+		age = p.now().Sub(loadedAt).Round(time.Second).String()
+	}
+
+	return map[string]string{
+		"gtfsrt_feed_age":  age,
+		"gtfsrt_downloads": strconv.FormatUint(p.downloads.Load(), 10),
+		"gtfsrt_failures":  strconv.FormatUint(p.failures.Load(), 10),
+	}
+}
+
+// waitingTimesFromFeed maps the stop time updates of a feed onto waiting times,
+// grouped by stop and then by route like the STIB API does.
+//
+// GTFS-RT has no translations: the trip headsign, or the last stop of the trip
+// when the feed doesn't publish trip properties, is used for both languages.
+// Canceled trips, skipped stops and updates without a predicted time are left out.
+func waitingTimesFromFeed(feed gtfsrt.FeedMessage) map[string][]WaitingTime {
+	type key struct{ stop, route string }
+	passingTimes := make(map[key][]gtfsrtPassingTime)
+
+	for _, e := range feed.Entities {
+		u := e.TripUpdate
+		if e.IsDeleted || u == nil || u.Trip.ScheduleRelationship == gtfsrt.TripCanceled || len(u.StopTimeUpdates) == 0 {
+			continue
+		}
+
+		destination := u.Headsign
+		if destination == "" {
+			destination = u.StopTimeUpdates[len(u.StopTimeUpdates)-1].StopID
+		}
+
+		for _, s := range u.StopTimeUpdates {
+			if s.ScheduleRelationship != gtfsrt.StopScheduled || s.StopID == "" {
+				continue
+			}
+
+			event := s.Arrival
+			if event == nil || event.Time == 0 {
+				event = s.Departure
+			}
+			if event == nil || event.Time == 0 {
+				continue
+			}
+
+			k := key{s.StopID, u.Trip.RouteID}
+			passingTimes[k] = append(passingTimes[k], gtfsrtPassingTime{
+				at: event.Time,
+				PassingTime: PassingTime{
+					Destination:         I18n{FR: destination, NL: destination},
+					ExpectedArrivalTime: time.Unix(event.Time, 0).Format(time.RFC3339),
+					LineID:              u.Trip.RouteID,
+				},
+			})
+		}
+	}
+
+	keys := make([]key, 0, len(passingTimes))
+	for k := range passingTimes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].stop != keys[j].stop {
+			return keys[i].stop < keys[j].stop
+		}
+		return keys[i].route < keys[j].route
+	})
+
+	byStop := make(map[string][]WaitingTime)
+	for _, k := range keys {
+		pts := passingTimes[k]
+		sort.SliceStable(pts, func(i, j int) bool { return pts[i].at < pts[j].at })
+
+		wt := WaitingTime{PointID: k.stop, LineID: k.route}
+		for _, pt := range pts {
+			wt.PassingTimes = append(wt.PassingTimes, pt.PassingTime)
+		}
+		byStop[k.stop] = append(byStop[k.stop], wt)
+	}
+
+	return byStop
+}
+
+type gtfsrtPassingTime struct {
+	PassingTime
+	at int64
+}
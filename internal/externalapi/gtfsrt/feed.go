@@ -0,0 +1,336 @@
+// Package gtfsrt decodes GTFS-Realtime feeds, the protobuf format most operators
+// publish their real-time data in (https://gtfs.org/realtime/reference/).
+// Only the TripUpdates part of the schema is read, the other entities
+// and the unknown fields are skipped.
+package gtfsrt
+
+import "fmt"
+
+// TripScheduleRelationship tells how a trip relates to the static schedule.
+type TripScheduleRelationship int
+
+const (
+	TripScheduled   TripScheduleRelationship = 0
+	TripAdded       TripScheduleRelationship = 1
+	TripUnscheduled TripScheduleRelationship = 2
+	TripCanceled    TripScheduleRelationship = 3
+)
+
+// StopScheduleRelationship tells whether a vehicle calls at a stop.
+type StopScheduleRelationship int
+
+const (
+	StopScheduled StopScheduleRelationship = 0
+	StopSkipped   StopScheduleRelationship = 1
+	StopNoData    StopScheduleRelationship = 2
+)
+
+type FeedMessage struct {
+	Header   FeedHeader
+	Entities []FeedEntity
+}
+
+type FeedHeader struct {
+	Version string
+	// Timestamp is when the feed was produced, in POSIX seconds.
+	Timestamp uint64
+}
+
+type FeedEntity struct {
+	ID        string
+	IsDeleted bool
+	// TripUpdate is nil for the vehicle position and alert entities.
+	TripUpdate *TripUpdate
+}
+
+type TripUpdate struct {
+	Trip            TripDescriptor
+	StopTimeUpdates []StopTimeUpdate
+	Timestamp       uint64
+	Delay           int32
+	// Headsign comes from the (experimental) trip properties, it's often empty.
+	Headsign string
+}
+
+type TripDescriptor struct {
+	TripID               string
+	RouteID              string
+	DirectionID          uint32
+	StartTime            string
+	StartDate            string
+	ScheduleRelationship TripScheduleRelationship
+}
+
+type StopTimeUpdate struct {
+	StopSequence         uint32
+	StopID               string
+	Arrival              *StopTimeEvent
+	Departure            *StopTimeEvent
+	ScheduleRelationship StopScheduleRelationship
+}
+
+// StopTimeEvent is a predicted arrival or departure. Time is in POSIX seconds
+// and 0 when the producer only published a delay.
+type StopTimeEvent struct {
+	Delay       int32
+	Time        int64
+	Uncertainty int32
+}
+
+// Decode parses an encoded FeedMessage.
+func Decode(data []byte) (FeedMessage, error) {
+	var m FeedMessage
+	r := &reader{buf: data}
+
+	for !r.done() {
+		num, wt, err := r.field()
+		if err != nil {
+			return m, err
+		}
+
+		switch num {
+		case 1:
+			err = message(r, num, wt, &m.Header, decodeHeader)
+		case 2:
+			var e FeedEntity
+			if err = message(r, num, wt, &e, decodeEntity); err == nil {
+				m.Entities = append(m.Entities, e)
+			}
+		default:
+			err = r.skip(wt)
+		}
+		if err != nil {
+			return m, fmt.Errorf("feed message: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+// message decodes an embedded message field into v.
+func message[T any](r *reader, num, wt int, v *T, decode func(*reader, *T) error) error {
+	if err := expect(num, wt, wireBytes); err != nil {
+		return err
+	}
+	b, err := r.bytes()
+	if err != nil {
+		return err
+	}
+	return decode(&reader{buf: b}, v)
+}
+
+func str(r *reader, num, wt int, v *string) error {
+	if err := expect(num, wt, wireBytes); err != nil {
+		return err
+	}
+	b, err := r.bytes()
+	if err != nil {
+		return err
+	}
+	*v = string(b)
+	return nil
+}
+
+func uvarint[T ~uint32 | ~uint64 | ~int](r *reader, num, wt int, v *T) error {
+	if err := expect(num, wt, wireVarint); err != nil {
+		return err
+	}
+	n, err := r.varint()
+	if err != nil {
+		return err
+	}
+	*v = T(n)
+	return nil
+}
+
+// svarint reads an int32 or int64: negative values are sign-extended
+// two's complement, so truncating the varint is enough.
+func svarint[T ~int32 | ~int64](r *reader, num, wt int, v *T) error {
+	if err := expect(num, wt, wireVarint); err != nil {
+		return err
+	}
+	n, err := r.varint()
+	if err != nil {
+		return err
+	}
+	*v = T(int64(n))
+	return nil
+}
+
+func decodeHeader(r *reader, h *FeedHeader) error {
+	for !r.done() {
+		num, wt, err := r.field()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			err = str(r, num, wt, &h.Version)
+		case 3:
+			err = uvarint(r, num, wt, &h.Timestamp)
+		default:
+			err = r.skip(wt)
+		}
+		if err != nil {
+			return fmt.Errorf("header: %w", err)
+		}
+	}
+	return nil
+}
+
+func decodeEntity(r *reader, e *FeedEntity) error {
+	for !r.done() {
+		num, wt, err := r.field()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			err = str(r, num, wt, &e.ID)
+		case 2:
+			var deleted int
+			err = uvarint(r, num, wt, &deleted)
+			e.IsDeleted = deleted != 0
+		case 3:
+			e.TripUpdate = &TripUpdate{}
+			err = message(r, num, wt, e.TripUpdate, decodeTripUpdate)
+		default:
+			err = r.skip(wt)
+		}
+		if err != nil {
+			return fmt.Errorf("entity %q: %w", e.ID, err)
+		}
+	}
+	return nil
+}
+
+func decodeTripUpdate(r *reader, u *TripUpdate) error {
+	for !r.done() {
+		num, wt, err := r.field()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			err = message(r, num, wt, &u.Trip, decodeTripDescriptor)
+		case 2:
+			var s StopTimeUpdate
+			if err = message(r, num, wt, &s, decodeStopTimeUpdate); err == nil {
+				u.StopTimeUpdates = append(u.StopTimeUpdates, s)
+			}
+		case 4:
+			err = uvarint(r, num, wt, &u.Timestamp)
+		case 5:
+			err = svarint(r, num, wt, &u.Delay)
+		case 6:
+			err = message(r, num, wt, &u.Headsign, decodeTripProperties)
+		default:
+			err = r.skip(wt)
+		}
+		if err != nil {
+			return fmt.Errorf("trip update: %w", err)
+		}
+	}
+	return nil
+}
+
+func decodeTripDescriptor(r *reader, t *TripDescriptor) error {
+	for !r.done() {
+		num, wt, err := r.field()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			err = str(r, num, wt, &t.TripID)
+		case 2:
+			err = str(r, num, wt, &t.StartTime)
+		case 3:
+			err = str(r, num, wt, &t.StartDate)
+		case 4:
+			err = uvarint(r, num, wt, &t.ScheduleRelationship)
+		case 5:
+			err = str(r, num, wt, &t.RouteID)
+		case 6:
+			err = uvarint(r, num, wt, &t.DirectionID)
+		default:
+			err = r.skip(wt)
+		}
+		if err != nil {
+			return fmt.Errorf("trip: %w", err)
+		}
+	}
+	return nil
+}
+
+// decodeTripProperties only keeps the headsign.
+func decodeTripProperties(r *reader, headsign *string) error {
+	for !r.done() {
+		num, wt, err := r.field()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 5:
+			err = str(r, num, wt, headsign)
+		default:
+			err = r.skip(wt)
+		}
+		if err != nil {
+			return fmt.Errorf("trip properties: %w", err)
+		}
+	}
+	return nil
+}
+
+func decodeStopTimeUpdate(r *reader, s *StopTimeUpdate) error {
+	for !r.done() {
+		num, wt, err := r.field()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			err = uvarint(r, num, wt, &s.StopSequence)
+		case 2:
+			s.Arrival = &StopTimeEvent{}
+			err = message(r, num, wt, s.Arrival, decodeStopTimeEvent)
+		case 3:
+			s.Departure = &StopTimeEvent{}
+			err = message(r, num, wt, s.Departure, decodeStopTimeEvent)
+		case 4:
+			err = str(r, num, wt, &s.StopID)
+		case 5:
+			err = uvarint(r, num, wt, &s.ScheduleRelationship)
+		default:
+			err = r.skip(wt)
+		}
+		if err != nil {
+			return fmt.Errorf("stop time update: %w", err)
+		}
+	}
+	return nil
+}
+
+func decodeStopTimeEvent(r *reader, e *StopTimeEvent) error {
+	for !r.done() {
+		num, wt, err := r.field()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			err = svarint(r, num, wt, &e.Delay)
+		case 2:
+			err = svarint(r, num, wt, &e.Time)
+		case 3:
+			err = svarint(r, num, wt, &e.Uncertainty)
+		default:
+			err = r.skip(wt)
+		}
+		if err != nil {
+			return fmt.Errorf("stop time event: %w", err)
+		}
+	}
+	return nil
+}
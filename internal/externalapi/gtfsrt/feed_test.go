@@ -0,0 +1,229 @@
+package gtfsrt
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the .pb files of testdata")
+
+// tripUpdatesFeed is the content of testdata/trip_updates.pb, which the
+// provider tests of the externalapi package serve as well.
+// Its header timestamp is 2025-08-01T08:00:00Z.
+var tripUpdatesFeed = FeedMessage{
+	Header: FeedHeader{Version: "2.0", Timestamp: 1754035200},
+	Entities: []FeedEntity{
+		{
+			ID: "t1",
+			TripUpdate: &TripUpdate{
+				Trip:     TripDescriptor{TripID: "t1", RouteID: "5", DirectionID: 1, StartDate: "20250801"},
+				Headsign: "STOCKEL",
+				StopTimeUpdates: []StopTimeUpdate{
+					{StopSequence: 4, StopID: "8042", Arrival: &StopTimeEvent{Delay: 60, Time: 1754035500}},
+					{StopSequence: 5, StopID: "8032", Departure: &StopTimeEvent{Time: 1754035680}},
+					{StopSequence: 6, StopID: "8022", ScheduleRelationship: StopSkipped},
+				},
+			},
+		},
+		{
+			ID: "t2",
+			TripUpdate: &TripUpdate{
+				Trip:     TripDescriptor{TripID: "t2", RouteID: "5", ScheduleRelationship: TripCanceled},
+				Headsign: "STOCKEL",
+				StopTimeUpdates: []StopTimeUpdate{
+					{StopSequence: 4, StopID: "8042", Arrival: &StopTimeEvent{Time: 1754035380}},
+				},
+			},
+		},
+		{
+			ID: "t3",
+			TripUpdate: &TripUpdate{
+				Trip: TripDescriptor{TripID: "t3", RouteID: "1"},
+				StopTimeUpdates: []StopTimeUpdate{
+					{StopSequence: 10, StopID: "8042", Arrival: &StopTimeEvent{Delay: -30, Time: 1754035320}},
+					{StopSequence: 18, StopID: "8731", Arrival: &StopTimeEvent{Time: 1754035800}},
+				},
+				Delay: -30,
+			},
+		},
+		{ID: "t4", IsDeleted: true},
+	},
+}
+
+func TestDecode(t *testing.T) {
+	path := filepath.Join("testdata", "trip_updates.pb")
+	encoded := encodeFeed(tripUpdatesFeed)
+
+	if *update {
+		if err := os.WriteFile(path, encoded, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, encoded) {
+		t.Fatalf("%s is outdated, run the tests with -update", path)
+	}
+
+	feed, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(feed, tripUpdatesFeed) {
+		t.Errorf("Decode() = %+v, want %+v", feed, tripUpdatesFeed)
+	}
+}
+
+func TestDecodeSkipsUnknownFields(t *testing.T) {
+	var entity []byte
+	entity = appendString(entity, 1, "v1")
+	// A VehiclePosition entity, with fixed32 and fixed64 fields inside
+	var vehicle []byte
+	vehicle = appendTag(vehicle, 2, wireFixed32)
+	vehicle = append(vehicle, 0, 0, 0x80, 0x3f)
+	vehicle = appendTag(vehicle, 9, wireFixed64)
+	vehicle = append(vehicle, 1, 2, 3, 4, 5, 6, 7, 8)
+	entity = appendMessage(entity, 4, vehicle)
+
+	var data []byte
+	data = appendMessage(data, 2, entity)
+
+	feed, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if len(feed.Entities) != 1 || feed.Entities[0].ID != "v1" || feed.Entities[0].TripUpdate != nil {
+		t.Errorf("Decode() = %+v, want a single entity without trip update", feed)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	encoded := encodeFeed(tripUpdatesFeed)
+
+	tests := map[string][]byte{
+		"truncated":          encoded[:len(encoded)-3],
+		"wrong wire type":    appendVarint(appendTag(nil, 1, wireVarint), 1),
+		"invalid field":      {0x00},
+		"unknown wire type":  {0x0b},
+		"overflowing varint": bytes.Repeat([]byte{0xff}, 11),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Decode(data); err == nil {
+				t.Errorf("Decode() expected an error")
+			}
+		})
+	}
+}
+
+// The encoder only exists to produce test feeds, the application never writes any.
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendTag(b []byte, num, wireType int) []byte {
+	return appendVarint(b, uint64(num)<<3|uint64(wireType))
+}
+
+func appendString(b []byte, num int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendTag(b, num, wireBytes)
+	b = appendVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendMessage(b []byte, num int, m []byte) []byte {
+	b = appendTag(b, num, wireBytes)
+	b = appendVarint(b, uint64(len(m)))
+	return append(b, m...)
+}
+
+// appendInt writes an integer field, negative values as 10 bytes two's complement.
+func appendInt(b []byte, num int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, num, wireVarint)
+	return appendVarint(b, uint64(v))
+}
+
+func encodeFeed(m FeedMessage) []byte {
+	var header []byte
+	header = appendString(header, 1, m.Header.Version)
+	header = appendInt(header, 3, int64(m.Header.Timestamp))
+
+	var b []byte
+	b = appendMessage(b, 1, header)
+	for _, e := range m.Entities {
+		b = appendMessage(b, 2, encodeEntity(e))
+	}
+	return b
+}
+
+func encodeEntity(e FeedEntity) []byte {
+	var b []byte
+	b = appendString(b, 1, e.ID)
+	if e.IsDeleted {
+		b = appendInt(b, 2, 1)
+	}
+	if u := e.TripUpdate; u != nil {
+		var trip []byte
+		trip = appendString(trip, 1, u.Trip.TripID)
+		trip = appendString(trip, 2, u.Trip.StartTime)
+		trip = appendString(trip, 3, u.Trip.StartDate)
+		trip = appendInt(trip, 4, int64(u.Trip.ScheduleRelationship))
+		trip = appendString(trip, 5, u.Trip.RouteID)
+		trip = appendInt(trip, 6, int64(u.Trip.DirectionID))
+
+		var tu []byte
+		tu = appendMessage(tu, 1, trip)
+		for _, s := range u.StopTimeUpdates {
+			tu = appendMessage(tu, 2, encodeStopTimeUpdate(s))
+		}
+		tu = appendInt(tu, 4, int64(u.Timestamp))
+		tu = appendInt(tu, 5, int64(u.Delay))
+		if u.Headsign != "" {
+			tu = appendMessage(tu, 6, appendString(nil, 5, u.Headsign))
+		}
+
+		b = appendMessage(b, 3, tu)
+	}
+	return b
+}
+
+func encodeStopTimeUpdate(s StopTimeUpdate) []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(s.StopSequence))
+	if s.Arrival != nil {
+		b = appendMessage(b, 2, encodeStopTimeEvent(*s.Arrival))
+	}
+	if s.Departure != nil {
+		b = appendMessage(b, 3, encodeStopTimeEvent(*s.Departure))
+	}
+	b = appendString(b, 4, s.StopID)
+	b = appendInt(b, 5, int64(s.ScheduleRelationship))
+	return b
+}
+
+func encodeStopTimeEvent(e StopTimeEvent) []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(e.Delay))
+	b = appendInt(b, 2, e.Time)
+	b = appendInt(b, 3, int64(e.Uncertainty))
+	return b
+}
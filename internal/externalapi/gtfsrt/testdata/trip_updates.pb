@@ -0,0 +1,15 @@
+
+
+2.0X
+t1R
+
+t120250801*50<"8042"8032
+"8022(2	*STOCKEL.
+t2(
+	
+t2 *5"80422	*STOCKELI
+t3C
+
+t3*1
+"8042"8731(
+t4
\ No newline at end of file
@@ -0,0 +1,104 @@
+package gtfsrt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Protobuf wire types, see https://protobuf.dev/programming-guides/encoding/
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated message")
+
+// reader walks the fields of an encoded message. Only the wire types used by
+// proto2 messages without groups are supported, which covers GTFS-Realtime.
+type reader struct {
+	buf []byte
+	pos int
+}
+
+func (r *reader) done() bool {
+	return r.pos >= len(r.buf)
+}
+
+func (r *reader) varint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		if r.pos >= len(r.buf) {
+			return 0, errTruncated
+		}
+		b := r.buf[r.pos]
+		r.pos++
+		v |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("varint overflows 64 bits")
+}
+
+// field reads the next field key.
+func (r *reader) field() (num int, wireType int, err error) {
+	key, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	num, wireType = int(key>>3), int(key&0x7)
+	if num <= 0 {
+		return 0, 0, fmt.Errorf("invalid field number %d", num)
+	}
+	return num, wireType, nil
+}
+
+func (r *reader) bytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.buf)-r.pos) {
+		return nil, errTruncated
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// skip jumps over the value of a field we don't need.
+func (r *reader) skip(wireType int) error {
+	switch wireType {
+	case wireVarint:
+		_, err := r.varint()
+		return err
+	case wireFixed64:
+		return r.advance(8)
+	case wireBytes:
+		_, err := r.bytes()
+		return err
+	case wireFixed32:
+		return r.advance(4)
+	default:
+		return fmt.Errorf("unsupported wire type %d", wireType)
+	}
+}
+
+func (r *reader) advance(n int) error {
+	if n > len(r.buf)-r.pos {
+		return errTruncated
+	}
+	r.pos += n
+	return nil
+}
+
+// expect checks the wire type of a known field, so that a feed using
+// another schema fails loudly instead of being misread.
+func expect(num, got, want int) error {
+	if got != want {
+		return fmt.Errorf("field %d: wire type %d, expected %d", num, got, want)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package externalapi_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jp-roisin/catch-and-go/internal/externalapi"
+)
+
+// newFeedServer serves the TripUpdates fixture of the gtfsrt package.
+func newFeedServer(t *testing.T, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	feed, err := os.ReadFile("gtfsrt/testdata/trip_updates.pb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var downloads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(feed)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &downloads
+}
+
+func TestGTFSRTProviderGetWaitingTimeForStop(t *testing.T) {
+	srv, downloads := newFeedServer(t, http.StatusOK)
+	provider := externalapi.NewGTFSRTProvider(srv.URL, externalapi.GTFSRTOptions{})
+
+	res, err := provider.GetWaitingTimeForStop(context.Background(), "8042")
+	if err != nil {
+		t.Fatalf("GetWaitingTimeForStop() error = %v", err)
+	}
+
+	// The canceled trip is left out, the trip without headsign goes to its last stop.
+	expected := []externalapi.WaitingTime{
+		{PointID: "8042", LineID: "1", PassingTimes: externalapi.PassingTimeList{{
+			Destination:         externalapi.I18n{FR: "8731", NL: "8731"},
+			ExpectedArrivalTime: time.Date(2025, 8, 1, 8, 2, 0, 0, time.UTC).Local().Format(time.RFC3339),
+			LineID:              "1",
+		}}},
+		{PointID: "8042", LineID: "5", PassingTimes: externalapi.PassingTimeList{{
+			Destination:         externalapi.I18n{FR: "STOCKEL", NL: "STOCKEL"},
+			ExpectedArrivalTime: time.Date(2025, 8, 1, 8, 5, 0, 0, time.UTC).Local().Format(time.RFC3339),
+			LineID:              "5",
+		}}},
+	}
+	if !reflect.DeepEqual(res.WaitingTimes, expected) {
+		t.Errorf("GetWaitingTimeForStop() = %+v, want %+v", res.WaitingTimes, expected)
+	}
+
+	results, err := provider.GetWaitingTimesForStops(context.Background(), []string{"8032", "8022"})
+	if err != nil {
+		t.Fatalf("GetWaitingTimesForStops() error = %v", err)
+	}
+	if len(results["8032"].WaitingTimes) != 1 {
+		t.Errorf("expected the departure time to be used when there's no arrival, got %+v", results["8032"])
+	}
+	if len(results["8022"].WaitingTimes) != 0 {
+		t.Errorf("expected the skipped stop to have no passing time, got %+v", results["8022"])
+	}
+
+	if n := downloads.Load(); n != 1 {
+		t.Errorf("expected the feed to be downloaded once while fresh, got %d downloads", n)
+	}
+}
+
+func TestGTFSRTProviderErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		kind   error
+	}{
+		{http.StatusUnauthorized, externalapi.ErrUnauthorized},
+		{http.StatusTooManyRequests, externalapi.ErrQuotaExceeded},
+		{http.StatusNotFound, externalapi.ErrUpstreamUnavailable},
+		{http.StatusBadGateway, externalapi.ErrUpstreamUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			srv, _ := newFeedServer(t, tt.status)
+			provider := externalapi.NewGTFSRTProvider(srv.URL, externalapi.GTFSRTOptions{})
+
+			_, err := provider.GetWaitingTimeForStop(context.Background(), "8042")
+			if !errors.Is(err, tt.kind) {
+				t.Errorf("GetWaitingTimeForStop() error = %v, want %v", err, tt.kind)
+			}
+		})
+	}
+}
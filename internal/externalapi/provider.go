@@ -0,0 +1,66 @@
+package externalapi
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+// WaitingTimeProvider is the source of real-time passing times used by the server.
+// The STIB Opendatasoft client is the production implementation; the fixture
+// provider serves canned responses for tests and offline demos.
+type WaitingTimeProvider interface {
+	GetWaitingTimeForStop(ctx context.Context, stopCode string) (Response, error)
+}
+
+// BatchWaitingTimeProvider is implemented by providers able to look up several
+// stops at once, which the server uses to refresh a whole dashboard page together.
+type BatchWaitingTimeProvider interface {
+	WaitingTimeProvider
+	GetWaitingTimesForStops(ctx context.Context, stopCodes []string) (map[string]Response, error)
+}
+
+// StopRefresher is implemented by caching providers whose entries can be renewed
+// ahead of requests, which is what the background poller relies on.
+type StopRefresher interface {
+	RefreshStops(ctx context.Context, stopCodes []string) error
+}
+
+// HealthReporter is implemented by providers reporting statistics on the health endpoint.
+type HealthReporter interface {
+	Health() map[string]string
+}
+
+// NewProviderFromEnv builds the provider selected by the REALTIME_PROVIDER variable:
+// - "stib" (default): the STIB Opendatasoft API, authenticated with STIB_API_KEY.
+// STIB_API_URL overrides the datasets catalog (e.g. to target `cmd/stibmock`),
+// see ClientOptionsFromEnv for the timeout, retry and circuit breaker settings.
+// - "fixture": responses read from the file at REALTIME_FIXTURE_PATH
+// - "gtfsrt": the GTFS-Realtime TripUpdates feed at GTFSRT_FEED_URL,
+// see GTFSRTOptionsFromEnv for its settings
+func NewProviderFromEnv() (WaitingTimeProvider, error) {
+	switch p := os.Getenv("REALTIME_PROVIDER"); p {
+	case "", "stib":
+		opts, err := ClientOptionsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return NewSTIBClient(os.Getenv("STIB_API_URL"), os.Getenv("STIB_API_KEY"), opts), nil
+	case "fixture":
+		return LoadFixtureProvider(os.Getenv("REALTIME_FIXTURE_PATH"))
+	case "gtfsrt":
+		feedUrl := os.Getenv("GTFSRT_FEED_URL")
+		if feedUrl == "" {
+			return nil, fmt.Errorf("GTFSRT_FEED_URL is required by the gtfsrt provider")
+		}
+		opts, err := GTFSRTOptionsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return NewGTFSRTProvider(feedUrl, opts), nil
+	default:
+		return nil, fmt.Errorf("unknown real-time provider: %q", p)
+	}
+}
@@ -1,13 +1,17 @@
 package externalapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
-	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 
-	_ "github.com/joho/godotenv/autoload"
+	"golang.org/x/sync/singleflight"
 )
 
 type I18n struct {
@@ -32,6 +36,16 @@ func (p *PassingTimeList) UnmarshalJSON(data []byte) error {
 	return json.Unmarshal([]byte(raw), (*[]PassingTime)(p))
 }
 
+// MarshalJSON encodes the list back into a JSON string, so that cached
+// responses round-trip through UnmarshalJSON.
+func (p PassingTimeList) MarshalJSON() ([]byte, error) {
+	raw, err := json.Marshal([]PassingTime(p))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(raw))
+}
+
 type WaitingTime struct {
 	PointID      string          `json:"pointid"`
 	LineID       string          `json:"lineid"`
@@ -41,52 +55,284 @@ type WaitingTime struct {
 type Response struct {
 	TotalCount   int           `json:"total_count"`
 	WaitingTimes []WaitingTime `json:"results"`
+
+	// FetchedAt is when the data was retrieved from upstream.
+	FetchedAt time.Time `json:"-"`
+	// Stale is set when the data is older than the cache TTL, either because
+	// it is being refreshed in the background or because upstream is failing.
+	Stale bool `json:"-"`
 }
 
-const baseUrl = "https://data.stib-mivb.brussels/api/explore/v2.1/catalog/datasets/waiting-time-rt-production/records"
+// Stop codes are interpolated in the query, so anything else than
+// the alphanumeric codes of the network is rejected upfront.
+var validStopCode = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+// baseUrl is the Opendatasoft catalog of the STIB, each dataset lives under it.
+const baseUrl = "https://data.stib-mivb.brussels/api/explore/v2.1/catalog/datasets"
 
-func GetWaitingTimeForStop(stopCode string) (Response, error) {
+const waitingTimeDataset = "waiting-time-rt-production"
+
+// STIBClient fetches waiting times from the STIB Opendatasoft API.
+type STIBClient struct {
+	baseUrl    string
+	apiKey     string
+	httpClient *http.Client
+	cache      *Cache
+	opts       ClientOptions
+	breaker    *breaker
+	stats      clientStats
+
+	// refreshing holds the stop codes with a background refresh in progress
+	refreshing sync.Map
+	// inflight deduplicates the concurrent lookups of a stop missing from the cache
+	inflight singleflight.Group
+}
+
+// NewSTIBClient returns a client for the datasets catalog at url,
+// or for the production STIB catalog when url is empty.
+// The zero options are replaced by their defaults (see ClientOptions).
+func NewSTIBClient(url string, apiKey string, opts ClientOptions) *STIBClient {
+	if url == "" {
+		url = baseUrl
+	}
+	opts = opts.withDefaults()
+
+	return &STIBClient{
+		baseUrl: url,
+		apiKey:  apiKey,
+		// The per-attempt deadline comes from the request context,
+		// this timeout is only a safety net.
+		httpClient: &http.Client{Timeout: 2 * opts.Timeout},
+		cache:      opts.Cache,
+		opts:       opts,
+		breaker:    newBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+	}
+}
+
+func (c *STIBClient) GetWaitingTimeForStop(ctx context.Context, stopCode string) (Response, error) {
 	var result Response
 
-	if cacheValue, ok := GetFromCache(stopCode); ok {
-		if err := json.Unmarshal(cacheValue, &result); err != nil {
-			return result, fmt.Errorf("json decode failed: %w", err)
+	if !validStopCode.MatchString(stopCode) {
+		return result, fmt.Errorf("%w: %q", ErrStopUnknown, stopCode)
+	}
+
+	entry, state := c.cache.Get(stopCode)
+	if state != CacheMiss {
+		result, err := decodeCacheEntry(entry, state)
+		if err != nil {
+			return result, err
+		}
+		if state == CacheStale {
+			c.refreshInBackground([]string{stopCode})
 		}
 
 		return result, nil
 	}
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s?where=pointid=%s", baseUrl, stopCode), nil)
-	if err != nil {
-		return result, err
+	// Concurrent misses for the same stop share a single upstream request.
+	// It runs detached from the first caller's context so that caller going away
+	// doesn't fail the others; each caller still stops waiting when its own context ends.
+	ch := c.inflight.DoChan(stopCode, func() (any, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+		defer cancel()
+		return c.fetchStop(fetchCtx, stopCode)
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return result, res.Err
+		}
+		return res.Val.(Response), nil
+	case <-ctx.Done():
+		return result, ctx.Err()
 	}
+}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Apikey %s", os.Getenv("STIB_API_KEY")))
+func (c *STIBClient) fetchStop(ctx context.Context, stopCode string) (Response, error) {
+	var result Response
 
-	client := &http.Client{}
-	res, err := client.Do(req)
+	body, err := c.fetch(ctx, waitingTimeDataset, fmt.Sprintf("pointid=%q", stopCode), 0, 0)
 	if err != nil {
 		return result, err
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode >= 400 {
-		body, _ := io.ReadAll(res.Body)
-		return result, fmt.Errorf("server error: %s", string(body))
+	if err := json.Unmarshal(body, &result); err != nil {
+		return result, decodeError(err)
 	}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return result, fmt.Errorf("failed to read response body: %w", err)
+	c.cache.Set(stopCode, body)
+	result.FetchedAt = time.Now()
+
+	return result, nil
+}
+
+// GetWaitingTimesForStops fetches the waiting times of several stops with as few
+// upstream calls as possible: stops already in the cache are served from it and
+// the others are requested together with a `pointid in (...)` clause.
+// Every fetched stop is cached individually, so later single lookups are hits.
+func (c *STIBClient) GetWaitingTimesForStops(ctx context.Context, stopCodes []string) (map[string]Response, error) {
+	results := make(map[string]Response, len(stopCodes))
+	seen := make(map[string]bool, len(stopCodes))
+	var missing, stale []string
+
+	for _, code := range stopCodes {
+		if seen[code] || !validStopCode.MatchString(code) {
+			continue
+		}
+		seen[code] = true
+
+		entry, state := c.cache.Get(code)
+		if state == CacheMiss {
+			missing = append(missing, code)
+			continue
+		}
+
+		res, err := decodeCacheEntry(entry, state)
+		if err != nil {
+			return results, err
+		}
+		results[code] = res
+		if state == CacheStale {
+			stale = append(stale, code)
+		}
 	}
 
-	if res.StatusCode == 200 {
-		SetCache(stopCode, []byte(body))
+	c.refreshInBackground(stale)
+
+	fetched, err := c.fetchStops(ctx, missing)
+	for code, res := range fetched {
+		results[code] = res
 	}
 
-	if err := json.Unmarshal(body, &result); err != nil {
-		return result, fmt.Errorf("json decode failed: %w", err)
+	return results, err
+}
+
+// refreshTimeout bounds background refreshes, which outlive the request that triggered them.
+const refreshTimeout = 10 * time.Second
+
+// refreshInBackground renews stale entries without making the caller wait.
+// A stop already being refreshed is skipped; if the refresh fails the stale
+// entry is kept and served until it expires.
+func (c *STIBClient) refreshInBackground(stopCodes []string) {
+	var codes []string
+	for _, code := range stopCodes {
+		if _, loaded := c.refreshing.LoadOrStore(code, struct{}{}); !loaded {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return
 	}
 
+	go func() {
+		defer func() {
+			for _, code := range codes {
+				c.refreshing.Delete(code)
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+
+		if err := c.RefreshStops(ctx, codes); err != nil {
+			log.Printf("Background refresh of %d stop(s) failed, serving stale data: %v", len(codes), err)
+		}
+	}()
+}
+
+func decodeCacheEntry(entry CacheEntry, state CacheState) (Response, error) {
+	var result Response
+	if err := json.Unmarshal(entry.Data, &result); err != nil {
+		return result, decodeError(err)
+	}
+	result.FetchedAt = entry.FetchedAt
+	result.Stale = state == CacheStale
 	return result, nil
 }
+
+// RefreshStops fetches the stops from upstream even if they are cached,
+// so that the cache is renewed before their entries expire.
+func (c *STIBClient) RefreshStops(ctx context.Context, stopCodes []string) error {
+	_, err := c.fetchStops(ctx, stopCodes)
+	return err
+}
+
+// fetchStops requests the stops by batches of BatchSize and caches them one by one.
+func (c *STIBClient) fetchStops(ctx context.Context, codes []string) (map[string]Response, error) {
+	results := make(map[string]Response, len(codes))
+
+	stopCodes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		if validStopCode.MatchString(code) {
+			stopCodes = append(stopCodes, code)
+		}
+	}
+
+	for start := 0; start < len(stopCodes); start += BatchSize {
+		end := min(start+BatchSize, len(stopCodes))
+		chunk := stopCodes[start:end]
+
+		quoted := make([]string, len(chunk))
+		for i, code := range chunk {
+			quoted[i] = fmt.Sprintf("%q", code)
+		}
+
+		waitingTimes, err := c.fetchBatch(ctx, fmt.Sprintf("pointid in (%s)", strings.Join(quoted, ",")))
+		if err != nil {
+			return results, err
+		}
+
+		fetchedAt := time.Now()
+		for _, code := range chunk {
+			results[code] = Response{FetchedAt: fetchedAt}
+		}
+		for _, wt := range waitingTimes {
+			res := results[wt.PointID]
+			res.WaitingTimes = append(res.WaitingTimes, wt)
+			res.TotalCount = len(res.WaitingTimes)
+			results[wt.PointID] = res
+		}
+
+		for _, code := range chunk {
+			data, err := json.Marshal(results[code])
+			if err != nil {
+				return results, fmt.Errorf("json encode failed: %w", err)
+			}
+			c.cache.Set(code, data)
+		}
+	}
+
+	return results, nil
+}
+
+// fetchBatch pages through the records matching where until total_count of them are read,
+// so that the stops of a batch past the first page aren't cached as having no departures.
+func (c *STIBClient) fetchBatch(ctx context.Context, where string) ([]WaitingTime, error) {
+	var waitingTimes []WaitingTime
+
+	for {
+		body, err := c.fetch(ctx, waitingTimeDataset, where, batchLimit, len(waitingTimes))
+		if err != nil {
+			return nil, err
+		}
+
+		var page Response
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, decodeError(err)
+		}
+
+		waitingTimes = append(waitingTimes, page.WaitingTimes...)
+		if len(page.WaitingTimes) == 0 || len(waitingTimes) >= page.TotalCount {
+			return waitingTimes, nil
+		}
+	}
+}
+
+// A stop is served by a handful of lines at most, so a batch of stops
+// usually fits in one page of the records endpoint (capped at 100).
+// Busy stations may need a second one.
+const (
+	BatchSize  = 20
+	batchLimit = 100
+)
@@ -0,0 +1,277 @@
+package externalapi_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jp-roisin/catch-and-go/internal/externalapi"
+	"github.com/jp-roisin/catch-and-go/internal/externalapi/stibmock"
+)
+
+func TestSTIBClientGetWaitingTimeForStop(t *testing.T) {
+	srv, _ := stibmock.NewServer(stibmock.Scenario{
+		APIKey:  "secret",
+		Default: stibmock.Stop{Empty: true},
+		Stops: map[string]stibmock.Stop{
+			"8042": {WaitingTimes: []stibmock.WaitingTime{{
+				LineID: "5",
+				PassingTimes: []stibmock.PassingTime{
+					{Destination: stibmock.I18n{FR: "STOCKEL", NL: "STOKKEL"}, ExpectedArrivalTime: "3m", LineID: "5"},
+				},
+			}}},
+			"5710F": {WaitingTimes: []stibmock.WaitingTime{{
+				LineID: "1",
+				PassingTimes: []stibmock.PassingTime{
+					{Destination: stibmock.I18n{FR: "STOCKEL", NL: "STOKKEL"}, ExpectedArrivalTime: "5m", LineID: "1"},
+				},
+			}}},
+			"5000": {Status: 503, Body: "Service Unavailable"},
+			"5001": {Malformed: true},
+			"5002": {Latency: stibmock.Duration(time.Second)},
+		},
+	})
+	defer srv.Close()
+
+	client := externalapi.NewSTIBClient(srv.URL+stibmock.DatasetsPath, "secret", externalapi.ClientOptions{})
+
+	tests := []struct {
+		name      string
+		client    *externalapi.STIBClient
+		stopCode  string
+		timeout   time.Duration
+		wantErr   error
+		wantCount int
+	}{
+		{name: "passing times", client: client, stopCode: "8042", wantCount: 1},
+		{name: "lettered stop code", client: client, stopCode: "5710F", wantCount: 1},
+		{name: "unknown stop", client: client, stopCode: "9999", wantCount: 0},
+		{name: "invalid api key", client: externalapi.NewSTIBClient(srv.URL+stibmock.DatasetsPath, "wrong", externalapi.ClientOptions{}), stopCode: "4999", wantErr: externalapi.ErrUnauthorized},
+		{name: "upstream error", client: client, stopCode: "5000", wantErr: externalapi.ErrUpstreamUnavailable},
+		{name: "malformed json", client: client, stopCode: "5001", wantErr: externalapi.ErrDecode},
+		{name: "upstream too slow", client: client, stopCode: "5002", timeout: 50 * time.Millisecond, wantErr: context.DeadlineExceeded},
+		{name: "invalid stop code", client: client, stopCode: "1 OR 1=1", wantErr: externalapi.ErrStopUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			res, err := tt.client.GetWaitingTimeForStop(ctx, tt.stopCode)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetWaitingTimeForStop() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if len(res.WaitingTimes) != tt.wantCount {
+				t.Fatalf("GetWaitingTimeForStop() got %d waiting times, want %d", len(res.WaitingTimes), tt.wantCount)
+			}
+		})
+	}
+
+	res, _ := client.GetWaitingTimeForStop(context.Background(), "8042")
+	if got := res.WaitingTimes[0].PassingTimes[0].Destination.NL; got != "STOKKEL" {
+		t.Errorf("double-encoded passing times were not decoded, destination = %q", got)
+	}
+}
+
+func TestSTIBClientCoalescesConcurrentLookups(t *testing.T) {
+	srv, mock := stibmock.NewServer(stibmock.Scenario{
+		Stops: map[string]stibmock.Stop{
+			"8042": {
+				Latency: stibmock.Duration(100 * time.Millisecond),
+				WaitingTimes: []stibmock.WaitingTime{{
+					LineID: "1",
+					PassingTimes: []stibmock.PassingTime{
+						{Destination: stibmock.I18n{FR: "STOCKEL", NL: "STOKKEL"}, ExpectedArrivalTime: "2m", LineID: "1"},
+					},
+				}},
+			},
+		},
+	})
+	defer srv.Close()
+
+	client := externalapi.NewSTIBClient(srv.URL+stibmock.DatasetsPath, "", externalapi.ClientOptions{})
+
+	const callers = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := client.GetWaitingTimeForStop(context.Background(), "8042")
+			if err == nil && len(res.WaitingTimes) != 1 {
+				err = fmt.Errorf("got %d waiting times, want 1", len(res.WaitingTimes))
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("GetWaitingTimeForStop() error = %v", err)
+		}
+	}
+
+	if n := mock.Requests("8042"); n != 1 {
+		t.Errorf("expected %d concurrent callers to share one upstream request, got %d requests", callers, n)
+	}
+}
+
+func TestSTIBClientBatchPagesThroughResults(t *testing.T) {
+	// A busy station: 6 lines at each of its 20 stops don't fit in one page of 100
+	var lines []stibmock.WaitingTime
+	for i := 1; i <= 6; i++ {
+		lines = append(lines, stibmock.WaitingTime{LineID: fmt.Sprint(i)})
+	}
+	srv, mock := stibmock.NewServer(stibmock.Scenario{Default: stibmock.Stop{WaitingTimes: lines}})
+	defer srv.Close()
+
+	client := externalapi.NewSTIBClient(srv.URL+stibmock.DatasetsPath, "", externalapi.ClientOptions{})
+
+	var codes []string
+	for i := range externalapi.BatchSize {
+		codes = append(codes, fmt.Sprint(7000+i))
+	}
+
+	results, err := client.GetWaitingTimesForStops(context.Background(), codes)
+	if err != nil {
+		t.Fatalf("GetWaitingTimesForStops() error = %v", err)
+	}
+	for _, code := range codes {
+		if n := len(results[code].WaitingTimes); n != len(lines) {
+			t.Errorf("stop %s has %d waiting times, want %d", code, n, len(lines))
+		}
+	}
+	if calls := mock.Calls(); calls != 2 {
+		t.Errorf("expected the batch to be read in 2 pages, got %d calls", calls)
+	}
+
+	// The cached entries are complete too
+	res, err := client.GetWaitingTimeForStop(context.Background(), codes[len(codes)-1])
+	if err != nil || len(res.WaitingTimes) != len(lines) {
+		t.Errorf("cached stop has %d waiting times (error %v), want %d", len(res.WaitingTimes), err, len(lines))
+	}
+}
+
+func TestSTIBClientRetriesAndCircuitBreaker(t *testing.T) {
+	srv, mock := stibmock.NewServer(stibmock.Scenario{
+		Stops: map[string]stibmock.Stop{
+			"6001": {Status: 503, FailRequests: 1, WaitingTimes: []stibmock.WaitingTime{{LineID: "1"}}},
+			"6002": {Status: 429, RetryAfter: "3600"},
+			"6003": {Status: 502},
+		},
+	})
+	defer srv.Close()
+
+	client := externalapi.NewSTIBClient(srv.URL+stibmock.DatasetsPath, "", externalapi.ClientOptions{
+		MaxRetries:       2,
+		RetryBaseDelay:   time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	})
+	ctx := context.Background()
+
+	if _, err := client.GetWaitingTimeForStop(ctx, "6001"); err != nil {
+		t.Errorf("expected a transient 503 to be retried, got %v", err)
+	}
+
+	if _, err := client.GetWaitingTimeForStop(ctx, "6002"); err == nil {
+		t.Error("expected an error when Retry-After exceeds the maximum delay")
+	}
+	if n := mock.Requests("6002"); n != 1 {
+		t.Errorf("expected no retry past the maximum delay, got %d requests", n)
+	}
+
+	if _, err := client.GetWaitingTimeForStop(ctx, "6003"); err == nil {
+		t.Error("expected an error after exhausting the retries")
+	}
+	if n := mock.Requests("6003"); n != 3 {
+		t.Errorf("expected 1 attempt and 2 retries, got %d requests", n)
+	}
+
+	// Two failed calls in a row: the breaker is open and upstream isn't called anymore
+	calls := mock.Calls()
+	if _, err := client.GetWaitingTimeForStop(ctx, "6004"); !errors.Is(err, externalapi.ErrCircuitOpen) {
+		t.Errorf("expected the circuit breaker to be open, got %v", err)
+	}
+	if mock.Calls() != calls {
+		t.Error("expected the open circuit breaker to short-circuit upstream")
+	}
+	if state := client.Health()["stib_breaker"]; state != "open" {
+		t.Errorf("Health() breaker state = %q, want open", state)
+	}
+}
+
+func TestClientOptionsFromEnvMaxRetries(t *testing.T) {
+	srv, mock := stibmock.NewServer(stibmock.Scenario{Default: stibmock.Stop{Status: 503}})
+	defer srv.Close()
+
+	tests := []struct {
+		env      string
+		requests int
+	}{
+		{env: "", requests: 3}, // the default of 2 retries
+		{env: "0", requests: 1},
+		{env: "1", requests: 2},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("STIB_MAX_RETRIES=%q", tt.env), func(t *testing.T) {
+			t.Setenv("STIB_MAX_RETRIES", tt.env)
+			opts, err := externalapi.ClientOptionsFromEnv()
+			if err != nil {
+				t.Fatalf("ClientOptionsFromEnv() error = %v", err)
+			}
+			opts.RetryBaseDelay = time.Millisecond
+
+			code := fmt.Sprint(7000 + i)
+			client := externalapi.NewSTIBClient(srv.URL+stibmock.DatasetsPath, "", opts)
+			if _, err := client.GetWaitingTimeForStop(context.Background(), code); !errors.Is(err, externalapi.ErrUpstreamUnavailable) {
+				t.Fatalf("GetWaitingTimeForStop() error = %v, want %v", err, externalapi.ErrUpstreamUnavailable)
+			}
+			if n := mock.Requests(code); n != tt.requests {
+				t.Errorf("got %d requests, want %d", n, tt.requests)
+			}
+		})
+	}
+}
+
+func TestSTIBClientGetDisruptions(t *testing.T) {
+	srv, _ := stibmock.NewServer(stibmock.Scenario{
+		TravellerMessages: []stibmock.TravellerMessage{
+			{Text: stibmock.I18n{FR: "Arrêt déplacé", NL: "Halte verplaatst"}, Stops: []string{"8042"}, Priority: 1},
+			{Text: stibmock.I18n{FR: "Travaux", NL: "Werken"}, Lines: []string{"5"}, Priority: 5},
+			{Text: stibmock.I18n{FR: "Manifestation", NL: "Betoging"}, Lines: []string{"71"}},
+		},
+	})
+	defer srv.Close()
+
+	client := externalapi.NewSTIBClient(srv.URL+stibmock.DatasetsPath, "", externalapi.ClientOptions{})
+
+	d, err := client.GetDisruptions(context.Background())
+	if err != nil {
+		t.Fatalf("GetDisruptions() error = %v", err)
+	}
+
+	messages := d.ForStop("8042", []string{"1", "5"})
+	if len(messages) != 2 {
+		t.Fatalf("ForStop() returned %d messages, want 2", len(messages))
+	}
+	if messages[0].Text.NL != "Werken" || messages[1].Text.NL != "Halte verplaatst" {
+		t.Errorf("ForStop() = %+v, want the messages by decreasing priority", messages)
+	}
+}
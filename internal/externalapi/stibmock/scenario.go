@@ -0,0 +1,150 @@
+package stibmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Scenario describes how the stand-in server answers, stop by stop.
+//
+// Example:
+//
+//	{
+//	  "api_key": "secret",
+//	  "default": { "empty": true },
+//	  "stops": {
+//	    "8042": {
+//	      "latency": "300ms",
+//	      "waiting_times": [
+//	        {
+//	          "lineid": "5",
+//	          "passingtimes": [
+//	            { "destination": { "fr": "STOCKEL", "nl": "STOKKEL" }, "expectedArrivalTime": "4m", "lineId": "5" }
+//	          ]
+//	        }
+//	      ]
+//	    },
+//	    "1234": { "status": 503, "body": "Service Unavailable" },
+//	    "6666": { "malformed": true }
+//	  },
+//	  "traveller_messages": [
+//	    { "text": { "fr": "Travaux", "nl": "Werken" }, "lines": ["5"], "stops": ["8042"], "priority": 3 }
+//	  ],
+//	  "vehicle_positions": {
+//	    "5": [{ "directionId": "8731", "distanceFromPoint": 120, "pointId": "8042" }]
+//	  }
+//	}
+type Scenario struct {
+	// APIKey, when set, is required in the `Authorization: Apikey <key>` header.
+	// Requests without it are answered with a 401.
+	APIKey string `json:"api_key"`
+	// Default applies to every stop missing from Stops.
+	Default Stop `json:"default"`
+	// Stops are keyed by stop code (the `pointid` of the real API).
+	Stops map[string]Stop `json:"stops"`
+	// TravellerMessages are the disruptions currently published.
+	TravellerMessages []TravellerMessage `json:"traveller_messages"`
+	// VehiclePositions are keyed by line code (the `lineid` of the real API).
+	VehiclePositions map[string][]VehiclePosition `json:"vehicle_positions"`
+}
+
+// VehiclePosition is a vehicle heading to the DirectionID terminus,
+// DistanceFromPoint meters after the PointID stop.
+type VehiclePosition struct {
+	DirectionID       string `json:"directionId"`
+	DistanceFromPoint int    `json:"distanceFromPoint"`
+	PointID           string `json:"pointId"`
+}
+
+// TravellerMessage is a disruption affecting lines and/or stops.
+type TravellerMessage struct {
+	Text     I18n     `json:"text"`
+	Lines    []string `json:"lines"`
+	Stops    []string `json:"stops"`
+	Priority int      `json:"priority"`
+}
+
+// Stop is the behaviour of the server for a single stop code.
+type Stop struct {
+	// Latency delays the response.
+	Latency Duration `json:"latency"`
+	// Status, when >= 400, replaces the response with an error carrying Body.
+	Status int    `json:"status"`
+	Body   string `json:"body"`
+	// FailRequests limits the error Status to the first N requests for the stop,
+	// the following ones succeed. 0 means every request fails.
+	FailRequests int `json:"fail_requests"`
+	// RetryAfter is sent as the Retry-After header of error responses (e.g. "2").
+	RetryAfter string `json:"retry_after"`
+	// Malformed answers with a truncated JSON document.
+	Malformed bool `json:"malformed"`
+	// Empty answers with no results, like the real API does for unknown stops.
+	Empty        bool          `json:"empty"`
+	WaitingTimes []WaitingTime `json:"waiting_times"`
+}
+
+type WaitingTime struct {
+	LineID       string        `json:"lineid"`
+	PassingTimes []PassingTime `json:"passingtimes"`
+}
+
+type PassingTime struct {
+	Destination I18n `json:"destination"`
+	// ExpectedArrivalTime is either an RFC3339 timestamp or a duration relative to
+	// the time of the request (e.g. "4m"), so scenarios don't go stale.
+	ExpectedArrivalTime string `json:"expectedArrivalTime"`
+	LineID              string `json:"lineId"`
+}
+
+type I18n struct {
+	FR string `json:"fr"`
+	NL string `json:"nl"`
+}
+
+// Duration is a time.Duration read from a string like "250ms".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadScenario reads a scenario from a JSON file.
+func LoadScenario(path string) (Scenario, error) {
+	var s Scenario
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, fmt.Errorf("failed to read scenario file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+func (s Scenario) stop(code string) Stop {
+	if st, ok := s.Stops[code]; ok {
+		return st
+	}
+	return s.Default
+}
+
+func (pt PassingTime) resolve(now time.Time) PassingTime {
+	if d, err := time.ParseDuration(pt.ExpectedArrivalTime); err == nil {
+		pt.ExpectedArrivalTime = now.Add(d).Format(time.RFC3339)
+	}
+	return pt
+}
@@ -0,0 +1,325 @@
+// Package stibmock is a local stand-in for the STIB Opendatasoft
+// real-time datasets, driven by scenario files.
+// Both `where=pointid="X"` and batched `where=pointid in ("X","Y")` lookups are supported,
+// paged with `limit` and `offset`,
+// as well as the `travellers-information-rt-production` disruption messages
+// and the `vehicle-position-rt-production` positions, looked up with `where=lineid="X"`.
+// It backs the `cmd/stibmock` binary and can be started in tests with NewServer.
+package stibmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DatasetsPath is where the catalog is served, like on the real API.
+const DatasetsPath = "/api/explore/v2.1/catalog/datasets"
+
+var (
+	// Like ODSQL, values must be quoted: an unquoted one would be read as a field name
+	wherePointID   = regexp.MustCompile(`^pointid\s*=\s*"([a-zA-Z0-9]+)"$`)
+	wherePointIDIn = regexp.MustCompile(`^pointid\s+in\s*\((.*)\)$`)
+	whereLineID    = regexp.MustCompile(`^lineid\s*=\s*"([a-zA-Z0-9]+)"$`)
+)
+
+type record struct {
+	PointID      string `json:"pointid"`
+	LineID       string `json:"lineid"`
+	PassingTimes string `json:"passingtimes"` // JSON-encoded list, like the real API
+}
+
+type response struct {
+	TotalCount int      `json:"total_count"`
+	Results    []record `json:"results"`
+}
+
+// Handler serves a scenario and counts the requests it receives per stop code.
+type Handler struct {
+	mu       sync.Mutex
+	scenario Scenario
+	requests map[string]int
+	calls    int
+	now      func() time.Time
+}
+
+func NewHandler(scenario Scenario) *Handler {
+	return &Handler{
+		scenario: scenario,
+		requests: make(map[string]int),
+		now:      time.Now,
+	}
+}
+
+// NewServer starts an httptest server for the scenario. The returned server's
+// URL + DatasetsPath is a drop-in base URL for the STIB client.
+func NewServer(scenario Scenario) (*httptest.Server, *Handler) {
+	h := NewHandler(scenario)
+	return httptest.NewServer(h), h
+}
+
+// SetScenario replaces the scenario served from now on.
+func (h *Handler) SetScenario(scenario Scenario) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.scenario = scenario
+}
+
+// Requests returns how many times a stop code has been requested.
+func (h *Handler) Requests(code string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.requests[code]
+}
+
+// Calls returns how many waiting time requests have been answered, batched or not.
+func (h *Handler) Calls() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.calls
+}
+
+// parseWhere extracts the stop codes from `pointid="X"` or `pointid in ("X","Y")`.
+func parseWhere(where string) ([]string, bool) {
+	where = strings.TrimSpace(where)
+
+	if m := wherePointID.FindStringSubmatch(where); m != nil {
+		return []string{m[1]}, true
+	}
+
+	m := wherePointIDIn.FindStringSubmatch(where)
+	if m == nil {
+		return nil, false
+	}
+
+	var codes []string
+	for _, c := range strings.Split(m[1], ",") {
+		c = strings.TrimSpace(c)
+		if len(c) < 2 || c[0] != '"' || c[len(c)-1] != '"' {
+			return nil, false
+		}
+		code := c[1 : len(c)-1]
+		if code == "" {
+			return nil, false
+		}
+		codes = append(codes, code)
+	}
+	return codes, len(codes) > 0
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+
+	h.mu.Lock()
+	scenario := h.scenario
+	h.mu.Unlock()
+
+	if scenario.APIKey != "" && r.Header.Get("Authorization") != fmt.Sprintf("Apikey %s", scenario.APIKey) {
+		writeError(w, http.StatusUnauthorized, `{"error_code": "InvalidAPIKey", "message": "Invalid API key"}`)
+		return
+	}
+
+	switch r.URL.Path {
+	case DatasetsPath + "/waiting-time-rt-production/records":
+		h.serveWaitingTimes(w, r, scenario)
+	case DatasetsPath + "/travellers-information-rt-production/records":
+		h.serveTravellerInformation(w, scenario)
+	case DatasetsPath + "/vehicle-position-rt-production/records":
+		h.serveVehiclePositions(w, r, scenario)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) serveWaitingTimes(w http.ResponseWriter, r *http.Request, scenario Scenario) {
+	codes, ok := parseWhere(r.URL.Query().Get("where"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, `{"error_code": "ODSQLError", "message": "unsupported where clause"}`)
+		return
+	}
+
+	h.mu.Lock()
+	h.calls++
+	seen := make(map[string]int, len(codes))
+	for _, code := range codes {
+		h.requests[code]++
+		seen[code] = h.requests[code]
+	}
+	h.mu.Unlock()
+
+	// A batched request behaves like its slowest and first failing stop.
+	var latency time.Duration
+	for _, code := range codes {
+		latency = max(latency, time.Duration(scenario.stop(code).Latency))
+	}
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	res := response{Results: []record{}}
+	now := h.now()
+	for _, code := range codes {
+		stop := scenario.stop(code)
+
+		if stop.Status >= 400 && (stop.FailRequests == 0 || seen[code] <= stop.FailRequests) {
+			if stop.RetryAfter != "" {
+				w.Header().Set("Retry-After", stop.RetryAfter)
+			}
+			writeError(w, stop.Status, stop.Body)
+			return
+		}
+
+		if stop.Malformed {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, `{"total_count": 1, "results": [{"pointid": "`)
+			return
+		}
+
+		if stop.Empty {
+			continue
+		}
+
+		for _, wt := range stop.WaitingTimes {
+			rec, err := newRecord(code, wt, now)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			res.Results = append(res.Results, rec)
+		}
+	}
+	res.TotalCount = len(res.Results)
+	res.Results = page(res.Results, r.URL.Query())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// page applies the limit and offset parameters to the records, total_count
+// keeps counting all of them like on the real API.
+// Without a limit every record is returned.
+func page(records []record, query url.Values) []record {
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	records = records[min(max(offset, 0), len(records)):]
+
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit >= 0 {
+		records = records[:min(limit, len(records))]
+	}
+	return records
+}
+
+func newRecord(code string, wt WaitingTime, now time.Time) (record, error) {
+	passingTimes := make([]PassingTime, 0, len(wt.PassingTimes))
+	for _, pt := range wt.PassingTimes {
+		passingTimes = append(passingTimes, pt.resolve(now))
+	}
+
+	encoded, err := json.Marshal(passingTimes)
+	if err != nil {
+		return record{}, err
+	}
+
+	return record{
+		PointID:      code,
+		LineID:       wt.LineID,
+		PassingTimes: string(encoded),
+	}, nil
+}
+
+type travellerRecord struct {
+	Content  string `json:"content"` // JSON-encoded, like the real API
+	Lines    string `json:"lines"`
+	Points   string `json:"points"`
+	Priority int    `json:"priority"`
+	Type     string `json:"type"`
+}
+
+type travellerContent struct {
+	Text []I18n `json:"text"`
+	Type string `json:"type"`
+}
+
+type idRef struct {
+	ID string `json:"id"`
+}
+
+func (h *Handler) serveTravellerInformation(w http.ResponseWriter, scenario Scenario) {
+	records := []travellerRecord{}
+	for _, m := range scenario.TravellerMessages {
+		content, _ := json.Marshal([]travellerContent{{Text: []I18n{m.Text}, Type: "Description"}})
+
+		lines := make([]idRef, 0, len(m.Lines))
+		for _, l := range m.Lines {
+			lines = append(lines, idRef{ID: l})
+		}
+		encodedLines, _ := json.Marshal(lines)
+
+		points := make([]idRef, 0, len(m.Stops))
+		for _, p := range m.Stops {
+			points = append(points, idRef{ID: p})
+		}
+		encodedPoints, _ := json.Marshal(points)
+
+		records = append(records, travellerRecord{
+			Content:  string(content),
+			Lines:    string(encodedLines),
+			Points:   string(encodedPoints),
+			Priority: m.Priority,
+			Type:     "LongText",
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"total_count": len(records),
+		"results":     records,
+	})
+}
+
+type vehiclePositionRecord struct {
+	LineID           string `json:"lineid"`
+	VehiclePositions string `json:"vehiclepositions"` // JSON-encoded, like the real API
+}
+
+func (h *Handler) serveVehiclePositions(w http.ResponseWriter, r *http.Request, scenario Scenario) {
+	m := whereLineID.FindStringSubmatch(strings.TrimSpace(r.URL.Query().Get("where")))
+	if m == nil {
+		writeError(w, http.StatusBadRequest, `{"error_code": "ODSQLError", "message": "unsupported where clause"}`)
+		return
+	}
+
+	records := []vehiclePositionRecord{}
+	if positions, ok := scenario.VehiclePositions[m[1]]; ok {
+		encoded, _ := json.Marshal(positions)
+		records = append(records, vehiclePositionRecord{
+			LineID:           m[1],
+			VehiclePositions: string(encoded),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"total_count": len(records),
+		"results":     records,
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, body string) {
+	w.WriteHeader(status)
+	fmt.Fprint(w, body)
+}
@@ -0,0 +1,229 @@
+package externalapi
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+)
+
+const travellerInformationDataset = "travellers-information-rt-production"
+
+// Message is a piece of traveller information, typically a disruption,
+// affecting some lines and/or stops.
+type Message struct {
+	Text     I18n
+	Priority int
+	Lines    []string
+	Stops    []string
+}
+
+// Disruptions indexes the active messages by line code and by stop code.
+type Disruptions struct {
+	FetchedAt time.Time
+	Stale     bool
+
+	messages []Message
+	byLine   map[string][]int
+	byStop   map[string][]int
+}
+
+func NewDisruptions(messages []Message) Disruptions {
+	d := Disruptions{
+		messages: messages,
+		byLine:   make(map[string][]int),
+		byStop:   make(map[string][]int),
+	}
+	for i, m := range messages {
+		for _, l := range m.Lines {
+			d.byLine[l] = append(d.byLine[l], i)
+		}
+		for _, s := range m.Stops {
+			d.byStop[s] = append(d.byStop[s], i)
+		}
+	}
+	return d
+}
+
+// ForStop returns the messages affecting a stop or one of the lines passing through it,
+// most important first.
+func (d Disruptions) ForStop(stopCode string, lineCodes []string) []Message {
+	seen := make(map[int]bool)
+	for _, i := range d.byStop[stopCode] {
+		seen[i] = true
+	}
+	for _, l := range lineCodes {
+		for _, i := range d.byLine[l] {
+			seen[i] = true
+		}
+	}
+
+	indexes := make([]int, 0, len(seen))
+	for i := range seen {
+		indexes = append(indexes, i)
+	}
+	sort.Slice(indexes, func(a, b int) bool {
+		if d.messages[indexes[a]].Priority != d.messages[indexes[b]].Priority {
+			return d.messages[indexes[a]].Priority > d.messages[indexes[b]].Priority
+		}
+		return indexes[a] < indexes[b]
+	})
+
+	messages := make([]Message, 0, len(indexes))
+	for _, i := range indexes {
+		messages = append(messages, d.messages[i])
+	}
+	return messages
+}
+
+// TravellerInformationProvider is implemented by providers that also publish
+// service disruptions.
+type TravellerInformationProvider interface {
+	GetDisruptions(ctx context.Context) (Disruptions, error)
+}
+
+// The lines, points and content fields are JSON-encoded strings, like `passingtimes`.
+type travellerRecord struct {
+	Content  jsonString `json:"content"`
+	Lines    jsonString `json:"lines"`
+	Points   jsonString `json:"points"`
+	Priority int        `json:"priority"`
+}
+
+type travellerResponse struct {
+	Results []travellerRecord `json:"results"`
+}
+
+type jsonString string
+
+func (s *jsonString) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = jsonString(raw)
+	return nil
+}
+
+type idRef struct {
+	ID string `json:"id"`
+}
+
+func parseTravellerInformation(body []byte) ([]Message, error) {
+	var res travellerResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, decodeError(err)
+	}
+
+	messages := make([]Message, 0, len(res.Results))
+	for _, r := range res.Results {
+		var content []struct {
+			Text []I18n `json:"text"`
+		}
+		if err := json.Unmarshal([]byte(r.Content), &content); err != nil {
+			return nil, decodeError(err)
+		}
+
+		var lines, points []idRef
+		if r.Lines != "" {
+			if err := json.Unmarshal([]byte(r.Lines), &lines); err != nil {
+				return nil, decodeError(err)
+			}
+		}
+		if r.Points != "" {
+			if err := json.Unmarshal([]byte(r.Points), &points); err != nil {
+				return nil, decodeError(err)
+			}
+		}
+
+		m := Message{Priority: r.Priority}
+		if len(content) > 0 && len(content[0].Text) > 0 {
+			m.Text = content[0].Text[0]
+		}
+		for _, l := range lines {
+			m.Lines = append(m.Lines, l.ID)
+		}
+		for _, p := range points {
+			m.Stops = append(m.Stops, p.ID)
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, nil
+}
+
+// The dataset holds a few dozen messages at most, they fit in one page.
+const travellerInformationLimit = 100
+
+// GetDisruptions returns the active traveller information messages. The whole
+// dataset is fetched at once and cached under a single key, with the same
+// stale-while-revalidate semantics as the waiting times.
+func (c *STIBClient) GetDisruptions(ctx context.Context) (Disruptions, error) {
+	entry, state := c.cache.Get(travellerInformationDataset)
+	if state != CacheMiss {
+		messages, err := parseTravellerInformation(entry.Data)
+		if err != nil {
+			return Disruptions{}, err
+		}
+		if state == CacheStale {
+			c.refreshDisruptionsInBackground()
+		}
+
+		d := NewDisruptions(messages)
+		d.FetchedAt = entry.FetchedAt
+		d.Stale = state == CacheStale
+		return d, nil
+	}
+
+	ch := c.inflight.DoChan(travellerInformationDataset, func() (any, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+		defer cancel()
+		return c.fetchDisruptions(fetchCtx)
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return Disruptions{}, res.Err
+		}
+		return res.Val.(Disruptions), nil
+	case <-ctx.Done():
+		return Disruptions{}, ctx.Err()
+	}
+}
+
+func (c *STIBClient) fetchDisruptions(ctx context.Context) (Disruptions, error) {
+	body, err := c.fetch(ctx, travellerInformationDataset, "", travellerInformationLimit, 0)
+	if err != nil {
+		return Disruptions{}, err
+	}
+
+	messages, err := parseTravellerInformation(body)
+	if err != nil {
+		return Disruptions{}, err
+	}
+
+	c.cache.Set(travellerInformationDataset, body)
+
+	d := NewDisruptions(messages)
+	d.FetchedAt = time.Now()
+	return d, nil
+}
+
+func (c *STIBClient) refreshDisruptionsInBackground() {
+	if _, loaded := c.refreshing.LoadOrStore(travellerInformationDataset, struct{}{}); loaded {
+		return
+	}
+
+	go func() {
+		defer c.refreshing.Delete(travellerInformationDataset)
+
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+
+		if _, err := c.fetchDisruptions(ctx); err != nil {
+			log.Printf("Background refresh of the traveller information failed, serving stale data: %v", err)
+		}
+	}()
+}
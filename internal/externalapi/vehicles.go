@@ -0,0 +1,158 @@
+package externalapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+const vehiclePositionDataset = "vehicle-position-rt-production"
+
+// VehiclePosition locates a vehicle by the last stop it passed.
+// DirectionID is the code of the terminus the vehicle is heading to and
+// DistanceFromPoint how far it went since PointID, in meters (0 when it stands at the stop).
+type VehiclePosition struct {
+	DirectionID       string `json:"directionId"`
+	DistanceFromPoint int    `json:"distanceFromPoint"`
+	PointID           string `json:"pointId"`
+}
+
+// VehiclePositions are the vehicles currently running on a line, in both directions.
+type VehiclePositions struct {
+	LineID   string
+	Vehicles []VehiclePosition
+
+	FetchedAt time.Time
+	Stale     bool
+}
+
+// Towards returns the vehicles heading to the given terminus.
+func (v VehiclePositions) Towards(terminusCode string) []VehiclePosition {
+	var vehicles []VehiclePosition
+	for _, p := range v.Vehicles {
+		if p.DirectionID == terminusCode {
+			vehicles = append(vehicles, p)
+		}
+	}
+	return vehicles
+}
+
+// VehiclePositionProvider is implemented by providers that also publish
+// where the vehicles of a line are.
+type VehiclePositionProvider interface {
+	GetVehiclePositions(ctx context.Context, lineCode string) (VehiclePositions, error)
+}
+
+// The vehiclepositions field is a JSON-encoded string, like `passingtimes`.
+type vehiclePositionRecord struct {
+	LineID           string     `json:"lineid"`
+	VehiclePositions jsonString `json:"vehiclepositions"`
+}
+
+type vehiclePositionResponse struct {
+	Results []vehiclePositionRecord `json:"results"`
+}
+
+func parseVehiclePositions(lineCode string, body []byte) (VehiclePositions, error) {
+	result := VehiclePositions{LineID: lineCode}
+
+	var res vehiclePositionResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return result, decodeError(err)
+	}
+
+	for _, r := range res.Results {
+		if r.VehiclePositions == "" {
+			continue
+		}
+		var positions []VehiclePosition
+		if err := json.Unmarshal([]byte(r.VehiclePositions), &positions); err != nil {
+			return result, decodeError(err)
+		}
+		result.Vehicles = append(result.Vehicles, positions...)
+	}
+
+	return result, nil
+}
+
+func vehiclePositionKey(lineCode string) string {
+	return fmt.Sprintf("%s:%s", vehiclePositionDataset, lineCode)
+}
+
+// GetVehiclePositions returns the vehicles running on a line. Positions are cached
+// per line with the same stale-while-revalidate semantics as the waiting times.
+func (c *STIBClient) GetVehiclePositions(ctx context.Context, lineCode string) (VehiclePositions, error) {
+	// Line codes are interpolated in the query just like stop codes.
+	if !validStopCode.MatchString(lineCode) {
+		return VehiclePositions{}, fmt.Errorf("invalid line code: %q", lineCode)
+	}
+
+	key := vehiclePositionKey(lineCode)
+	entry, state := c.cache.Get(key)
+	if state != CacheMiss {
+		result, err := parseVehiclePositions(lineCode, entry.Data)
+		if err != nil {
+			return result, err
+		}
+		if state == CacheStale {
+			c.refreshVehiclePositionsInBackground(lineCode)
+		}
+
+		result.FetchedAt = entry.FetchedAt
+		result.Stale = state == CacheStale
+		return result, nil
+	}
+
+	ch := c.inflight.DoChan(key, func() (any, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+		defer cancel()
+		return c.fetchVehiclePositions(fetchCtx, lineCode)
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return VehiclePositions{}, res.Err
+		}
+		return res.Val.(VehiclePositions), nil
+	case <-ctx.Done():
+		return VehiclePositions{}, ctx.Err()
+	}
+}
+
+func (c *STIBClient) fetchVehiclePositions(ctx context.Context, lineCode string) (VehiclePositions, error) {
+	body, err := c.fetch(ctx, vehiclePositionDataset, fmt.Sprintf("lineid=%q", lineCode), 0, 0)
+	if err != nil {
+		return VehiclePositions{}, err
+	}
+
+	result, err := parseVehiclePositions(lineCode, body)
+	if err != nil {
+		return result, err
+	}
+
+	c.cache.Set(vehiclePositionKey(lineCode), body)
+	result.FetchedAt = time.Now()
+
+	return result, nil
+}
+
+func (c *STIBClient) refreshVehiclePositionsInBackground(lineCode string) {
+	key := vehiclePositionKey(lineCode)
+	if _, loaded := c.refreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+
+	go func() {
+		defer c.refreshing.Delete(key)
+
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+
+		if _, err := c.fetchVehiclePositions(ctx, lineCode); err != nil {
+			log.Printf("Background refresh of the vehicles of line %s failed, serving stale data: %v", lineCode, err)
+		}
+	}()
+}
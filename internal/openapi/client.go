@@ -0,0 +1,623 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ClientOptions configures the generated client.
+type ClientOptions struct {
+	// Package is the name of the generated package.
+	Package string
+	// Source is where the document is read from, named in the generated header.
+	Source string
+	// ErrorSchema is the schema of the error responses, decoded into the
+	// ResponseError returned for them.
+	ErrorSchema string
+}
+
+// GenerateClient writes a Go client for the operations of a document that speak
+// JSON, or nothing at all. The others, like the HTML fragments of the htmx
+// front-end, are left out.
+//
+// Only the part of OpenAPI the server uses is supported: the operations take
+// path and query parameters of scalar types and a JSON body referring to a
+// schema, the schemas are objects of scalars, arrays and references.
+func GenerateClient(doc *Document, opts ClientOptions) ([]byte, error) {
+	g := &clientGenerator{doc: doc, opts: opts, imports: map[string]bool{}}
+	if err := g.generate(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by cmd/openapi from %s. DO NOT EDIT.\n\n", opts.Source)
+	fmt.Fprintf(&out, "package %s\n\n", opts.Package)
+	out.WriteString("import (\n")
+	imports := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		imports = append(imports, path)
+	}
+	slices.Sort(imports)
+	for _, path := range imports {
+		fmt.Fprintf(&out, "\t%q\n", path)
+	}
+	out.WriteString(")\n")
+	out.Write(g.body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting the generated client: %w", err)
+	}
+	return src, nil
+}
+
+type clientGenerator struct {
+	doc     *Document
+	opts    ClientOptions
+	imports map[string]bool
+	body    bytes.Buffer
+}
+
+// operation is an operation of the document and where it is served.
+type operation struct {
+	*Operation
+	method string
+	path   string
+}
+
+func (g *clientGenerator) use(path string) {
+	g.imports[path] = true
+}
+
+func (g *clientGenerator) generate() error {
+	g.runtime()
+
+	names := make([]string, 0, len(g.doc.Components.Schemas))
+	for name := range g.doc.Components.Schemas {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if err := g.schemaType(name, g.doc.Components.Schemas[name]); err != nil {
+			return fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+
+	for _, op := range g.operations() {
+		if err := g.operation(op); err != nil {
+			return fmt.Errorf("operation %s: %w", op.OperationID, err)
+		}
+	}
+	return nil
+}
+
+// operations returns the JSON operations of the document, by path and method.
+func (g *clientGenerator) operations() []operation {
+	paths := make([]string, 0, len(g.doc.Paths))
+	for path := range g.doc.Paths {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	var ops []operation
+	for _, path := range paths {
+		item := *g.doc.Paths[path]
+		methods := make([]string, 0, len(item))
+		for method := range item {
+			methods = append(methods, method)
+		}
+		slices.Sort(methods)
+		for _, method := range methods {
+			op := operation{Operation: item[method], method: strings.ToUpper(method), path: path}
+			if _, _, ok := successResponse(op.Operation); ok {
+				ops = append(ops, op)
+			}
+		}
+	}
+	return ops
+}
+
+// successResponse returns the schema of the 2xx response of an operation, nil
+// when it has no content. It isn't ok when the response isn't JSON.
+func successResponse(op *Operation) (string, *Schema, bool) {
+	statuses := make([]string, 0, len(op.Responses))
+	for status := range op.Responses {
+		statuses = append(statuses, status)
+	}
+	slices.Sort(statuses)
+
+	for _, status := range statuses {
+		if !strings.HasPrefix(status, "2") {
+			continue
+		}
+		res := op.Responses[status]
+		if len(res.Content) == 0 {
+			return status, nil, true
+		}
+		media, ok := res.Content["application/json"]
+		return status, media.Schema, ok
+	}
+	return "", nil, false
+}
+
+func (g *clientGenerator) runtime() {
+	g.use("bytes")
+	g.use("context")
+	g.use("encoding/json")
+	g.use("fmt")
+	g.use("net/http")
+	g.use("net/url")
+
+	title := g.doc.Info.Title
+	fmt.Fprintf(&g.body, `
+// Client calls the %s, version %s.
+type Client struct {
+	// BaseURL is where the server is reached, like "https://example.com".
+	BaseURL string
+	// Token is the bearer token of the requests, the one of a session.
+	Token string
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client of the server at baseURL, authenticated with token.
+func NewClient(baseURL, token string) *Client {
+	return &Client{BaseURL: baseURL, Token: token, HTTPClient: http.DefaultClient}
+}
+`, title, g.doc.Info.Version)
+
+	errorBody := ""
+	if g.opts.ErrorSchema != "" {
+		errorBody = fmt.Sprintf(`
+	// Body is the decoded error response, nil when the response wasn't one.
+	Body *%s`, g.opts.ErrorSchema)
+	}
+	fmt.Fprintf(&g.body, `
+// ResponseError is returned for the responses with an error status.
+type ResponseError struct {
+	StatusCode int%s
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%%d %%s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+`, errorBody)
+
+	decodeError := ""
+	if g.opts.ErrorSchema != "" {
+		decodeError = fmt.Sprintf(`
+		var body %s
+		if json.NewDecoder(res.Body).Decode(&body) == nil {
+			resErr.Body = &body
+		}`, g.opts.ErrorSchema)
+	}
+	fmt.Fprintf(&g.body, `
+// do sends a request with a JSON body, if any, and decodes the JSON response into out, if any.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		resErr := &ResponseError{StatusCode: res.StatusCode}%s
+		return resErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding the response of %%s %%s: %%w", method, path, err)
+	}
+	return nil
+}
+`, decodeError)
+}
+
+func (g *clientGenerator) schemaType(name string, s *Schema) error {
+	if s.Type != "object" || len(s.Properties) == 0 {
+		typ, err := g.goType(s)
+		if err != nil {
+			return err
+		}
+		g.comment(name, s.Description)
+		fmt.Fprintf(&g.body, "type %s %s\n", name, typ)
+		return nil
+	}
+
+	g.comment(name, s.Description)
+	fmt.Fprintf(&g.body, "type %s struct {\n", name)
+	props := make([]string, 0, len(s.Properties))
+	for prop := range s.Properties {
+		props = append(props, prop)
+	}
+	slices.Sort(props)
+	for _, prop := range props {
+		p := s.Properties[prop]
+		typ, err := g.goType(p)
+		if err != nil {
+			return fmt.Errorf("property %s: %w", prop, err)
+		}
+		tag := prop
+		if !slices.Contains(s.Required, prop) {
+			tag += ",omitempty"
+		}
+		if p.Description != "" {
+			for _, line := range strings.Split(p.Description, "\n") {
+				fmt.Fprintf(&g.body, "\t// %s\n", line)
+			}
+		}
+		fmt.Fprintf(&g.body, "\t%s %s `json:%q`\n", goName(prop), typ, tag)
+	}
+	g.body.WriteString("}\n")
+	return nil
+}
+
+// goType is the Go type of the values of a schema.
+func (g *clientGenerator) goType(s *Schema) (string, error) {
+	if name, ok := s.RefName(); ok {
+		return name, nil
+	}
+
+	var typ string
+	switch s.Type {
+	case "string":
+		typ = "string"
+		if s.Format == "date-time" {
+			g.use("time")
+			typ = "time.Time"
+		}
+	case "integer":
+		typ = "int"
+		if s.Format == "int64" {
+			typ = "int64"
+		}
+	case "number":
+		typ = "float64"
+	case "boolean":
+		typ = "bool"
+	case "array":
+		if s.Items == nil {
+			return "", fmt.Errorf("array without items")
+		}
+		item, err := g.goType(s.Items)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + item, nil
+	case "object":
+		if len(s.Properties) > 0 {
+			return "", fmt.Errorf("inline objects are not supported, use a component")
+		}
+		if s.AdditionalProperties == nil {
+			return "map[string]any", nil
+		}
+		value, err := g.goType(s.AdditionalProperties)
+		if err != nil {
+			return "", err
+		}
+		return "map[string]" + value, nil
+	default:
+		return "", fmt.Errorf("unsupported type %q", s.Type)
+	}
+
+	if s.Nullable {
+		typ = "*" + typ
+	}
+	return typ, nil
+}
+
+func (g *clientGenerator) operation(op operation) error {
+	name := goName(op.OperationID)
+
+	var args, pathArgs []string
+	var query []Parameter
+	for _, p := range op.Parameters {
+		typ, err := g.goType(p.Schema)
+		if err != nil {
+			return fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		switch p.In {
+		case "path":
+			arg := goArgName(p.Name)
+			args = append(args, fmt.Sprintf("%s %s", arg, typ))
+			pathArgs = append(pathArgs, p.Name)
+		case "query":
+			query = append(query, p)
+		default:
+			return fmt.Errorf("parameter %s: parameters in %s are not supported", p.Name, p.In)
+		}
+	}
+
+	body := "nil"
+	if op.RequestBody != nil {
+		media, ok := op.RequestBody.Content["application/json"]
+		if !ok || media.Schema == nil {
+			return fmt.Errorf("only JSON request bodies are supported")
+		}
+		typ, err := g.goType(media.Schema)
+		if err != nil {
+			return fmt.Errorf("request body: %w", err)
+		}
+		args = append(args, "body "+typ)
+		body = "body"
+	}
+
+	if len(query) > 0 {
+		if err := g.paramsType(name, query); err != nil {
+			return err
+		}
+		args = append(args, fmt.Sprintf("params %sParams", name))
+	}
+
+	// The schemas of the components are returned by pointer, maps and slices as is
+	_, res, _ := successResponse(op.Operation)
+	result := ""
+	if res != nil {
+		typ, err := g.goType(res)
+		if err != nil {
+			return fmt.Errorf("response: %w", err)
+		}
+		result = typ
+		if _, ok := res.RefName(); ok {
+			result = "*" + typ
+		}
+	}
+
+	summary := op.Summary
+	if summary == "" {
+		summary = fmt.Sprintf("calls %s %s", op.method, op.path)
+	}
+	g.comment(name, summary)
+
+	returns := "error"
+	if result != "" {
+		returns = fmt.Sprintf("(%s, error)", result)
+	}
+	fmt.Fprintf(&g.body, "func (c *Client) %s(%s) %s {\n", name, strings.Join(append([]string{"ctx context.Context"}, args...), ", "), returns)
+
+	path, err := g.pathExpression(op.path, pathArgs, op.Parameters)
+	if err != nil {
+		return err
+	}
+
+	queryArg := "nil"
+	if len(query) > 0 {
+		queryArg = "query"
+		g.body.WriteString("\tquery := url.Values{}\n")
+		for _, p := range query {
+			if err := g.setQuery(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	method, ok := methodConstants[op.method]
+	if !ok {
+		return fmt.Errorf("unsupported method %s", op.method)
+	}
+	if result == "" {
+		fmt.Fprintf(&g.body, "\treturn c.do(ctx, %s, %s, %s, %s, nil)\n}\n", method, path, queryArg, body)
+		return nil
+	}
+
+	resType := strings.TrimPrefix(result, "*")
+	fmt.Fprintf(&g.body, "\tvar out %s\n", resType)
+	fmt.Fprintf(&g.body, "\tif err := c.do(ctx, %s, %s, %s, %s, &out); err != nil {\n\t\treturn nil, err\n\t}\n", method, path, queryArg, body)
+	if strings.HasPrefix(result, "*") {
+		g.body.WriteString("\treturn &out, nil\n}\n")
+	} else {
+		g.body.WriteString("\treturn out, nil\n}\n")
+	}
+	return nil
+}
+
+// paramsType declares the struct holding the query parameters of an operation.
+// The optional parameters are only sent when they aren't the zero value.
+func (g *clientGenerator) paramsType(name string, query []Parameter) error {
+	fmt.Fprintf(&g.body, "\n// %sParams are the query parameters of %s.\ntype %sParams struct {\n", name, name, name)
+	for _, p := range query {
+		typ, err := g.goType(p.Schema)
+		if err != nil {
+			return fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		if p.Description != "" {
+			for _, line := range strings.Split(p.Description, "\n") {
+				fmt.Fprintf(&g.body, "\t// %s\n", line)
+			}
+		}
+		fmt.Fprintf(&g.body, "\t%s %s\n", goName(p.Name), typ)
+	}
+	g.body.WriteString("}\n")
+	return nil
+}
+
+func (g *clientGenerator) setQuery(p Parameter) error {
+	field := "params." + goName(p.Name)
+	value, err := g.formatValue(field, p.Schema)
+	if err != nil {
+		return fmt.Errorf("parameter %s: %w", p.Name, err)
+	}
+	if p.Required {
+		fmt.Fprintf(&g.body, "\tquery.Set(%q, %s)\n", p.Name, value)
+		return nil
+	}
+
+	zero := "0"
+	switch p.Schema.Type {
+	case "string":
+		zero = `""`
+	case "boolean":
+		zero = "false"
+	}
+	fmt.Fprintf(&g.body, "\tif %s != %s {\n\t\tquery.Set(%q, %s)\n\t}\n", field, zero, p.Name, value)
+	return nil
+}
+
+// formatValue is the expression formatting a scalar for a URL.
+func (g *clientGenerator) formatValue(expr string, s *Schema) (string, error) {
+	switch s.Type {
+	case "string":
+		return expr, nil
+	case "integer":
+		g.use("strconv")
+		if s.Format == "int64" {
+			return fmt.Sprintf("strconv.FormatInt(%s, 10)", expr), nil
+		}
+		return fmt.Sprintf("strconv.Itoa(%s)", expr), nil
+	case "number":
+		g.use("strconv")
+		return fmt.Sprintf("strconv.FormatFloat(%s, 'f', -1, 64)", expr), nil
+	case "boolean":
+		g.use("strconv")
+		return fmt.Sprintf("strconv.FormatBool(%s)", expr), nil
+	default:
+		return "", fmt.Errorf("unsupported type %q", s.Type)
+	}
+}
+
+// pathExpression is the Go expression of a path, with its parameters escaped.
+func (g *clientGenerator) pathExpression(path string, names []string, params []Parameter) (string, error) {
+	var parts []string
+	rest := path
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(rest, '}')
+		if end < start {
+			return "", fmt.Errorf("invalid path %q", path)
+		}
+		name := rest[start+1 : end]
+		if !slices.Contains(names, name) {
+			return "", fmt.Errorf("path parameter %s isn't declared", name)
+		}
+
+		var schema *Schema
+		for _, p := range params {
+			if p.Name == name && p.In == "path" {
+				schema = p.Schema
+			}
+		}
+		value, err := g.formatValue(goArgName(name), schema)
+		if err != nil {
+			return "", fmt.Errorf("path parameter %s: %w", name, err)
+		}
+
+		parts = append(parts, fmt.Sprintf("%q", rest[:start]), fmt.Sprintf("url.PathEscape(%s)", value))
+		rest = rest[end+1:]
+	}
+	if rest != "" {
+		parts = append(parts, fmt.Sprintf("%q", rest))
+	}
+	return strings.Join(parts, " + "), nil
+}
+
+// comment documents a declaration with a description, read as following its
+// name: "Lists the lines" documents ListLines, "A line" is a Line.
+func (g *clientGenerator) comment(name, description string) {
+	g.body.WriteString("\n")
+	if description == "" {
+		return
+	}
+	r, size := utf8.DecodeRuneInString(description)
+	next, _ := utf8.DecodeRuneInString(description[size:])
+	if !unicode.IsUpper(next) {
+		description = string(unicode.ToLower(r)) + description[size:]
+	}
+	for _, article := range []string{"a ", "an ", "the "} {
+		if strings.HasPrefix(description, article) {
+			description = "is " + description
+			break
+		}
+	}
+	if !strings.HasSuffix(description, ".") {
+		description += "."
+	}
+	for i, line := range strings.Split(description, "\n") {
+		if i == 0 {
+			line = name + " " + line
+		}
+		fmt.Fprintf(&g.body, "// %s\n", line)
+	}
+}
+
+// initialisms are kept uppercase in the Go names.
+var initialisms = map[string]bool{"id": true, "url": true, "api": true, "fr": true, "nl": true}
+
+// goName turns a JSON or operation name like "stop_id" or "listLines" into an
+// exported Go name like "StopID" or "ListLines".
+func goName(name string) string {
+	var sb strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		if initialisms[strings.ToLower(word)] {
+			sb.WriteString(strings.ToUpper(word))
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(word)
+		sb.WriteRune(unicode.ToUpper(r))
+		sb.WriteString(word[size:])
+	}
+
+	// The path parameters are camel case, like "dashboardId"
+	n := sb.String()
+	if prefix, ok := strings.CutSuffix(n, "Id"); ok {
+		return prefix + "ID"
+	}
+	return n
+}
+
+// goArgName is the unexported form of goName, for the path parameters.
+func goArgName(name string) string {
+	n := goName(name)
+	for prefix := range initialisms {
+		if upper := strings.ToUpper(prefix); strings.HasPrefix(n, upper) {
+			return prefix + n[len(upper):]
+		}
+	}
+	r, size := utf8.DecodeRuneInString(n)
+	return string(unicode.ToLower(r)) + n[size:]
+}
+
+var methodConstants = map[string]string{
+	http.MethodGet:    "http.MethodGet",
+	http.MethodPost:   "http.MethodPost",
+	http.MethodPut:    "http.MethodPut",
+	http.MethodPatch:  "http.MethodPatch",
+	http.MethodDelete: "http.MethodDelete",
+}
@@ -0,0 +1,62 @@
+package openapi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGoName(t *testing.T) {
+	tests := map[string]string{
+		"listLines":   "ListLines",
+		"per_page":    "PerPage",
+		"stop_id":     "StopID",
+		"dashboardId": "DashboardID",
+		"fr":          "FR",
+		"q":           "Q",
+	}
+	for name, want := range tests {
+		if got := goName(name); got != want {
+			t.Errorf("goName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestGenerateClientRejectsUnsupportedSchemas(t *testing.T) {
+	doc := &Document{
+		Info: Info{Title: "Test API", Version: "1"},
+		Paths: map[string]*PathItem{
+			"/things": {"get": {
+				OperationID: "listThings",
+				Responses: map[string]*Response{"200": {
+					Description: "OK",
+					Content: map[string]MediaType{"application/json": {Schema: &Schema{
+						Type:       "object",
+						Properties: map[string]*Schema{"name": {Type: "string"}},
+					}}},
+				}},
+			}},
+			// Not JSON, left out of the client
+			"/": {"get": {
+				OperationID: "getPage",
+				Responses: map[string]*Response{"200": {
+					Description: "OK",
+					Content:     map[string]MediaType{"text/html": {Schema: &Schema{Type: "string"}}},
+				}},
+			}},
+		},
+	}
+
+	_, err := GenerateClient(doc, ClientOptions{Package: "client"})
+	if err == nil || !strings.Contains(err.Error(), "listThings") {
+		t.Fatalf("GenerateClient() error = %v, want the inline object of listThings rejected", err)
+	}
+
+	delete(doc.Paths, "/things")
+	src, err := GenerateClient(doc, ClientOptions{Package: "client"})
+	if err != nil {
+		t.Fatalf("GenerateClient() error = %v", err)
+	}
+	if strings.Contains(string(src), "GetPage") {
+		t.Errorf("the HTML operation is part of the client:\n%s", src)
+	}
+}
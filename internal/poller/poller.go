@@ -0,0 +1,158 @@
+// Package poller keeps the real-time cache warm for the stops people are watching,
+// so that dashboard handlers are served from memory instead of waiting on upstream.
+package poller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/jp-roisin/catch-and-go/internal/database"
+	"github.com/jp-roisin/catch-and-go/internal/externalapi"
+)
+
+type Config struct {
+	// Interval between two refreshes. It should stay below the cache TTL
+	// so entries are renewed before they expire.
+	Interval time.Duration
+	// Budget is the maximum number of upstream calls per refresh.
+	// Each call covers up to externalapi.BatchSize stops; the stops that don't fit
+	// (least recently viewed first) are left to be fetched on request.
+	Budget int
+	// IdleAfter is how long a stop stays polled after its last viewer went away.
+	IdleAfter time.Duration
+}
+
+const (
+	defaultInterval  = 45 * time.Second
+	defaultBudget    = 5
+	defaultIdleAfter = 15 * time.Minute
+
+	maxRestartBackoff = 5 * time.Minute
+)
+
+// ConfigFromEnv reads POLLER_INTERVAL, POLLER_BUDGET and POLLER_IDLE_AFTER,
+// falling back to the defaults for the unset ones. The values must be positive:
+// to turn the poller off, set POLLER_DISABLED instead.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Interval:  defaultInterval,
+		Budget:    defaultBudget,
+		IdleAfter: defaultIdleAfter,
+	}
+
+	if v := os.Getenv("POLLER_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid POLLER_INTERVAL %q: %w", v, err)
+		}
+		if d <= 0 {
+			return cfg, fmt.Errorf("invalid POLLER_INTERVAL %q: must be positive", v)
+		}
+		cfg.Interval = d
+	}
+
+	if v := os.Getenv("POLLER_BUDGET"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid POLLER_BUDGET %q: %w", v, err)
+		}
+		if n <= 0 {
+			return cfg, fmt.Errorf("invalid POLLER_BUDGET %q: must be positive", v)
+		}
+		cfg.Budget = n
+	}
+
+	if v := os.Getenv("POLLER_IDLE_AFTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid POLLER_IDLE_AFTER %q: %w", v, err)
+		}
+		if d <= 0 {
+			return cfg, fmt.Errorf("invalid POLLER_IDLE_AFTER %q: must be positive", v)
+		}
+		cfg.IdleAfter = d
+	}
+
+	return cfg, nil
+}
+
+// Poller periodically refreshes the stops followed by recently active sessions.
+type Poller struct {
+	db        database.Service
+	refresher externalapi.StopRefresher
+	cfg       Config
+}
+
+func New(db database.Service, refresher externalapi.StopRefresher, cfg Config) *Poller {
+	return &Poller{
+		db:        db,
+		refresher: refresher,
+		cfg:       cfg,
+	}
+}
+
+// Run polls until the context is cancelled. It supervises its own loop:
+// if a refresh panics, the loop is restarted with an exponential backoff.
+func (p *Poller) Run(ctx context.Context) {
+	backoff := time.Second
+
+	for {
+		err := p.loop(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("Poller crashed: %v (restarting in %s)", err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, maxRestartBackoff)
+	}
+}
+
+func (p *Poller) loop(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Poll(ctx); err != nil {
+			log.Printf("Poller refresh failed: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Poll refreshes the watched stops once, within the configured budget.
+func (p *Poller) Poll(ctx context.Context) error {
+	stopCodes, err := p.db.ListWatchedStopCodes(ctx, time.Now().Add(-p.cfg.IdleAfter))
+	if err != nil {
+		return fmt.Errorf("couldn't list the watched stops: %w", err)
+	}
+
+	if limit := p.cfg.Budget * externalapi.BatchSize; len(stopCodes) > limit {
+		stopCodes = stopCodes[:limit]
+	}
+	if len(stopCodes) == 0 {
+		return nil
+	}
+
+	return p.refresher.RefreshStops(ctx, stopCodes)
+}
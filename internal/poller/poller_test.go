@@ -0,0 +1,147 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jp-roisin/catch-and-go/internal/database"
+	"github.com/jp-roisin/catch-and-go/internal/externalapi"
+)
+
+type fakeDB struct {
+	database.Service
+	watched []string
+	since   time.Time
+}
+
+func (f *fakeDB) ListWatchedStopCodes(ctx context.Context, since time.Time) ([]string, error) {
+	f.since = since
+	return f.watched, nil
+}
+
+// fakeRefresher records the refreshes, and panics on the first ones when asked to.
+type fakeRefresher struct {
+	mu     sync.Mutex
+	calls  [][]string
+	panics int
+}
+
+func (f *fakeRefresher) RefreshStops(ctx context.Context, stopCodes []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, stopCodes)
+	if len(f.calls) <= f.panics {
+		panic("refresh exploded")
+	}
+	return nil
+}
+
+func (f *fakeRefresher) refreshes() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.calls)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval string
+		budget   string
+		idle     string
+		want     Config
+		wantErr  bool
+	}{
+		{name: "defaults", want: Config{Interval: defaultInterval, Budget: defaultBudget, IdleAfter: defaultIdleAfter}},
+		{name: "overrides", interval: "20s", budget: "2", idle: "5m", want: Config{Interval: 20 * time.Second, Budget: 2, IdleAfter: 5 * time.Minute}},
+		{name: "invalid interval", interval: "often", wantErr: true},
+		{name: "zero interval", interval: "0s", wantErr: true},
+		{name: "negative interval", interval: "-1m", wantErr: true},
+		{name: "zero budget", budget: "0", wantErr: true},
+		{name: "negative budget", budget: "-3", wantErr: true},
+		{name: "zero idle after", idle: "0s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POLLER_INTERVAL", tt.interval)
+			t.Setenv("POLLER_BUDGET", tt.budget)
+			t.Setenv("POLLER_IDLE_AFTER", tt.idle)
+
+			cfg, err := ConfigFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConfigFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && cfg != tt.want {
+				t.Errorf("ConfigFromEnv() = %+v, want %+v", cfg, tt.want)
+			}
+		})
+	}
+}
+
+func TestPollRespectsTheBudget(t *testing.T) {
+	var watched []string
+	for i := range 3 * externalapi.BatchSize {
+		watched = append(watched, fmt.Sprint(8000+i))
+	}
+	db := &fakeDB{watched: watched}
+	refresher := &fakeRefresher{}
+
+	p := New(db, refresher, Config{Interval: time.Minute, Budget: 2, IdleAfter: 15 * time.Minute})
+	if err := p.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+
+	if len(refresher.calls) != 1 {
+		t.Fatalf("expected a single refresh, got %d", len(refresher.calls))
+	}
+	// The most recently viewed stops come first and fill the budget
+	if want := watched[:2*externalapi.BatchSize]; !slices.Equal(refresher.calls[0], want) {
+		t.Errorf("refreshed %d stops %v, want the %d first ones", len(refresher.calls[0]), refresher.calls[0], len(want))
+	}
+	if idle := time.Since(db.since); idle < 15*time.Minute || idle > 16*time.Minute {
+		t.Errorf("watched stops listed since %s ago, want the sessions active in the last 15m", idle)
+	}
+
+	// Nothing is watched, upstream isn't called
+	db.watched = nil
+	if err := p.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if len(refresher.calls) != 1 {
+		t.Errorf("refreshed without any watched stop")
+	}
+}
+
+func TestRunRestartsAfterAPanic(t *testing.T) {
+	refresher := &fakeRefresher{panics: 1}
+	p := New(&fakeDB{watched: []string{"8042"}}, refresher, Config{Interval: 10 * time.Millisecond, Budget: 1, IdleAfter: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+
+	// The first refresh panics, the loop is restarted after a second and keeps polling
+	deadline := time.After(5 * time.Second)
+	for refresher.refreshes() < 3 {
+		select {
+		case <-deadline:
+			t.Fatalf("only %d refreshes after the panic", refresher.refreshes())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() didn't return once the context was cancelled")
+	}
+}
@@ -0,0 +1,714 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jp-roisin/catch-and-go/internal/database"
+	"github.com/jp-roisin/catch-and-go/internal/database/store"
+	"github.com/jp-roisin/catch-and-go/internal/externalapi"
+	"github.com/labstack/echo/v4"
+)
+
+// The JSON API lives next to the htmx endpoints and shares their service layer.
+// Its responses are the DTOs below rather than the store rows, so that the
+// database can change without breaking the scripts and widgets using it.
+const (
+	apiPrefix = "/api/"
+	apiV1     = "/api/v1"
+)
+
+// Lists are paginated with ?page= and ?per_page=
+const (
+	apiDefaultPerPage = 50
+	apiMaxPerPage     = 200
+	apiMaxSearchLimit = 50
+)
+
+func (s *Server) registerAPIRoutes(e *echo.Echo) {
+	e.HTTPErrorHandler = apiErrorHandler(e.HTTPErrorHandler)
+
+	e.GET("/api/openapi.json", s.OpenAPIHandler)
+
+	v1 := e.Group(apiV1)
+
+	// Getting a token is the only thing that doesn't need one
+	v1.POST("/sessions", s.APICreateSessionHandler)
+
+	auth := v1.Group("", s.APITokenMiddleware())
+	auth.GET("/lines", s.APILinesHandler)
+	auth.GET("/lines/:lineCode/directions", s.APIDirectionsHandler)
+	auth.GET("/directions/:lineId/stops", s.APIDirectionStopsHandler)
+
+	auth.GET("/stops", s.APISearchStopsHandler)
+	auth.GET("/stops/nearby", s.APINearbyStopsHandler)
+	auth.GET("/stops/:stopCode", s.APIStopHandler)
+	auth.GET("/stops/:stopCode/departures", s.APIStopDeparturesHandler)
+
+	auth.GET("/dashboards", s.APIDashboardsHandler)
+	auth.POST("/dashboards", s.APICreateDashboardHandler)
+	auth.DELETE("/dashboards/:dashboardId", s.APIDeleteDashboardHandler)
+	auth.GET("/dashboards/:dashboardId/departures", s.APIDashboardDeparturesHandler)
+}
+
+func isAPIRequest(c echo.Context) bool {
+	return strings.HasPrefix(c.Request().URL.Path, apiPrefix)
+}
+
+// apiResponse is the envelope of every successful response of the API.
+type apiResponse struct {
+	Data       any            `json:"data"`
+	Pagination *apiPagination `json:"pagination,omitempty"`
+}
+
+type apiPagination struct {
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
+	Total   int `json:"total"`
+}
+
+// apiError is the body of every failed response of the API, under an "error" key:
+// a code for programs to branch on, and a message for people.
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func newAPIError(status int, code, message string) *apiError {
+	return &apiError{Status: status, Code: code, Message: message}
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// apiErrorHandler renders the errors of the API in its envelope, including those
+// raised by echo itself like unknown routes, and leaves the others to next.
+func apiErrorHandler(next echo.HTTPErrorHandler) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if !isAPIRequest(c) {
+			next(err, c)
+			return
+		}
+		if c.Response().Committed {
+			return
+		}
+
+		apiErr := toAPIError(err)
+		if apiErr.Status >= http.StatusInternalServerError {
+			log.Printf("API error on %s %s: %v", c.Request().Method, c.Request().URL.Path, err)
+		}
+		if err := c.JSON(apiErr.Status, map[string]*apiError{"error": apiErr}); err != nil {
+			log.Printf("Couldn't write the API error: %v", err)
+		}
+	}
+}
+
+func toAPIError(err error) *apiError {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return newAPIError(httpErr.Code, statusErrorCode(httpErr.Code), fmt.Sprint(httpErr.Message))
+	}
+
+	return newAPIError(http.StatusInternalServerError, statusErrorCode(http.StatusInternalServerError), http.StatusText(http.StatusInternalServerError))
+}
+
+// statusErrorCode is the error code of a status without a more precise one:
+// "not_found" for a 404.
+func statusErrorCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// upstreamAPIError tells why the real-time data of a stop is missing, like the
+// degraded card of a dashboard does.
+func upstreamAPIError(err error) *apiError {
+	switch {
+	case errors.Is(err, externalapi.ErrStopUnknown):
+		return newAPIError(http.StatusNotFound, "stop_unknown", "The stop is not known to the real-time provider")
+	case errors.Is(err, externalapi.ErrUnauthorized):
+		return newAPIError(http.StatusBadGateway, "upstream_unauthorized", "The real-time provider refused the credentials of the server")
+	case errors.Is(err, externalapi.ErrQuotaExceeded):
+		return newAPIError(http.StatusServiceUnavailable, "upstream_quota_exceeded", "The quota of the real-time provider is exceeded")
+	case errors.Is(err, externalapi.ErrUpstreamUnavailable):
+		return newAPIError(http.StatusServiceUnavailable, "upstream_unavailable", "The real-time provider is unavailable")
+	case errors.Is(err, externalapi.ErrDecode):
+		return newAPIError(http.StatusBadGateway, "upstream_decode", "The real-time provider sent unreadable data")
+	default:
+		return newAPIError(http.StatusBadGateway, "upstream_error", "The real-time lookup failed")
+	}
+}
+
+// pageQuery reads the pagination of a list, pages start at 1.
+func pageQuery(c echo.Context) (page, perPage int, err error) {
+	page, perPage = 1, apiDefaultPerPage
+	if p := c.QueryParam("page"); p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			return 0, 0, newAPIError(http.StatusBadRequest, "invalid_page", fmt.Sprintf("invalid page: %q is not a positive number", p))
+		}
+	}
+	if pp := c.QueryParam("per_page"); pp != "" {
+		perPage, err = strconv.Atoi(pp)
+		if err != nil || perPage < 1 || perPage > apiMaxPerPage {
+			return 0, 0, newAPIError(http.StatusBadRequest, "invalid_per_page", fmt.Sprintf("invalid per_page: must be a number up to %d", apiMaxPerPage))
+		}
+	}
+	return page, perPage, nil
+}
+
+// paginate returns a page of items, past the last page is an empty page.
+func paginate[T any](items []T, page, perPage int) ([]T, *apiPagination) {
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+	return items[start:end], &apiPagination{Page: page, PerPage: perPage, Total: len(items)}
+}
+
+// Names and destinations are given in both languages, clients pick their own.
+type apiText struct {
+	FR string `json:"fr"`
+	NL string `json:"nl"`
+}
+
+type apiSession struct {
+	Token  string `json:"token"`
+	Locale string `json:"locale"`
+	Theme  string `json:"theme"`
+}
+
+// apiLine is a line regardless of its direction.
+type apiLine struct {
+	Code      string `json:"code"`
+	Mode      string `json:"mode"`
+	Color     string `json:"color"`
+	TextColor string `json:"text_color"`
+}
+
+// apiDirection is a line heading to one of its terminuses.
+type apiDirection struct {
+	ID          int64   `json:"id"`
+	LineCode    string  `json:"line_code"`
+	Direction   string  `json:"direction"`
+	Destination apiText `json:"destination"`
+}
+
+type apiStop struct {
+	ID        int64   `json:"id"`
+	Code      string  `json:"code"`
+	Name      apiText `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	StationID *int64  `json:"station_id"`
+	// Lines are the codes of the lines serving the stop, when listed
+	Lines []string `json:"lines,omitempty"`
+	// Distance is in meters from the searched position, for the nearby stops
+	Distance *int `json:"distance,omitempty"`
+}
+
+type apiDashboard struct {
+	ID            int64      `json:"id"`
+	Stop          apiStop    `json:"stop"`
+	FollowStation bool       `json:"follow_station"`
+	CreatedAt     *time.Time `json:"created_at"`
+}
+
+type apiDeparture struct {
+	Line        apiLine   `json:"line"`
+	Destination apiText   `json:"destination"`
+	ExpectedAt  time.Time `json:"expected_at"`
+	// Minutes is the number of whole minutes until ExpectedAt, 0 when due
+	Minutes int  `json:"minutes"`
+	Due     bool `json:"due"`
+}
+
+type apiDepartures struct {
+	Departures  []apiDeparture `json:"departures"`
+	Disruptions []apiText      `json:"disruptions"`
+	// Stale is set when the provider couldn't be reached and older data is served
+	Stale     bool      `json:"stale"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+var apiDirectionNames = map[store.Direction]string{
+	store.TowardsSuburbs: "suburbs",
+	store.TowardsCity:    "city",
+}
+
+func toAPILine(l store.Line) apiLine {
+	f := l.AddFallback()
+	return apiLine{Code: f.Code, Mode: f.Mode, Color: f.Color, TextColor: f.TextColor}
+}
+
+func toAPIDirection(l store.Line) apiDirection {
+	return apiDirection{
+		ID:          l.ID,
+		LineCode:    l.Code,
+		Direction:   apiDirectionNames[store.Direction(l.Direction)],
+		Destination: apiText{FR: l.DestinationFr, NL: l.DestinationNl},
+	}
+}
+
+func toAPIStop(stop store.Stop) apiStop {
+	return apiStop{
+		ID:        stop.ID,
+		Code:      stop.Code,
+		Name:      apiText{FR: stop.NameFr, NL: stop.NameNl},
+		Latitude:  stop.Lat,
+		Longitude: stop.Lon,
+		StationID: nullInt64(stop.StationID),
+	}
+}
+
+func toAPIDashboard(d store.ListDashboardsFromSessionRow) apiDashboard {
+	return apiDashboard{
+		ID: d.DashboardID,
+		Stop: apiStop{
+			ID:        d.StopID,
+			Code:      d.StopCode,
+			Name:      apiText{FR: d.StopNameFr, NL: d.StopNameNl},
+			Latitude:  d.StopLat,
+			Longitude: d.StopLon,
+			StationID: nullInt64(d.StopStationID),
+		},
+		FollowStation: d.FollowStation,
+		CreatedAt:     nullTime(d.DashboardCreatedAt),
+	}
+}
+
+func nullInt64(n sql.NullInt64) *int64 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Int64
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// apiSessionFromContext returns the session of the bearer token, see APITokenMiddleware.
+func apiSessionFromContext(c echo.Context) (*store.Session, error) {
+	session, ok := c.Get("session").(*store.Session)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the session token")
+	}
+	return session, nil
+}
+
+// APICreateSessionHandler starts an anonymous session, its token authenticates
+// the other requests.
+func (s *Server) APICreateSessionHandler(c echo.Context) error {
+	session, err := s.db.CreateSession(c.Request().Context(), uuid.New().String())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't create session")
+	}
+
+	return c.JSON(http.StatusCreated, apiResponse{Data: apiSession{
+		Token:  session.ID,
+		Locale: session.Locale,
+		Theme:  session.Theme,
+	}})
+}
+
+// APILinesHandler lists the lines of the network in the order of the line picker.
+func (s *Server) APILinesHandler(c echo.Context) error {
+	page, perPage, err := pageQuery(c)
+	if err != nil {
+		return err
+	}
+
+	lines, err := s.db.ListLines(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the lines info")
+	}
+
+	// A line has a row per direction, the metadata are the same in both
+	result := []apiLine{}
+	seen := make(map[string]bool, len(lines))
+	for _, l := range lines {
+		if seen[l.Code] {
+			continue
+		}
+		seen[l.Code] = true
+		result = append(result, toAPILine(l))
+	}
+	slices.SortStableFunc(result, func(a, b apiLine) int {
+		return store.CompareLineCodes(a.Code, b.Code)
+	})
+
+	data, pagination := paginate(result, page, perPage)
+	return c.JSON(http.StatusOK, apiResponse{Data: data, Pagination: pagination})
+}
+
+func (s *Server) APIDirectionsHandler(c echo.Context) error {
+	code := store.NormalizeLineCode(c.Param("lineCode"))
+
+	lines, err := s.db.ListLinesByCode(c.Request().Context(), code)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the lines for that code")
+	}
+	if len(lines) == 0 {
+		return newAPIError(http.StatusNotFound, "line_not_found", fmt.Sprintf("No line has the code %q", code))
+	}
+
+	directions := make([]apiDirection, 0, len(lines))
+	for _, l := range lines {
+		directions = append(directions, toAPIDirection(l))
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: directions})
+}
+
+// APIDirectionStopsHandler lists the stops of a direction in the order they are served.
+func (s *Server) APIDirectionStopsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	lineID := c.Param("lineId")
+
+	id, err := strconv.Atoi(lineID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid lineId: %q is not a number", lineID))
+	}
+
+	if _, err := s.db.GetLineById(ctx, int64(id)); errors.Is(err, sql.ErrNoRows) {
+		return newAPIError(http.StatusNotFound, "direction_not_found", fmt.Sprintf("No direction has the id %d", id))
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the line info")
+	}
+
+	stops, err := s.db.ListStopsFromLine(ctx, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the stops info")
+	}
+
+	result := make([]apiStop, 0, len(stops))
+	for _, stop := range stops {
+		result = append(result, toAPIStop(stop))
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: result})
+}
+
+// APISearchStopsHandler finds the stops by name, like the type-ahead of the line picker.
+func (s *Server) APISearchStopsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	query := strings.TrimSpace(c.QueryParam("q"))
+	if utf8.RuneCountInString(query) < stopSearchMinLength {
+		return newAPIError(http.StatusBadRequest, "invalid_query", fmt.Sprintf("invalid q: at least %d letters are needed", stopSearchMinLength))
+	}
+	limit := stopSearchLimit
+	if l := c.QueryParam("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > apiMaxSearchLimit {
+			return newAPIError(http.StatusBadRequest, "invalid_limit", fmt.Sprintf("invalid limit: must be a number up to %d", apiMaxSearchLimit))
+		}
+	}
+
+	stops, err := s.db.SearchStops(ctx, query, limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't search the stops")
+	}
+
+	result := make([]apiStop, 0, len(stops))
+	for _, stop := range stops {
+		r, err := s.apiStopWithLines(ctx, stop)
+		if err != nil {
+			return err
+		}
+		result = append(result, r)
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: result})
+}
+
+// APINearbyStopsHandler lists the stops around a position, closest first.
+func (s *Server) APINearbyStopsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	latitude, longitude, radius, err := nearbyQuery(c)
+	if err != nil {
+		return err
+	}
+
+	stops, err := s.db.ListStopsNearby(ctx, latitude, longitude, radius, nearbyLimit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the nearby stops")
+	}
+
+	result := make([]apiStop, 0, len(stops))
+	for _, stop := range stops {
+		r, err := s.apiStopWithLines(ctx, stop.Stop)
+		if err != nil {
+			return err
+		}
+		distance := int(math.Round(stop.Distance))
+		r.Distance = &distance
+		result = append(result, r)
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: result})
+}
+
+func (s *Server) APIStopHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	stop, err := s.apiGetStop(ctx, c.Param("stopCode"))
+	if err != nil {
+		return err
+	}
+
+	result, err := s.apiStopWithLines(ctx, stop)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: result})
+}
+
+// APIStopDeparturesHandler returns the upcoming departures of a single platform.
+func (s *Server) APIStopDeparturesHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	stop, err := s.apiGetStop(ctx, c.Param("stopCode"))
+	if err != nil {
+		return err
+	}
+
+	departures, err := s.apiDepartures(ctx, stop.ID, stop.Code, []string{stop.Code})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: departures})
+}
+
+// APIDashboardsHandler lists the dashboards of the session of the token.
+func (s *Server) APIDashboardsHandler(c echo.Context) error {
+	page, perPage, err := pageQuery(c)
+	if err != nil {
+		return err
+	}
+	session, err := apiSessionFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	dashboards, err := s.db.ListDashboardsFromSession(ctx, session.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the dashboard")
+	}
+
+	dashboards, pagination := paginate(dashboards, page, perPage)
+
+	// The departures of the listed dashboards are then served from the cache
+	s.prefetchDashboardStops(ctx, dashboards)
+
+	data := make([]apiDashboard, 0, len(dashboards))
+	for _, d := range dashboards {
+		data = append(data, toAPIDashboard(d))
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: data, Pagination: pagination})
+}
+
+type apiCreateDashboardRequest struct {
+	StopID int64 `json:"stop_id"`
+	// FollowStation shows every platform of the station of the stop
+	FollowStation bool `json:"follow_station"`
+}
+
+func (s *Server) APICreateDashboardHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req apiCreateDashboardRequest
+	if err := (&echo.DefaultBinder{}).BindBody(c, &req); err != nil {
+		return newAPIError(http.StatusBadRequest, "invalid_body", "The body must be a JSON object with a stop_id")
+	}
+	if req.StopID <= 0 {
+		return newAPIError(http.StatusBadRequest, "invalid_stop_id", "invalid stop_id: must be a positive integer")
+	}
+
+	if err := s.checkDashboardStop(ctx, req.StopID); errors.Is(err, errStopNotInNetwork) {
+		return newAPIError(http.StatusNotFound, "stop_not_found", fmt.Sprintf("No stop with id %d", req.StopID))
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the stop")
+	}
+
+	session, err := apiSessionFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	created, err := s.db.CreateDashboard(ctx, store.CreatedashboardParams{
+		SessionID:     session.ID,
+		StopID:        req.StopID,
+		FollowStation: req.FollowStation,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't persist the dashboard")
+	}
+
+	d, err := s.db.GetDashboardByIdWithStopInfo(ctx, store.GetDashboardByIdWithStopInfoParams{
+		ID:        created.ID,
+		SessionID: session.ID,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the dashboard with stop info")
+	}
+
+	return c.JSON(http.StatusCreated, apiResponse{Data: toAPIDashboard(store.ListDashboardsFromSessionRow{
+		DashboardID:        d.DashboardID,
+		SessionID:          d.SessionID,
+		StopID:             d.StopID,
+		DashboardCreatedAt: d.DashboardCreatedAt,
+		StopCode:           d.StopCode,
+		StopLat:            d.StopLat,
+		StopLon:            d.StopLon,
+		StopNameFr:         d.StopNameFr,
+		StopNameNl:         d.StopNameNl,
+		StopStationID:      d.StopStationID,
+		FollowStation:      d.FollowStation,
+	})})
+}
+
+// APIDeleteDashboardHandler succeeds for a dashboard that is already gone, so
+// that retrying it is safe.
+func (s *Server) APIDeleteDashboardHandler(c echo.Context) error {
+	dashboardID, err := dashboardIDParam(c)
+	if err != nil {
+		return err
+	}
+	session, err := apiSessionFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.DeleteDashboard(c.Request().Context(), store.DeleteDashboardParams{
+		ID:        dashboardID,
+		SessionID: session.ID,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't delete the dashboard")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// APIDashboardDeparturesHandler returns what the card of a dashboard shows: the
+// departures of its stop, or of every platform of its station.
+func (s *Server) APIDashboardDeparturesHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	dashboardID, err := dashboardIDParam(c)
+	if err != nil {
+		return err
+	}
+	session, err := apiSessionFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	d, err := s.db.GetDashboardByIdWithStopInfo(ctx, store.GetDashboardByIdWithStopInfoParams{
+		ID:        dashboardID,
+		SessionID: session.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return newAPIError(http.StatusNotFound, "dashboard_not_found", fmt.Sprintf("No dashboard has the id %d", dashboardID))
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the dashboard with stop info")
+	}
+
+	// The stop left the network on the last reseed and no replacement was found
+	if d.StopRemovedAt.Valid {
+		return newAPIError(http.StatusGone, "stop_removed", "The stop of the dashboard is no longer served")
+	}
+
+	departures, err := s.apiDepartures(ctx, d.StopID, d.StopCode, s.dashboardStopCodes(ctx, d.StopCode, d.StopStationID, d.FollowStation))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: departures})
+}
+
+func dashboardIDParam(c echo.Context) (int64, error) {
+	param := c.Param("dashboardId")
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid dashboardId: %q is not a number", param))
+	}
+	return id, nil
+}
+
+// apiGetStop returns the stop of a code, the placeholder of the seeds isn't one.
+func (s *Server) apiGetStop(ctx context.Context, code string) (store.Stop, error) {
+	stop, err := s.db.GetStop(ctx, code)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && stop.Code == database.UnknownStopCode) {
+		return store.Stop{}, newAPIError(http.StatusNotFound, "stop_not_found", fmt.Sprintf("No stop has the code %q", code))
+	}
+	if err != nil {
+		return store.Stop{}, echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the stop info")
+	}
+	return stop, nil
+}
+
+// apiStopWithLines is a stop with the lines serving it.
+func (s *Server) apiStopWithLines(ctx context.Context, stop store.Stop) (apiStop, error) {
+	lineCodes, err := s.db.ListLineCodesFromStop(ctx, stop.ID)
+	if err != nil {
+		return apiStop{}, echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the lines of the stop")
+	}
+	slices.SortFunc(lineCodes, store.CompareLineCodes)
+
+	result := toAPIStop(stop)
+	result.Lines = lineCodes
+	return result, nil
+}
+
+// apiDepartures computes the departures of a set of platforms the way the
+// dashboard cards do, see GetDashboardContentHandler.
+func (s *Server) apiDepartures(ctx context.Context, stopID int64, stopCode string, stopCodes []string) (apiDepartures, error) {
+	res, err := s.waitingTimesForStops(ctx, stopCodes)
+	if err != nil {
+		log.Printf("Real-time lookup failed for stop %s: %v", stopCode, err)
+		return apiDepartures{}, upstreamAPIError(err)
+	}
+
+	departures, err := s.upcomingDepartures(ctx, res, s.now())
+	if err != nil {
+		return apiDepartures{}, echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the line info")
+	}
+
+	result := apiDepartures{
+		Departures:  make([]apiDeparture, 0, len(departures)),
+		Disruptions: []apiText{},
+		Stale:       res.Stale,
+		FetchedAt:   res.FetchedAt,
+	}
+	for _, d := range departures {
+		result.Departures = append(result.Departures, apiDeparture{
+			Line:        toAPILine(d.Line),
+			Destination: apiText{FR: d.Destination.FR, NL: d.Destination.NL},
+			ExpectedAt:  d.ExpectedAt,
+			Minutes:     d.Minutes,
+			Due:         d.State == externalapi.DepartureDue,
+		})
+	}
+	for _, t := range s.disruptionsForStop(ctx, stopID, stopCode, res) {
+		result.Disruptions = append(result.Disruptions, apiText{FR: t.FR, NL: t.NL})
+	}
+	return result, nil
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jp-roisin/catch-and-go/internal/database"
+	"github.com/jp-roisin/catch-and-go/internal/database/store"
+	"github.com/jp-roisin/catch-and-go/internal/externalapi"
+)
+
+const apiTestToken = "api-token"
+
+func (f *fakeDB) GetSession(ctx context.Context, token string) (store.Session, error) {
+	if token != apiTestToken {
+		return store.Session{}, sql.ErrNoRows
+	}
+	return store.Session{ID: token, Locale: "fr", LastSeenAt: sql.NullTime{Time: time.Now(), Valid: true}}, nil
+}
+
+func (f *fakeDB) ListLines(ctx context.Context) ([]store.Line, error) {
+	var lines []store.Line
+	for _, l := range f.lines {
+		lines = append(lines, l)
+	}
+	return lines, nil
+}
+
+func (f *fakeDB) GetStop(ctx context.Context, code string) (store.Stop, error) {
+	for _, stop := range f.stops {
+		if stop.Code == code {
+			return stop, nil
+		}
+	}
+	return store.Stop{}, sql.ErrNoRows
+}
+
+func (f *fakeDB) GetStopById(ctx context.Context, id int64) (store.Stop, error) {
+	for _, stop := range f.stops {
+		if stop.ID == id {
+			return stop, nil
+		}
+	}
+	return store.Stop{}, sql.ErrNoRows
+}
+
+func (f *fakeDB) CreateDashboard(ctx context.Context, param store.CreatedashboardParams) (store.Dashboard, error) {
+	d := store.GetDashboardByIdWithStopInfoRow{
+		DashboardID:   int64(len(f.dashboards) + 1),
+		SessionID:     param.SessionID,
+		StopID:        param.StopID,
+		FollowStation: param.FollowStation,
+	}
+	for _, stop := range f.stops {
+		if stop.ID == param.StopID {
+			d.StopCode = stop.Code
+		}
+	}
+	f.dashboards = append(f.dashboards, d)
+	return store.Dashboard{ID: d.DashboardID, SessionID: d.SessionID, StopID: d.StopID}, nil
+}
+
+func apiRequest(t *testing.T, s *Server, method, target, token string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	return apiRequestWithBody(t, s, method, target, token, "")
+}
+
+func apiRequestWithBody(t *testing.T, s *Server, method, target, token, body string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp := httptest.NewRecorder()
+	s.RegisterRoutes().ServeHTTP(resp, req)
+
+	var decoded map[string]any
+	if err := json.Unmarshal(resp.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("%s %s: invalid JSON body %q: %v", method, target, resp.Body.String(), err)
+	}
+	return resp, decoded
+}
+
+func errorCode(body map[string]any) any {
+	e, _ := body["error"].(map[string]any)
+	return e["code"]
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	s := &Server{db: &fakeDB{}}
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+		status int
+		code   string
+	}{
+		{"no token", "/api/v1/lines", "", http.StatusUnauthorized, "unauthorized"},
+		{"unknown token", "/api/v1/lines", "nope", http.StatusUnauthorized, "invalid_token"},
+		{"unknown route", "/api/v1/nope", apiTestToken, http.StatusNotFound, "not_found"},
+		{"invalid parameter", "/api/v1/stops/nearby?lat=north&lon=4.35", apiTestToken, http.StatusBadRequest, "bad_request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := apiRequest(t, s, http.MethodGet, tt.target, tt.token)
+			if resp.Code != tt.status || errorCode(body) != tt.code {
+				t.Errorf("got %d %v, want %d %q", resp.Code, body, tt.status, tt.code)
+			}
+			// The API never hands out session cookies, its sessions are bearer tokens
+			if cookie := resp.Header().Get("Set-Cookie"); cookie != "" {
+				t.Errorf("the API set a cookie: %s", cookie)
+			}
+		})
+	}
+}
+
+func TestAPILinesPagination(t *testing.T) {
+	s := &Server{db: &fakeDB{
+		lines: map[string]store.Line{
+			"N04": {Code: "N04"},
+			"11":  {Code: "11"},
+			"2":   {Code: "2", Mode: sql.NullString{String: "metro", Valid: true}},
+			"T92": {Code: "T92"},
+			"1":   {Code: "1"},
+		},
+	}}
+
+	resp, body := apiRequest(t, s, http.MethodGet, "/api/v1/lines?page=2&per_page=2", apiTestToken)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("got %d: %v", resp.Code, body)
+	}
+
+	var codes []string
+	for _, l := range body["data"].([]any) {
+		codes = append(codes, l.(map[string]any)["code"].(string))
+	}
+	if want := []string{"11", "N04"}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("page 2 has lines %v, want %v", codes, want)
+	}
+	want := map[string]any{"page": 2.0, "per_page": 2.0, "total": 5.0}
+	if !reflect.DeepEqual(body["pagination"], want) {
+		t.Errorf("pagination = %v, want %v", body["pagination"], want)
+	}
+
+	resp, body = apiRequest(t, s, http.MethodGet, "/api/v1/lines?per_page=1000", apiTestToken)
+	if resp.Code != http.StatusBadRequest || errorCode(body) != "invalid_per_page" {
+		t.Errorf("got %d %v for a page too large", resp.Code, body)
+	}
+}
+
+func TestAPIDashboardDepartures(t *testing.T) {
+	now := time.Date(2025, 8, 1, 8, 0, 0, 0, time.UTC)
+
+	wt := externalapi.NewFixtureProvider()
+	wt.Add(externalapi.WaitingTime{
+		PointID: "8042",
+		LineID:  "5",
+		PassingTimes: externalapi.PassingTimeList{
+			{Destination: externalapi.I18n{FR: "STOCKEL", NL: "STOKKEL"}, ExpectedArrivalTime: "2025-08-01T10:12:00+02:00", LineID: "5"},
+			{Destination: externalapi.I18n{FR: "ERASME", NL: "ERASMUS"}, ExpectedArrivalTime: "2025-08-01T09:55:00+02:00", LineID: "5"},
+			{Destination: externalapi.I18n{FR: "STOCKEL", NL: "STOKKEL"}, ExpectedArrivalTime: "2025-08-01T10:05:00+02:00", LineID: "5"},
+		},
+	})
+
+	s := &Server{
+		db: &fakeDB{
+			dashboards: []store.GetDashboardByIdWithStopInfoRow{{DashboardID: 1, StopCode: "8042"}},
+			lines: map[string]store.Line{
+				"5": {Code: "5", Mode: sql.NullString{String: "metro", Valid: true}},
+			},
+		},
+		wt:    wt,
+		clock: func() time.Time { return now },
+	}
+
+	resp, body := apiRequest(t, s, http.MethodGet, "/api/v1/dashboards/1/departures", apiTestToken)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("got %d: %v", resp.Code, body)
+	}
+
+	departures := body["data"].(map[string]any)["departures"].([]any)
+	var minutes []float64
+	for _, d := range departures {
+		d := d.(map[string]any)
+		if line := d["line"].(map[string]any); line["code"] != "5" || line["mode"] != "metro" {
+			t.Errorf("departure of line %v, want the metro 5", line)
+		}
+		minutes = append(minutes, d["minutes"].(float64))
+	}
+	// The departed vehicle is left out, the others come soonest first
+	if want := []float64{5, 12}; !reflect.DeepEqual(minutes, want) {
+		t.Errorf("departures in %v minutes, want %v", minutes, want)
+	}
+
+	resp, body = apiRequest(t, s, http.MethodGet, "/api/v1/dashboards/2/departures", apiTestToken)
+	if resp.Code != http.StatusNotFound || errorCode(body) != "dashboard_not_found" {
+		t.Errorf("got %d %v for a missing dashboard", resp.Code, body)
+	}
+}
+
+func TestAPICreateDashboardChecksTheStop(t *testing.T) {
+	db := &fakeDB{
+		stops: []store.Stop{
+			{ID: 1, Code: "8042"},
+			{ID: 2, Code: database.UnknownStopCode},
+			// Left the network, it's only kept for the dashboards following it
+			{ID: 3, Code: "5000", RemovedAt: sql.NullTime{Time: time.Now(), Valid: true}},
+		},
+	}
+	s := &Server{db: db}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"stop in the network", `{"stop_id": 1}`, http.StatusCreated, ""},
+		{"missing stop", `{"stop_id": 42}`, http.StatusNotFound, "stop_not_found"},
+		{"unknown stop fallback", `{"stop_id": 2}`, http.StatusNotFound, "stop_not_found"},
+		{"removed stop", `{"stop_id": 3}`, http.StatusNotFound, "stop_not_found"},
+		{"invalid stop id", `{"stop_id": 0}`, http.StatusBadRequest, "invalid_stop_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := apiRequestWithBody(t, s, http.MethodPost, "/api/v1/dashboards", apiTestToken, tt.body)
+			if resp.Code != tt.status {
+				t.Fatalf("got %d %v, want %d", resp.Code, body, tt.status)
+			}
+			if tt.code != "" && errorCode(body) != tt.code {
+				t.Errorf("got error %v, want %q", body, tt.code)
+			}
+		})
+	}
+
+	if len(db.dashboards) != 1 {
+		t.Errorf("%d dashboards were created, want only the one of the stop in the network", len(db.dashboards))
+	}
+}
+
+// failingProvider fails every real-time lookup with err.
+type failingProvider struct {
+	err error
+}
+
+func (p failingProvider) GetWaitingTimeForStop(ctx context.Context, stopCode string) (externalapi.Response, error) {
+	return externalapi.Response{}, p.err
+}
+
+func TestAPIStopDeparturesUpstreamError(t *testing.T) {
+	s := &Server{
+		db: &fakeDB{stops: []store.Stop{{ID: 1, Code: "8042"}}},
+		wt: failingProvider{err: externalapi.ErrStopUnknown},
+	}
+
+	resp, body := apiRequest(t, s, http.MethodGet, "/api/v1/stops/8042/departures", apiTestToken)
+	if resp.Code != http.StatusNotFound || errorCode(body) != "stop_unknown" {
+		t.Errorf("got %d %v for a stop unknown to the provider", resp.Code, body)
+	}
+
+	resp, body = apiRequest(t, s, http.MethodGet, "/api/v1/stops/9999/departures", apiTestToken)
+	if resp.Code != http.StatusNotFound || errorCode(body) != "stop_not_found" {
+		t.Errorf("got %d %v for a stop missing from the network", resp.Code, body)
+	}
+
+	s.wt = failingProvider{err: externalapi.ErrQuotaExceeded}
+	resp, body = apiRequest(t, s, http.MethodGet, "/api/v1/stops/8042/departures", apiTestToken)
+	if resp.Code != http.StatusServiceUnavailable || errorCode(body) != "upstream_quota_exceeded" {
+		t.Errorf("got %d %v for an exceeded quota", resp.Code, body)
+	}
+}
+
+func TestHTMLErrorsKeepTheirFormat(t *testing.T) {
+	s := &Server{db: &fakeDB{}}
+
+	req := httptest.NewRequest(http.MethodGet, "/nope", nil)
+	req.AddCookie(&http.Cookie{Name: "token", Value: apiTestToken})
+	resp := httptest.NewRecorder()
+	s.RegisterRoutes().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNotFound || strings.Contains(resp.Body.String(), `"error"`) {
+		t.Errorf("got %d %s, want echo's own 404", resp.Code, resp.Body.String())
+	}
+}
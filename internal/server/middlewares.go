@@ -1,8 +1,11 @@
 package server
 
 import (
+	"context"
+	"database/sql"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,9 +13,16 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+const sessionTouchInterval = time.Minute
+
 func (s *Server) AnonymousSessionMiddleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			// The JSON API authenticates with a bearer token, see APITokenMiddleware
+			if isAPIRequest(c) {
+				return next(c)
+			}
+
 			ctx := c.Request().Context()
 
 			cookie, err := c.Cookie("token")
@@ -46,6 +56,8 @@ func (s *Server) AnonymousSessionMiddleware() echo.MiddlewareFunc {
 
 			}
 
+			s.touchSession(ctx, &session)
+
 			c.Set("session", &session)
 			log.Printf("Active session: %s", session.ID)
 
@@ -54,3 +66,51 @@ func (s *Server) AnonymousSessionMiddleware() echo.MiddlewareFunc {
 		}
 	}
 }
+
+// APITokenMiddleware authenticates the requests of the JSON API. The token is the
+// one of an anonymous session started with POST /api/v1/sessions, sent as a bearer
+// token rather than as a cookie. The session cookie of a browser is HttpOnly and never
+// shown, so API clients have their own sessions and dashboards.
+func (s *Server) APITokenMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+
+			token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok || strings.TrimSpace(token) == "" {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return newAPIError(http.StatusUnauthorized, "unauthorized", "A bearer token is required")
+			}
+
+			session, err := s.db.GetSession(ctx, strings.TrimSpace(token))
+			if err != nil {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+				return newAPIError(http.StatusUnauthorized, "invalid_token", "The bearer token is not a valid session token")
+			}
+
+			s.touchSession(ctx, &session)
+			c.Set("session", &session)
+
+			return next(c)
+		}
+	}
+}
+
+// touchSession records the activity of a session. Session activity drives which
+// stops the poller keeps warm, recording it once in a while is enough for that.
+func (s *Server) touchSession(ctx context.Context, session *store.Session) {
+	if session.LastSeenAt.Valid && time.Since(session.LastSeenAt.Time) <= sessionTouchInterval {
+		return
+	}
+
+	now := time.Now()
+	err := s.db.TouchSession(ctx, store.TouchSessionParams{
+		LastSeenAt: sql.NullTime{Time: now, Valid: true},
+		ID:         session.ID,
+	})
+	if err != nil {
+		log.Printf("Couldn't record the session activity: %v", err)
+		return
+	}
+	session.LastSeenAt = sql.NullTime{Time: now, Valid: true}
+}
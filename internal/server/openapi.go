@@ -0,0 +1,433 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jp-roisin/catch-and-go/internal/database/store"
+	"github.com/jp-roisin/catch-and-go/internal/openapi"
+	"github.com/labstack/echo/v4"
+)
+
+// The OpenAPI document describes every route of RegisterRoutes: the JSON API in
+// full, and the htmx endpoints as the HTML fragments they return. It is built
+// from the table below and from the DTOs of api.go, a test checks that the table
+// and the routes agree. `make openapi` writes it to api/openapi.json and
+// generates the client of the apiclient package from there.
+
+// openAPIRoute describes a route for the document. The path parameters are read
+// from the path, those ending in "Id" are integers and the others strings.
+type openAPIRoute struct {
+	method  string
+	path    string
+	id      string
+	summary string
+	tag     string
+	query   []openapi.Parameter
+
+	// JSON API
+	body      any // the request body
+	data      any // what the response envelope holds, a slice for lists
+	paginated bool
+	status    int  // of the success response, 200 when unset
+	public    bool // doesn't need a bearer token
+
+	// htmx front-end
+	html bool
+	form []openapi.Parameter
+}
+
+var pageParams = []openapi.Parameter{
+	queryParam("page", "integer", false, "The page, starting at 1"),
+	queryParam("per_page", "integer", false, fmt.Sprintf("The number of items of a page, %d by default and %d at most", apiDefaultPerPage, apiMaxPerPage)),
+}
+
+var nearbyParams = []openapi.Parameter{
+	queryParam("lat", "number", true, "The latitude of the position"),
+	queryParam("lon", "number", true, "The longitude of the position"),
+	queryParam("radius", "number", false, fmt.Sprintf("In meters, %d by default and %d at most", nearbyDefaultRadius, nearbyMaxRadius)),
+}
+
+var openAPIRoutes = []openAPIRoute{
+	// JSON API
+	{method: http.MethodPost, path: "/api/v1/sessions", id: "createSession", tag: "sessions", public: true, status: http.StatusCreated,
+		summary: "Starts an anonymous session, whose token authenticates the other requests", data: apiSession{}},
+	{method: http.MethodGet, path: "/api/v1/lines", id: "listLines", tag: "lines", query: pageParams, paginated: true,
+		summary: "Lists the lines of the network, in the order of the line picker", data: []apiLine{}},
+	{method: http.MethodGet, path: "/api/v1/lines/:lineCode/directions", id: "listDirections", tag: "lines",
+		summary: "Lists the directions of a line", data: []apiDirection{}},
+	{method: http.MethodGet, path: "/api/v1/directions/:lineId/stops", id: "listDirectionStops", tag: "lines",
+		summary: "Lists the stops of a direction in the order they are served", data: []apiStop{}},
+	{method: http.MethodGet, path: "/api/v1/stops", id: "searchStops", tag: "stops",
+		summary: "Finds the stops by their French or Dutch name, accents and typos included", data: []apiStop{},
+		query: []openapi.Parameter{
+			queryParam("q", "string", true, fmt.Sprintf("The searched name, at least %d letters", stopSearchMinLength)),
+			queryParam("limit", "integer", false, fmt.Sprintf("The number of stops, %d by default and %d at most", stopSearchLimit, apiMaxSearchLimit)),
+		}},
+	{method: http.MethodGet, path: "/api/v1/stops/nearby", id: "listNearbyStops", tag: "stops", query: nearbyParams,
+		summary: "Lists the stops around a position, closest first", data: []apiStop{}},
+	{method: http.MethodGet, path: "/api/v1/stops/:stopCode", id: "getStop", tag: "stops",
+		summary: "Returns a stop and the lines serving it", data: apiStop{}},
+	{method: http.MethodGet, path: "/api/v1/stops/:stopCode/departures", id: "listStopDepartures", tag: "departures",
+		summary: "Returns the upcoming departures of a stop", data: apiDepartures{}},
+	{method: http.MethodGet, path: "/api/v1/dashboards", id: "listDashboards", tag: "dashboards", query: pageParams, paginated: true,
+		summary: "Lists the dashboards of the session", data: []apiDashboard{}},
+	{method: http.MethodPost, path: "/api/v1/dashboards", id: "createDashboard", tag: "dashboards", status: http.StatusCreated,
+		summary: "Adds a dashboard to the session", body: apiCreateDashboardRequest{}, data: apiDashboard{}},
+	{method: http.MethodDelete, path: "/api/v1/dashboards/:dashboardId", id: "deleteDashboard", tag: "dashboards", status: http.StatusNoContent,
+		summary: "Removes a dashboard of the session, succeeding when it is already gone"},
+	{method: http.MethodGet, path: "/api/v1/dashboards/:dashboardId/departures", id: "listDashboardDepartures", tag: "departures",
+		summary: "Returns the upcoming departures of a dashboard, of its stop or of every platform of its station", data: apiDepartures{}},
+
+	// Service
+	{method: http.MethodGet, path: "/api/openapi.json", id: "getOpenAPI", tag: "service", public: true,
+		summary: "Returns this document"},
+	{method: http.MethodGet, path: "/health", id: "getHealth", tag: "service", public: true,
+		summary: "Returns the health of the database and of the real-time provider"},
+	{method: http.MethodGet, path: "/assets/*", id: "getAsset", tag: "service", public: true,
+		summary: "Serves the scripts, styles and images of the front-end"},
+
+	// htmx front-end
+	{method: http.MethodGet, path: "/", id: "getPage", html: true, summary: "Renders the page"},
+	{method: http.MethodGet, path: "/main", id: "getMain", html: true, summary: "Renders the main content of the page"},
+	{method: http.MethodGet, path: "/sessions", id: "getHeader", html: true, summary: "Renders the header with the settings of the session"},
+	{method: http.MethodPut, path: "/sessions/locale", id: "updateLocale", html: true, summary: "Changes the locale of the session",
+		form: []openapi.Parameter{formField("locale", "fr or nl")}},
+	{method: http.MethodPut, path: "/sessions/theme", id: "updateTheme", html: true, summary: "Changes the theme of the session",
+		form: []openapi.Parameter{formField("theme", "light or dark")}},
+	{method: http.MethodGet, path: "/lines/empty_state", id: "getEmptyState", html: true, summary: "Renders the dashboard of a session without stops"},
+	{method: http.MethodGet, path: "/lines/picker", id: "getLinePicker", html: true, summary: "Renders the line picker"},
+	{method: http.MethodGet, path: "/directions/picker/:lineCode", id: "getDirectionPicker", html: true, summary: "Renders the direction picker of a line"},
+	{method: http.MethodGet, path: "/lines/vehicles", id: "getLineVehicles", html: true, summary: "Renders where the vehicles of a direction are along its stops",
+		query: []openapi.Parameter{queryParam("line_id", "integer", true, "The id of the direction")}},
+	{method: http.MethodPost, path: "/stops/picker", id: "getStopPicker", html: true, summary: "Renders the stop picker of a direction",
+		form: []openapi.Parameter{formField("line_id", "The id of the direction")}},
+	{method: http.MethodGet, path: "/stops/search", id: "getStopSearch", html: true, summary: "Renders the stops matching a name",
+		query: []openapi.Parameter{queryParam("q", "string", false, "The searched name")}},
+	{method: http.MethodGet, path: "/stops/nearby", id: "getNearbyStops", html: true, summary: "Renders the stops around a position",
+		query: nearbyParams},
+	{method: http.MethodGet, path: "/dashboards", id: "getDashboards", html: true, summary: "Renders the dashboards of the session"},
+	{method: http.MethodPost, path: "/dashboards", id: "addDashboard", html: true, summary: "Adds a dashboard to the session and renders the main content",
+		form: []openapi.Parameter{formField("stop_id", "The id of the stop"), formField("follow_station", "true to show every platform of the station")}},
+	{method: http.MethodGet, path: "/dashboards/:dashboardId", id: "getDashboardContent", html: true, summary: "Renders the departures of a dashboard"},
+	{method: http.MethodDelete, path: "/dashboards/:dashboardId", id: "removeDashboard", html: true, summary: "Removes a dashboard of the session"},
+}
+
+// schemaDescriptions document the schemas of the DTOs.
+var schemaDescriptions = map[string]string{
+	"CreateDashboardRequest": "A dashboard to add to the session.",
+	"Dashboard":              "A stop followed by a session.",
+	"Departure":              "An upcoming departure.",
+	"Departures":             "A board of the upcoming departures of a stop, soonest first, and of the disruptions affecting it.",
+	"Direction":              "A line heading to one of its terminuses.",
+	"Error":                  "A code for programs to branch on, and a message for people.",
+	"Line":                   "A line regardless of its direction.",
+	"Pagination":             "The position of a page in its list.",
+	"Session":                "An anonymous session, the token is sent as a bearer token.",
+	"Stop":                   "A stop, or a platform of a station.",
+	"Text":                   "A text in French and in Dutch.",
+}
+
+// propertyDescriptions document the properties whose meaning isn't obvious, by
+// schema and JSON name.
+var propertyDescriptions = map[string]string{
+	"CreateDashboardRequest.follow_station": "Show the departures of every platform of the station of the stop.",
+	"Dashboard.follow_station":              "The dashboard shows the departures of every platform of the station of its stop.",
+	"Departure.due":                         "The vehicle is arriving within the minute.",
+	"Departure.minutes":                     "The number of whole minutes until expected_at, 0 when due.",
+	"Departures.stale":                      "The real-time provider couldn't be reached and older data is served.",
+	"Direction.direction":                   "Whether the line heads to the suburbs or to the city.",
+	"Stop.distance":                         "In meters from the searched position, for the nearby stops.",
+	"Stop.lines":                            "The codes of the lines serving the stop, when they are listed.",
+	"Stop.station_id":                       "The station of the platform, if any.",
+}
+
+var propertyEnums = map[string][]string{
+	"Direction.direction": {apiDirectionNames[store.TowardsSuburbs], apiDirectionNames[store.TowardsCity]},
+}
+
+func queryParam(name, typ string, required bool, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Required: required, Description: description, Schema: &openapi.Schema{Type: typ}}
+}
+
+// formField is a field of a form posted by htmx, they are all sent as strings.
+func formField(name, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, Description: description, Schema: &openapi.Schema{Type: "string"}}
+}
+
+var openAPIJSON = sync.OnceValues(func() ([]byte, error) {
+	return OpenAPIDocument().Marshal()
+})
+
+// OpenAPIHandler serves the OpenAPI document of the server.
+func (s *Server) OpenAPIHandler(c echo.Context) error {
+	doc, err := openAPIJSON()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't render the OpenAPI document")
+	}
+	return c.JSONBlob(http.StatusOK, doc)
+}
+
+// OpenAPIDocument describes the routes of the server.
+func OpenAPIDocument() *openapi.Document {
+	b := &schemaBuilder{schemas: map[string]*openapi.Schema{}}
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:   "Catch and Go API",
+			Version: "1.0.0",
+			Description: "The JSON API is served under /api/v1, authenticated with the token of an anonymous session " +
+				"sent as a bearer token. The other routes render the HTML fragments of the htmx front-end, " +
+				"for the session of the token cookie, which is created on the first visit.",
+		},
+		Paths: map[string]*openapi.PathItem{},
+		Components: openapi.Components{
+			Schemas: b.schemas,
+			SecuritySchemes: map[string]openapi.SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", Description: "The token of a session, see createSession."},
+			},
+		},
+	}
+
+	b.component("ErrorResponse", &openapi.Schema{
+		Type:        "object",
+		Description: "The body of the responses with an error status.",
+		Properties:  map[string]*openapi.Schema{"error": b.schema(reflect.TypeFor[apiError]())},
+		Required:    []string{"error"},
+	})
+
+	for _, r := range openAPIRoutes {
+		path := openAPIPath(r.path)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = &openapi.PathItem{}
+			doc.Paths[path] = item
+		}
+		(*item)[strings.ToLower(r.method)] = b.operation(r)
+	}
+	return doc
+}
+
+// openAPIPath turns an echo path into an OpenAPI one: "/stops/:stopCode" is
+// "/stops/{stopCode}" and "/assets/*" is "/assets/{path}".
+func openAPIPath(path string) string {
+	if prefix, ok := strings.CutSuffix(path, "*"); ok {
+		return strings.TrimSuffix(prefix, "/") + "/{path}"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if name, ok := strings.CutPrefix(s, ":"); ok {
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+type schemaBuilder struct {
+	schemas map[string]*openapi.Schema
+}
+
+func (b *schemaBuilder) operation(r openAPIRoute) *openapi.Operation {
+	op := &openapi.Operation{
+		OperationID: r.id,
+		Summary:     r.summary,
+		Responses:   map[string]*openapi.Response{},
+	}
+
+	for _, name := range pathParams(r.path) {
+		schema := &openapi.Schema{Type: "string"}
+		if strings.HasSuffix(name, "Id") {
+			schema = &openapi.Schema{Type: "integer", Format: "int64"}
+		}
+		op.Parameters = append(op.Parameters, openapi.Parameter{Name: name, In: "path", Required: true, Schema: schema})
+	}
+	op.Parameters = append(op.Parameters, r.query...)
+
+	if r.html {
+		op.Tags = []string{"web"}
+		if len(r.form) > 0 {
+			form := &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{}}
+			for _, f := range r.form {
+				form.Properties[f.Name] = &openapi.Schema{Type: f.Schema.Type, Description: f.Description}
+			}
+			op.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content:  map[string]openapi.MediaType{"application/x-www-form-urlencoded": {Schema: form}},
+			}
+		}
+		op.Responses["200"] = &openapi.Response{
+			Description: "An HTML fragment",
+			Content:     map[string]openapi.MediaType{"text/html": {Schema: &openapi.Schema{Type: "string"}}},
+		}
+		return op
+	}
+
+	op.Tags = []string{r.tag}
+	if !r.public {
+		op.Security = []openapi.SecurityRequirement{{"bearerAuth": {}}}
+	}
+	if r.body != nil {
+		op.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]openapi.MediaType{"application/json": {Schema: b.schema(reflect.TypeOf(r.body))}},
+		}
+	}
+
+	status := r.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	res := &openapi.Response{Description: http.StatusText(status)}
+	if schema := b.responseSchema(r); schema != nil {
+		res.Content = map[string]openapi.MediaType{"application/json": {Schema: schema}}
+	}
+	if r.path == "/assets/*" {
+		res.Content = map[string]openapi.MediaType{"*/*": {Schema: &openapi.Schema{Type: "string", Format: "binary"}}}
+	}
+	op.Responses[fmt.Sprint(status)] = res
+
+	if strings.HasPrefix(r.path, apiV1) {
+		op.Responses["default"] = &openapi.Response{
+			Description: "An error",
+			Content:     map[string]openapi.MediaType{"application/json": {Schema: openapi.Ref("ErrorResponse")}},
+		}
+	}
+	return op
+}
+
+// responseSchema is the schema of the envelope of a route: a Stop is returned
+// in a StopResponse, a list of them in a StopList, or in a StopPage when paginated.
+func (b *schemaBuilder) responseSchema(r openAPIRoute) *openapi.Schema {
+	switch r.path {
+	case "/health":
+		return &openapi.Schema{Type: "object", AdditionalProperties: &openapi.Schema{Type: "string"}}
+	case "/api/openapi.json":
+		return &openapi.Schema{Type: "object"}
+	}
+	if r.data == nil {
+		return nil
+	}
+
+	t := reflect.TypeOf(r.data)
+	data := b.schema(t)
+	var name, description string
+	switch {
+	case r.paginated:
+		name = schemaName(t.Elem()) + "Page"
+		description = fmt.Sprintf("A page of a list of %s.", schemaName(t.Elem()))
+	case t.Kind() == reflect.Slice:
+		name = schemaName(t.Elem()) + "List"
+		description = fmt.Sprintf("A list of %s.", schemaName(t.Elem()))
+	default:
+		name = schemaName(t) + "Response"
+		description = fmt.Sprintf("A response holding %s.", schemaName(t))
+	}
+
+	envelope := &openapi.Schema{
+		Type:        "object",
+		Description: description,
+		Properties:  map[string]*openapi.Schema{"data": data},
+		Required:    []string{"data"},
+	}
+	if r.paginated {
+		envelope.Properties["pagination"] = b.schema(reflect.TypeFor[apiPagination]())
+		envelope.Required = append(envelope.Required, "pagination")
+	}
+	return b.component(name, envelope)
+}
+
+// component registers a schema of the components and returns a reference to it.
+func (b *schemaBuilder) component(name string, s *openapi.Schema) *openapi.Schema {
+	b.schemas[name] = s
+	return openapi.Ref(name)
+}
+
+// schema describes a DTO type, its structs are registered as components.
+func (b *schemaBuilder) schema(t reflect.Type) *openapi.Schema {
+	switch t {
+	case reflect.TypeFor[time.Time]():
+		return &openapi.Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := b.schema(t.Elem())
+		s.Nullable = true
+		return s
+	case reflect.Slice:
+		return &openapi.Schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &openapi.Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.String:
+		return &openapi.Schema{Type: "string"}
+	case reflect.Bool:
+		return &openapi.Schema{Type: "boolean"}
+	case reflect.Int:
+		return &openapi.Schema{Type: "integer"}
+	case reflect.Int64:
+		return &openapi.Schema{Type: "integer", Format: "int64"}
+	case reflect.Float64:
+		return &openapi.Schema{Type: "number", Format: "double"}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := b.schemas[name]; !ok {
+			b.schemas[name] = nil // the struct may refer to itself
+			b.schemas[name] = b.object(name, t)
+		}
+		return openapi.Ref(name)
+	}
+	panic(fmt.Sprintf("openapi: no schema for %s", t))
+}
+
+func (b *schemaBuilder) object(name string, t reflect.Type) *openapi.Schema {
+	s := &openapi.Schema{
+		Type:        "object",
+		Description: schemaDescriptions[name],
+		Properties:  map[string]*openapi.Schema{},
+	}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		prop, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if prop == "-" || !field.IsExported() {
+			continue
+		}
+
+		p := b.schema(field.Type)
+		if p.Ref == "" {
+			p.Description = propertyDescriptions[name+"."+prop]
+			p.Enum = propertyEnums[name+"."+prop]
+		}
+		s.Properties[prop] = p
+		if opts != "omitempty" {
+			s.Required = append(s.Required, prop)
+		}
+	}
+	return s
+}
+
+// schemaName is the name of the schema of a DTO: apiStop is a Stop.
+func schemaName(t reflect.Type) string {
+	name := strings.TrimPrefix(t.Name(), "api")
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+func pathParams(path string) []string {
+	var names []string
+	for _, s := range strings.Split(path, "/") {
+		if name, ok := strings.CutPrefix(s, ":"); ok {
+			names = append(names, name)
+		}
+	}
+	if strings.HasSuffix(path, "*") {
+		names = append(names, "path")
+	}
+	return names
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestOpenAPICoversRoutes fails when a route is added to RegisterRoutes without
+// being described in openAPIRoutes, or when a described route is gone.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	s := &Server{db: &fakeDB{}}
+	e := s.RegisterRoutes().(*echo.Echo)
+	doc := OpenAPIDocument()
+
+	registered := map[string]bool{}
+	for _, r := range e.Routes() {
+		// Groups with middlewares register catch-all routes to run them on 404s
+		if r.Method == echo.RouteNotFound {
+			continue
+		}
+		route := r.Method + " " + openAPIPath(r.Path)
+		registered[route] = true
+
+		item, ok := doc.Paths[openAPIPath(r.Path)]
+		if !ok || (*item)[strings.ToLower(r.Method)] == nil {
+			t.Errorf("%s is registered but missing from the OpenAPI document", route)
+		}
+	}
+
+	var ids []string
+	for path, item := range doc.Paths {
+		for method, op := range *item {
+			if route := strings.ToUpper(method) + " " + path; !registered[route] {
+				t.Errorf("%s is in the OpenAPI document but isn't registered", route)
+			}
+			if slices.Contains(ids, op.OperationID) {
+				t.Errorf("the operation id %s is used twice", op.OperationID)
+			}
+			ids = append(ids, op.OperationID)
+		}
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	s := &Server{db: &fakeDB{}}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	resp := httptest.NewRecorder()
+	s.RegisterRoutes().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", resp.Code, resp.Body.String())
+	}
+	var doc struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid document: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") || doc.Paths["/api/v1/stops/{stopCode}/departures"]["get"] == nil {
+		t.Errorf("the served document isn't the OpenAPI document of the server: %s", resp.Body.String())
+	}
+}
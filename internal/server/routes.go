@@ -1,15 +1,22 @@
 package server
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
-	"sort"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/jp-roisin/catch-and-go/cmd/web"
 	"github.com/jp-roisin/catch-and-go/cmd/web/components"
+	"github.com/jp-roisin/catch-and-go/internal/database"
 	"github.com/jp-roisin/catch-and-go/internal/database/store"
 	"github.com/jp-roisin/catch-and-go/internal/externalapi"
 	"github.com/labstack/echo/v4"
@@ -45,13 +52,18 @@ func (s *Server) RegisterRoutes() http.Handler {
 	e.GET("/lines/empty_state", s.LinesEmptyStateHandler)
 	e.GET("/lines/picker", s.LinesPickerHandler)
 	e.GET("/directions/picker/:lineCode", s.DirectionsPickerHandler)
+	e.GET("/lines/vehicles", s.LineVehiclesHandler)
 	e.POST("/stops/picker", s.StopsPickerHandler)
+	e.GET("/stops/search", s.StopSearchHandler)
+	e.GET("/stops/nearby", s.NearbyStopsHandler)
 
 	e.GET("/dashboards", s.GetDashboardsHandler)
 	e.GET("/dashboards/:dashboardId", s.GetDashboardContentHandler)
 	e.POST("/dashboards", s.CreateDashboardHandler)
 	e.DELETE("/dashboards/:dashboardId", s.DeleteDashboardHandler)
 
+	s.registerAPIRoutes(e)
+
 	return e
 }
 
@@ -64,7 +76,13 @@ func (s *Server) HelloWorldHandler(c echo.Context) error {
 }
 
 func (s *Server) healthHandler(c echo.Context) error {
-	return c.JSON(http.StatusOK, s.db.Health())
+	stats := s.db.Health()
+	if reporter, ok := s.wt.(externalapi.HealthReporter); ok {
+		for k, v := range reporter.Health() {
+			stats[k] = v
+		}
+	}
+	return c.JSON(http.StatusOK, stats)
 }
 
 func (s *Server) GetSessionHandler(c echo.Context) error {
@@ -169,37 +187,36 @@ func (s *Server) BaseWebHandler(c echo.Context) error {
 
 func (s *Server) LinesPickerHandler(c echo.Context) error {
 	ctx := c.Request().Context()
-	var linesWithFallback []store.LineWithFallback
-	lines, err := s.db.ListLinesByDirection(ctx, int(store.TowardsCity))
-	for _, l := range lines {
-		linesWithFallback = append(linesWithFallback, l.AddFallback())
+	session, ok := c.Get("session").(*store.Session)
+	if !ok {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the session token")
 	}
 
+	lines, err := s.db.ListLines(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the lines info")
 	}
 
-	// Even though the DB query orders the results by the 'code' column in ASC order,
-	// we need to sort them again here manually because 'code' column is a string.
-	// As a result, "11" would come before "2" (string comparison), which is incorrect for numeric ordering.
-	//
-	// We keep 'code' as a string for now because we might allow special or momentary line codes later,
-	// like "T92", which wouldn't work with a numeric column.
-	sort.Slice(linesWithFallback, func(i, j int) bool {
-		i, err = strconv.Atoi(linesWithFallback[i].Code)
-		if err != nil {
-			return false
-		}
-		j, err = strconv.Atoi(linesWithFallback[j].Code)
-		if err != nil {
-			return false
+	// A line has a row per direction, some like the N12 run in a single one
+	var linesWithFallback []store.LineWithFallback
+	seen := make(map[string]bool, len(lines))
+	for _, l := range lines {
+		if seen[l.Code] {
+			continue
 		}
+		seen[l.Code] = true
+		linesWithFallback = append(linesWithFallback, l.AddFallback())
+	}
 
-		return i < j
+	// The DB query orders the results by the 'code' column, which is a string:
+	// "11" would come before "2", and the lettered codes like "N12" or "T92"
+	// would be mixed with the numeric ones.
+	slices.SortStableFunc(linesWithFallback, func(a, b store.LineWithFallback) int {
+		return store.CompareLineCodes(a.Code, b.Code)
 	})
 
 	var sb strings.Builder
-	if err := components.LinePicker(linesWithFallback).Render(c.Request().Context(), &sb); err != nil {
+	if err := components.LinePicker(linesWithFallback, session.Locale).Render(c.Request().Context(), &sb); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Rendering of the line pickers failed")
 	}
 
@@ -213,7 +230,7 @@ func (s *Server) LinesEmptyStateHandler(c echo.Context) error {
 	}
 
 	var sb strings.Builder
-	if err := components.EmptyState(session.Theme).Render(c.Request().Context(), &sb); err != nil {
+	if err := components.EmptyState(session.Theme, session.Locale).Render(c.Request().Context(), &sb); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Rendering of the empty state failed")
 	}
 
@@ -234,17 +251,8 @@ func (s *Server) DirectionsPickerHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the lines for that code")
 	}
 
-	var props []store.Line
-	for _, l := range lines {
-		translatedLine, err := l.Translate(session.Locale)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Something is wrong about this line info: %v", l.Code))
-		}
-		props = append(props, translatedLine)
-	}
-
 	var sb strings.Builder
-	if err := components.DirectionPicker(props).Render(c.Request().Context(), &sb); err != nil {
+	if err := components.DirectionPicker(lines, session.Locale).Render(c.Request().Context(), &sb); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Rendering of the direction picker failed")
 	}
 
@@ -270,23 +278,225 @@ func (s *Server) StopsPickerHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the stops info")
 	}
 
-	var props []store.Stop
-	for _, s := range stops {
-		translatedStop, err := s.Translate(session.Locale)
+	var sb strings.Builder
+	if err := components.StopPicker(stops, session.Locale).Render(c.Request().Context(), &sb); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Rendering of the stops pickers failed")
+	}
+
+	return c.HTML(http.StatusOK, sb.String())
+}
+
+// Stops are searched from the second letter, and only the best matches are listed
+const (
+	stopSearchMinLength = 2
+	stopSearchLimit     = 10
+)
+
+// StopSearchHandler is the type-ahead of the line picker, for people who know
+// the name of their stop but not the line serving it.
+func (s *Server) StopSearchHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	query := strings.TrimSpace(c.QueryParam("q"))
+
+	session, ok := c.Get("session").(*store.Session)
+	if !ok {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the session token")
+	}
+
+	var results []components.StopSearchResult
+	if utf8.RuneCountInString(query) < stopSearchMinLength {
+		query = ""
+	} else {
+		stops, err := s.db.SearchStops(ctx, query, stopSearchLimit)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Something is wrong about this stop info: %v", s.Code))
+			return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't search the stops")
+		}
+
+		for _, stop := range stops {
+			result, err := s.stopResult(ctx, stop, session.Locale)
+			if err != nil {
+				return err
+			}
+			results = append(results, result)
 		}
-		props = append(props, translatedStop)
 	}
 
 	var sb strings.Builder
-	if err := components.StopPicker(props).Render(c.Request().Context(), &sb); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Rendering of the stops pickers failed")
+	if err := components.StopSearchResults(query, results, session.Locale).Render(c.Request().Context(), &sb); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Rendering of the stop search failed")
+	}
+
+	return c.HTML(http.StatusOK, sb.String())
+}
+
+// Nearby stops are within walking distance by default, and never further than a few minutes by bike
+const (
+	nearbyDefaultRadius = 500
+	nearbyMaxRadius     = 2000
+	nearbyLimit         = 10
+)
+
+// NearbyStopsHandler lists the stops around a position, closest first, to add
+// the dashboard of the stop people are standing at.
+func (s *Server) NearbyStopsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	latitude, longitude, radius, err := nearbyQuery(c)
+	if err != nil {
+		return err
+	}
+
+	session, ok := c.Get("session").(*store.Session)
+	if !ok {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the session token")
+	}
+
+	stops, err := s.db.ListStopsNearby(ctx, latitude, longitude, radius, nearbyLimit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the nearby stops")
+	}
+
+	var results []components.StopSearchResult
+	for _, stop := range stops {
+		result, err := s.stopResult(ctx, stop.Stop, session.Locale)
+		if err != nil {
+			return err
+		}
+		distance := int(math.Round(stop.Distance))
+		result.Distance = &distance
+		results = append(results, result)
+	}
+
+	var sb strings.Builder
+	if err := components.NearbyStops(results, session.Locale).Render(c.Request().Context(), &sb); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Rendering of the nearby stops failed")
+	}
+
+	return c.HTML(http.StatusOK, sb.String())
+}
+
+// nearbyQuery reads the position and the radius of a nearby stops request.
+func nearbyQuery(c echo.Context) (latitude, longitude, radius float64, err error) {
+	latitude, err = strconv.ParseFloat(c.QueryParam("lat"), 64)
+	if err != nil || latitude < -90 || latitude > 90 {
+		return 0, 0, 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid lat: %q is not a latitude", c.QueryParam("lat")))
+	}
+	longitude, err = strconv.ParseFloat(c.QueryParam("lon"), 64)
+	if err != nil || longitude < -180 || longitude > 180 {
+		return 0, 0, 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid lon: %q is not a longitude", c.QueryParam("lon")))
+	}
+	radius = float64(nearbyDefaultRadius)
+	if r := c.QueryParam("radius"); r != "" {
+		radius, err = strconv.ParseFloat(r, 64)
+		if err != nil || radius <= 0 || radius > nearbyMaxRadius {
+			return 0, 0, 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid radius: must be a number of meters up to %d", nearbyMaxRadius))
+		}
+	}
+	return latitude, longitude, radius, nil
+}
+
+// stopResult is a stop in the locale of the session, with the lines serving it.
+func (s *Server) stopResult(ctx context.Context, stop store.Stop, locale string) (components.StopSearchResult, error) {
+	lineCodes, err := s.db.ListLineCodesFromStop(ctx, stop.ID)
+	if err != nil {
+		return components.StopSearchResult{}, echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the lines of the stop")
+	}
+	slices.SortFunc(lineCodes, store.CompareLineCodes)
+
+	return components.StopSearchResult{
+		ID:    stop.ID,
+		Code:  stop.Code,
+		Name:  stop.Name(locale),
+		Lines: lineCodes,
+	}, nil
+}
+
+// LineVehiclesHandler shows where the vehicles of a line direction are along its stops.
+// It complements the dashboards, which only tell how many minutes are left.
+func (s *Server) LineVehiclesHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	lineID := c.QueryParam("line_id")
+
+	id, err := strconv.Atoi(lineID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid lineId: %q is not a number", lineID))
+	}
+
+	session, ok := c.Get("session").(*store.Session)
+	if !ok {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the session token")
+	}
+
+	line, err := s.db.GetLineById(ctx, int64(id))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Couldn't retreive the line info")
+	}
+	stops, err := s.db.ListStopsFromLine(ctx, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the stops info")
+	}
+
+	props := components.VehicleTrackProps{
+		Line:   line,
+		Locale: session.Locale,
+	}
+
+	var vehicles []externalapi.VehiclePosition
+	provider, ok := s.wt.(externalapi.VehiclePositionProvider)
+	if !ok {
+		props.Degraded = true
+	} else if positions, err := provider.GetVehiclePositions(ctx, line.Code); err != nil {
+		log.Printf("Vehicle positions lookup failed for line %s: %v", line.Code, err)
+		props.Degraded = true
+		props.Degradation = degradationFromError(err)
+	} else {
+		// Vehicles are heading to the last stop of the direction
+		if len(stops) > 0 {
+			vehicles = positions.Towards(stops[len(stops)-1].Code)
+		}
+		props.Stale = positions.Stale
+		props.DataAge = int(s.now().Sub(positions.FetchedAt).Minutes())
+	}
+
+	props.Stops = placeVehicles(stops, vehicles, session.Locale)
+
+	var sb strings.Builder
+	if err := components.VehicleTrack(props).Render(c.Request().Context(), &sb); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Rendering of the vehicle track failed")
 	}
 
 	return c.HTML(http.StatusOK, sb.String())
 }
 
+// placeVehicles lays the vehicles out along the ordered stops of a line.
+// A vehicle is at its last passed stop when it hasn't moved from it yet,
+// and on its way to the next one otherwise. Vehicles reported at a stop
+// that isn't part of the line are left out.
+func placeVehicles(stops []store.Stop, vehicles []externalapi.VehiclePosition, locale string) []components.VehicleStop {
+	track := make([]components.VehicleStop, len(stops))
+	index := make(map[string]int, len(stops))
+	for i, stop := range stops {
+		track[i].Name = stop.Name(locale)
+		if _, ok := index[stop.Code]; !ok {
+			index[stop.Code] = i
+		}
+	}
+
+	for _, v := range vehicles {
+		i, ok := index[v.PointID]
+		if !ok {
+			continue
+		}
+		if v.DistanceFromPoint == 0 || i == len(track)-1 {
+			track[i].AtStop++
+		} else {
+			track[i].Leaving++
+		}
+	}
+
+	return track
+}
+
 func (s *Server) CreateDashboardHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 	stopId, err := strconv.Atoi(c.FormValue("stop_id"))
@@ -294,14 +504,24 @@ func (s *Server) CreateDashboardHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid stop_id: must be an integer")
 	}
 
+	// The dashboard shows either the chosen platform or every platform of its station
+	followStation := c.FormValue("follow_station") == "true"
+
+	if err := s.checkDashboardStop(ctx, int64(stopId)); errors.Is(err, errStopNotInNetwork) {
+		return echo.NewHTTPError(http.StatusNotFound, "Stop not found")
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the stop")
+	}
+
 	session, ok := c.Get("session").(*store.Session)
 	if !ok {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the session token")
 	}
 
 	_, dbErr := s.db.CreateDashboard(ctx, store.CreatedashboardParams{
-		SessionID: session.ID,
-		StopID:    int64(stopId),
+		SessionID:     session.ID,
+		StopID:        int64(stopId),
+		FollowStation: followStation,
 	})
 	if dbErr != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't persist the dashboard")
@@ -315,6 +535,26 @@ func (s *Server) CreateDashboardHandler(c echo.Context) error {
 	return c.HTML(http.StatusCreated, sb.String())
 }
 
+// errStopNotInNetwork is returned for the stops a dashboard can't follow.
+var errStopNotInNetwork = errors.New("the stop isn't in the network")
+
+// checkDashboardStop refuses the stops missing from the network, the placeholder of
+// the unknown stops and the stops that left the network. Foreign keys aren't
+// enforced, nothing else would keep a dashboard from pointing to them.
+func (s *Server) checkDashboardStop(ctx context.Context, stopID int64) error {
+	stop, err := s.db.GetStopById(ctx, stopID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errStopNotInNetwork
+	}
+	if err != nil {
+		return err
+	}
+	if stop.Code == database.UnknownStopCode || stop.RemovedAt.Valid {
+		return errStopNotInNetwork
+	}
+	return nil
+}
+
 func (s *Server) GetDashboardsHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 	session, ok := c.Get("session").(*store.Session)
@@ -327,18 +567,11 @@ func (s *Server) GetDashboardsHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the dashboard")
 	}
 
-	var translatedDashboards []store.ListDashboardsFromSessionRow
-	for _, d := range dashboards {
-		translatedDashboard, err := d.Translate(session.Locale)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Something is wrong about this stop info: %v", d.DashboardID))
-		}
-		translatedDashboards = append(translatedDashboards, translatedDashboard)
-
-	}
+	// The cards load right after the list, from the cache this fills
+	s.prefetchDashboardStops(ctx, dashboards)
 
 	var sb strings.Builder
-	if err := components.Dashboard(translatedDashboards).Render(c.Request().Context(), &sb); err != nil {
+	if err := components.Dashboard(dashboards, session.Locale).Render(c.Request().Context(), &sb); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Rendering of the empty state failed")
 	}
 
@@ -390,44 +623,237 @@ func (s *Server) GetDashboardContentHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the dashboard with stop info")
 	}
 
-	res, err := externalapi.GetWaitingTimeForStop(d.StopCode)
+	// The stop left the network on the last reseed and no replacement was found
+	if d.StopRemovedAt.Valid {
+		return s.renderDegradedDashboard(c, components.DegradationStopRemoved, session.Locale)
+	}
+
+	res, err := s.waitingTimesForStops(ctx, s.dashboardStopCodes(ctx, d.StopCode, d.StopStationID, d.FollowStation))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		// The raw upstream error stays in the logs, the card shows a localized
+		// explanation instead.
+		log.Printf("Real-time lookup failed for stop %s: %v", d.StopCode, err)
+		return s.renderDegradedDashboard(c, degradationFromError(err), session.Locale)
+	}
+
+	now := s.now()
+	departures, err := s.upcomingDepartures(ctx, res, now)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the line info")
 	}
 
 	var passingTimes []components.PassingTime
+	for _, d := range departures {
+		passingTimes = append(passingTimes, components.PassingTime{
+			LineCode:            d.Line.Code,
+			Mode:                d.Line.Mode,
+			Color:               d.Line.Color,
+			TextColor:           d.Line.TextColor,
+			Destination:         d.Destination,
+			ExpectedArrivalTime: d.Minutes,
+		})
+	}
 
+	var sb strings.Builder
+	if err := components.DashboardContent(components.DashboardContentProps{
+		PassingTimes: passingTimes,
+		Disruptions:  s.disruptionsForStop(ctx, d.StopID, d.StopCode, res),
+		Locale:       session.Locale,
+		Stale:        res.Stale,
+		DataAge:      int(now.Sub(res.FetchedAt).Minutes()),
+	}).Render(c.Request().Context(), &sb); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Rendering of the empty state failed")
+	}
+
+	return c.HTML(http.StatusCreated, sb.String())
+}
+
+// dashboardStopCodes returns the codes of the stops a dashboard shows: its stop,
+// or all the platforms of its station when it follows the whole station.
+func (s *Server) dashboardStopCodes(ctx context.Context, stopCode string, stationID sql.NullInt64, followStation bool) []string {
+	if !followStation || !stationID.Valid {
+		return []string{stopCode}
+	}
+
+	codes, err := s.db.ListStopCodesFromStation(ctx, stationID.Int64)
+	if err != nil || len(codes) == 0 {
+		log.Printf("Couldn't list the platforms of the station of stop %s: %v", stopCode, err)
+		return []string{stopCode}
+	}
+	return codes
+}
+
+// waitingTimesForStops returns the real-time results of several stops as a single
+// response, which is as old as its oldest part. Platforms unknown to the provider
+// are left out, unless none of them is known.
+func (s *Server) waitingTimesForStops(ctx context.Context, stopCodes []string) (externalapi.Response, error) {
+	if len(stopCodes) == 1 {
+		return s.wt.GetWaitingTimeForStop(ctx, stopCodes[0])
+	}
+
+	var merged externalapi.Response
+	var lastErr error
+	found := false
+	for _, code := range stopCodes {
+		res, err := s.wt.GetWaitingTimeForStop(ctx, code)
+		if errors.Is(err, externalapi.ErrStopUnknown) {
+			lastErr = err
+			continue
+		}
+		if err != nil {
+			return externalapi.Response{}, err
+		}
+
+		merged.WaitingTimes = append(merged.WaitingTimes, res.WaitingTimes...)
+		merged.TotalCount += res.TotalCount
+		merged.Stale = merged.Stale || res.Stale
+		if !found || res.FetchedAt.Before(merged.FetchedAt) {
+			merged.FetchedAt = res.FetchedAt
+		}
+		found = true
+	}
+
+	if !found {
+		return externalapi.Response{}, lastErr
+	}
+	return merged, nil
+}
+
+// lineDeparture is an upcoming departure and the line making it.
+type lineDeparture struct {
+	externalapi.Departure
+	Line store.Line
+}
+
+// upcomingDepartures evaluates the passing times of a real-time result at now,
+// soonest first. The vehicles that have already left are dropped, and so are the
+// passing times the provider sent garbled.
+func (s *Server) upcomingDepartures(ctx context.Context, res externalapi.Response, now time.Time) ([]lineDeparture, error) {
+	var departures []lineDeparture
 	for _, wt := range res.WaitingTimes {
-		line, err := s.db.GetLine(ctx, store.GetLineParams{
-			Code:      wt.LineID,
-			Direction: 0, // We're only looking for the metadata which are the same in both directions
-		})
+		line, err := s.realtimeLine(ctx, wt.LineID)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Couldn't retreive the line info")
+			return nil, err
 		}
 
 		for _, pt := range wt.PassingTimes {
-			passingTimes = append(passingTimes, components.PassingTime{
-				LineCode:            line.Code,
-				Mode:                line.Mode,
-				Color:               line.Color,
-				TextColor:           line.TextColor,
-				Destination:         pt.Destination,
-				ExpectedArrivalTime: externalapi.MinutesFromNow(pt.ExpectedArrivalTime),
-			})
+			departure, err := externalapi.NewDeparture(pt, now)
+			if err != nil {
+				log.Printf("Skipping passing time of line %s at stop %s: %v", wt.LineID, wt.PointID, err)
+				continue
+			}
+			if departure.State == externalapi.DepartureDeparted {
+				continue
+			}
+			departures = append(departures, lineDeparture{Departure: departure, Line: line})
 		}
 	}
-	sort.Slice(passingTimes, func(i, j int) bool {
-		return passingTimes[i].ExpectedArrivalTime < passingTimes[j].ExpectedArrivalTime
+
+	slices.SortStableFunc(departures, func(a, b lineDeparture) int {
+		return a.ExpectedAt.Compare(b.ExpectedAt)
 	})
+	return departures, nil
+}
 
+// realtimeLine returns the line of a real-time result. We're only looking for
+// the metadata, which are the same in both directions, but some lines (like the
+// night ones) may be seeded in one direction only. A line missing from the
+// network is shown with the fallback metadata rather than failing the whole card.
+func (s *Server) realtimeLine(ctx context.Context, lineID string) (store.Line, error) {
+	code := store.NormalizeLineCode(lineID)
+	for _, direction := range []store.Direction{store.TowardsSuburbs, store.TowardsCity} {
+		line, err := s.db.GetLine(ctx, store.GetLineParams{Code: code, Direction: int64(direction)})
+		if err == nil {
+			return line, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return store.Line{}, err
+		}
+	}
+
+	log.Printf("Line %s of the real-time results is not in the network", lineID)
+	return store.Line{Code: code, TextColor: "#ffffff"}, nil
+}
+
+// disruptionsForStop returns the traveller information messages affecting the stop
+// or one of the lines serving it, according to the network data or to the real-time results.
+// Disruptions are an extra: failing to get them is logged and the card shown without them.
+func (s *Server) disruptionsForStop(ctx context.Context, stopID int64, stopCode string, res externalapi.Response) []externalapi.I18n {
+	provider, ok := s.wt.(externalapi.TravellerInformationProvider)
+	if !ok {
+		return nil
+	}
+
+	lineCodes, err := s.db.ListLineCodesFromStop(ctx, stopID)
+	if err != nil {
+		log.Printf("Couldn't list the lines of stop %s: %v", stopCode, err)
+	}
+	for _, wt := range res.WaitingTimes {
+		lineCodes = append(lineCodes, wt.LineID)
+	}
+
+	disruptions, err := provider.GetDisruptions(ctx)
+	if err != nil {
+		log.Printf("Couldn't retrieve the traveller information: %v", err)
+		return nil
+	}
+
+	var texts []externalapi.I18n
+	for _, m := range disruptions.ForStop(stopCode, lineCodes) {
+		texts = append(texts, m.Text)
+	}
+	return texts
+}
+
+// renderDegradedDashboard renders the explanation of a dashboard without data.
+// It's rendered with a 200 since htmx doesn't swap errors.
+func (s *Server) renderDegradedDashboard(c echo.Context, d components.Degradation, locale string) error {
 	var sb strings.Builder
-	if err := components.DashboardContent(components.DashboardContentProps{
-		PassingTimes: passingTimes,
-		Locale:       session.Locale,
-	}).Render(c.Request().Context(), &sb); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Rendering of the empty state failed")
+	if err := components.DashboardContentDegraded(d, locale).Render(c.Request().Context(), &sb); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Rendering of the degraded state failed")
 	}
 
-	return c.HTML(http.StatusCreated, sb.String())
+	return c.HTML(http.StatusOK, sb.String())
+}
+
+func degradationFromError(err error) components.Degradation {
+	switch {
+	case errors.Is(err, externalapi.ErrUnauthorized):
+		return components.DegradationUnauthorized
+	case errors.Is(err, externalapi.ErrQuotaExceeded):
+		return components.DegradationQuotaExceeded
+	case errors.Is(err, externalapi.ErrUpstreamUnavailable):
+		return components.DegradationUnavailable
+	case errors.Is(err, externalapi.ErrStopUnknown):
+		return components.DegradationStopUnknown
+	case errors.Is(err, externalapi.ErrDecode):
+		return components.DegradationDecode
+	default:
+		return components.DegradationUnknown
+	}
+}
+
+// prefetchDashboardStops warms the real-time cache for every stop of the
+// dashboards with a single batched upstream call. It runs once when the list of
+// dashboards is loaded, the cards are then served from the cache.
+func (s *Server) prefetchDashboardStops(ctx context.Context, dashboards []store.ListDashboardsFromSessionRow) {
+	batcher, ok := s.wt.(externalapi.BatchWaitingTimeProvider)
+	if !ok {
+		return
+	}
+
+	stopCodes := make([]string, 0, len(dashboards))
+	for _, d := range dashboards {
+		stopCodes = append(stopCodes, s.dashboardStopCodes(ctx, d.StopCode, d.StopStationID, d.FollowStation)...)
+	}
+	if len(stopCodes) < 2 {
+		return
+	}
+
+	slices.Sort(stopCodes)
+	stopCodes = slices.Compact(stopCodes)
+
+	if _, err := batcher.GetWaitingTimesForStops(ctx, stopCodes); err != nil {
+		log.Printf("Batched real-time lookup failed: %v", err)
+	}
 }
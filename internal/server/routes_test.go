@@ -1,12 +1,27 @@
 package server
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
-	"github.com/labstack/echo/v4"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/jp-roisin/catch-and-go/cmd/web/components"
+	"github.com/jp-roisin/catch-and-go/internal/database"
+	"github.com/jp-roisin/catch-and-go/internal/database/store"
+	"github.com/jp-roisin/catch-and-go/internal/externalapi"
+	"github.com/jp-roisin/catch-and-go/internal/externalapi/stibmock"
+	"github.com/labstack/echo/v4"
 )
 
 func TestHandler(t *testing.T) {
@@ -37,3 +52,495 @@ func TestHandler(t *testing.T) {
 		return
 	}
 }
+
+type fakeDB struct {
+	database.Service
+	dashboards []store.GetDashboardByIdWithStopInfoRow
+	lines      map[string]store.Line
+	stations   map[int64][]string
+	stops      []store.Stop
+	stopLines  map[int64][]string
+	searches   []string
+	nearby     []database.NearbyStop
+	listings   int
+}
+
+func (f *fakeDB) ListStopsNearby(ctx context.Context, latitude, longitude, radius float64, limit int) ([]database.NearbyStop, error) {
+	var stops []database.NearbyStop
+	for _, stop := range f.nearby {
+		if stop.Distance <= radius {
+			stops = append(stops, stop)
+		}
+	}
+	return stops, nil
+}
+
+func (f *fakeDB) SearchStops(ctx context.Context, query string, limit int) ([]store.Stop, error) {
+	f.searches = append(f.searches, query)
+	return f.stops, nil
+}
+
+func (f *fakeDB) ListStopCodesFromStation(ctx context.Context, stationID int64) ([]string, error) {
+	return f.stations[stationID], nil
+}
+
+func (f *fakeDB) GetDashboardByIdWithStopInfo(ctx context.Context, param store.GetDashboardByIdWithStopInfoParams) (store.GetDashboardByIdWithStopInfoRow, error) {
+	for _, d := range f.dashboards {
+		if d.DashboardID == param.ID {
+			return d, nil
+		}
+	}
+	return store.GetDashboardByIdWithStopInfoRow{}, sql.ErrNoRows
+}
+
+func (f *fakeDB) ListDashboardsFromSession(ctx context.Context, sessionID string) ([]store.ListDashboardsFromSessionRow, error) {
+	f.listings++
+	var rows []store.ListDashboardsFromSessionRow
+	for _, d := range f.dashboards {
+		rows = append(rows, store.ListDashboardsFromSessionRow{DashboardID: d.DashboardID, StopCode: d.StopCode})
+	}
+	return rows, nil
+}
+
+func (f *fakeDB) ListLineCodesFromStop(ctx context.Context, stopID int64) ([]string, error) {
+	return f.stopLines[stopID], nil
+}
+
+func (f *fakeDB) GetLine(ctx context.Context, param store.GetLineParams) (store.Line, error) {
+	l, ok := f.lines[param.Code]
+	if !ok {
+		return store.Line{}, sql.ErrNoRows
+	}
+	return l, nil
+}
+
+func TestGetDashboardContentHandler(t *testing.T) {
+	now := time.Date(2025, 8, 1, 8, 0, 0, 0, time.UTC)
+
+	wt := externalapi.NewFixtureProvider()
+	wt.Add(externalapi.WaitingTime{
+		PointID: "8042",
+		LineID:  "5",
+		PassingTimes: externalapi.PassingTimeList{
+			{
+				Destination:         externalapi.I18n{FR: "STOCKEL", NL: "STOKKEL"},
+				ExpectedArrivalTime: "2025-08-01T10:05:00+02:00",
+				LineID:              "5",
+			},
+			{
+				Destination:         externalapi.I18n{FR: "ERASME", NL: "ERASMUS"},
+				ExpectedArrivalTime: "2025-08-01T09:55:00+02:00",
+				LineID:              "5",
+			},
+		},
+	})
+
+	wt.AddMessage(externalapi.Message{
+		Text:  externalapi.I18n{FR: "Travaux sur la ligne 5", NL: "Werken op lijn 5"},
+		Lines: []string{"5"},
+	})
+
+	s := &Server{
+		db: &fakeDB{
+			dashboards: []store.GetDashboardByIdWithStopInfoRow{{DashboardID: 1, StopCode: "8042"}},
+			lines: map[string]store.Line{
+				"5": {Code: "5", Mode: sql.NullString{String: "metro", Valid: true}},
+			},
+		},
+		wt:    wt,
+		clock: func() time.Time { return now },
+	}
+
+	resp, err := getDashboardContent(s, 1)
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	body := resp.Body.String()
+	if !strings.Contains(body, "STOKKEL") || !strings.Contains(body, "5 min.") {
+		t.Errorf("handler() body doesn't contain the upcoming passing time: %s", body)
+	}
+	if !strings.Contains(body, "Werken op lijn 5") {
+		t.Errorf("handler() body doesn't contain the disruption of the line: %s", body)
+	}
+	if strings.Contains(body, "ERASMUS") {
+		t.Errorf("handler() body contains a departed passing time: %s", body)
+	}
+}
+
+func TestGetDashboardsHandlerPrefetchesTheCards(t *testing.T) {
+	srv, mock := stibmock.NewServer(stibmock.Scenario{
+		Default: stibmock.Stop{WaitingTimes: []stibmock.WaitingTime{{
+			LineID: "5",
+			PassingTimes: []stibmock.PassingTime{
+				{Destination: stibmock.I18n{FR: "STOCKEL", NL: "STOKKEL"}, ExpectedArrivalTime: "5m", LineID: "5"},
+			},
+		}}},
+	})
+	defer srv.Close()
+
+	const cards = 8
+	db := &fakeDB{lines: map[string]store.Line{"5": {Code: "5"}}}
+	for id := 1; id <= cards; id++ {
+		db.dashboards = append(db.dashboards, store.GetDashboardByIdWithStopInfoRow{DashboardID: int64(id), StopCode: strconv.Itoa(7000 + id)})
+	}
+	s := &Server{
+		db: db,
+		wt: externalapi.NewSTIBClient(srv.URL+stibmock.DatasetsPath, "", externalapi.ClientOptions{}),
+	}
+
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/dashboards", nil), httptest.NewRecorder())
+	c.Set("session", &store.Session{ID: "token", Locale: "nl"})
+	if err := s.GetDashboardsHandler(c); err != nil {
+		t.Fatalf("GetDashboardsHandler() error = %v", err)
+	}
+
+	// Then htmx loads the cards of the page all at once
+	var wg sync.WaitGroup
+	errs := make(chan error, cards)
+	for id := 1; id <= cards; id++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := getDashboardContent(s, id); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("handler() error = %v", err)
+	}
+
+	if calls := mock.Calls(); calls != 1 {
+		t.Errorf("expected a single batched upstream call for the page, got %d", calls)
+	}
+	if db.listings != 1 {
+		t.Errorf("expected the dashboards to be listed once for the page, got %d", db.listings)
+	}
+}
+
+func TestGetDashboardContentHandlerLetteredLines(t *testing.T) {
+	now := time.Date(2025, 8, 1, 1, 0, 0, 0, time.UTC)
+
+	wt := externalapi.NewFixtureProvider()
+	for _, lineID := range []string{"N04", "T92"} {
+		wt.Add(externalapi.WaitingTime{
+			PointID: "8042",
+			LineID:  lineID,
+			PassingTimes: externalapi.PassingTimeList{{
+				Destination:         externalapi.I18n{FR: "GARE CENTRALE", NL: "CENTRAAL STATION"},
+				ExpectedArrivalTime: "2025-08-01T03:10:00+02:00",
+				LineID:              lineID,
+			}},
+		})
+	}
+
+	s := &Server{
+		db: &fakeDB{
+			dashboards: []store.GetDashboardByIdWithStopInfoRow{{DashboardID: 1, StopCode: "8042"}},
+			// T92 isn't seeded, it's shown without its metadata
+			lines: map[string]store.Line{
+				"N04": {Code: "N04", Mode: sql.NullString{String: "bus", Valid: true}},
+			},
+		},
+		wt:    wt,
+		clock: func() time.Time { return now },
+	}
+
+	resp, err := getDashboardContent(s, 1)
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	body := resp.Body.String()
+	if !strings.Contains(body, "N04") || !strings.Contains(body, `title="Noctis"`) {
+		t.Errorf("handler() body doesn't show the night line: %s", body)
+	}
+	if !strings.Contains(body, "T92") {
+		t.Errorf("handler() body doesn't show the line missing from the network: %s", body)
+	}
+}
+
+func TestGetDashboardContentHandlerFollowsStation(t *testing.T) {
+	now := time.Date(2025, 8, 1, 8, 0, 0, 0, time.UTC)
+
+	wt := externalapi.NewFixtureProvider()
+	for stopCode, destination := range map[string]string{"5710F": "STOCKEL", "5710G": "GARE DE L'OUEST"} {
+		wt.Add(externalapi.WaitingTime{
+			PointID: stopCode,
+			LineID:  "1",
+			PassingTimes: externalapi.PassingTimeList{{
+				Destination:         externalapi.I18n{FR: destination, NL: destination},
+				ExpectedArrivalTime: "2025-08-01T10:05:00+02:00",
+				LineID:              "1",
+			}},
+		})
+	}
+
+	station := sql.NullInt64{Int64: 7, Valid: true}
+	s := &Server{
+		db: &fakeDB{
+			dashboards: []store.GetDashboardByIdWithStopInfoRow{
+				{DashboardID: 1, StopCode: "5710F", StopStationID: station},
+				{DashboardID: 2, StopCode: "5710F", StopStationID: station, FollowStation: true},
+			},
+			lines:    map[string]store.Line{"1": {Code: "1"}},
+			stations: map[int64][]string{7: {"5710F", "5710G"}},
+		},
+		wt:    wt,
+		clock: func() time.Time { return now },
+	}
+
+	resp, err := getDashboardContent(s, 1)
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	if body := resp.Body.String(); !strings.Contains(body, "STOCKEL") || strings.Contains(body, "OUEST") {
+		t.Errorf("handler() body should only show the platform of the dashboard: %s", body)
+	}
+
+	resp, err = getDashboardContent(s, 2)
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	if body := resp.Body.String(); !strings.Contains(body, "STOCKEL") || !strings.Contains(body, "OUEST") {
+		t.Errorf("handler() body should show every platform of the station: %s", body)
+	}
+}
+
+func getDashboardContent(s *Server, dashboardID int) (*httptest.ResponseRecorder, error) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/dashboards/%d", dashboardID), nil)
+	resp := httptest.NewRecorder()
+	c := e.NewContext(req, resp)
+	c.SetParamNames("dashboardId")
+	c.SetParamValues(strconv.Itoa(dashboardID))
+	c.Set("session", &store.Session{ID: "token", Locale: "nl"})
+
+	return resp, s.GetDashboardContentHandler(c)
+}
+
+func TestGetDashboardContentHandlerDegraded(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		stopRemove bool
+		want       string
+	}{
+		{name: "quota exceeded", err: fmt.Errorf("%w (status 429)", externalapi.ErrQuotaExceeded), want: "Er zijn te veel aanvragen naar de MIVB verstuurd."},
+		{name: "unauthorized", err: fmt.Errorf("%w (status 401)", externalapi.ErrUnauthorized), want: "De toegang tot de MIVB-gegevens is geweigerd."},
+		{name: "unavailable", err: fmt.Errorf("%w (status 503)", externalapi.ErrUpstreamUnavailable), want: "De MIVB-dienst antwoordt niet."},
+		{name: "unexpected error", err: errors.New("connection reset"), want: "De realtime-doorkomsttijden zijn momenteel niet beschikbaar."},
+		{name: "stop removed", stopRemove: true, want: "Deze halte wordt niet meer bediend."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := store.GetDashboardByIdWithStopInfoRow{DashboardID: 1, StopCode: "8042"}
+			if tt.stopRemove {
+				d.StopRemovedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			}
+			s := &Server{
+				db: &fakeDB{dashboards: []store.GetDashboardByIdWithStopInfoRow{d}},
+				wt: failingProvider{err: tt.err},
+			}
+
+			resp, err := getDashboardContent(s, 1)
+			if err != nil {
+				t.Fatalf("handler() error = %v, want the degraded card", err)
+			}
+			if resp.Code != http.StatusOK {
+				t.Errorf("handler() status = %d, want %d", resp.Code, http.StatusOK)
+			}
+			// The card explains the problem in the language of the session, without the raw error
+			body := resp.Body.String()
+			if !strings.Contains(body, tt.want) {
+				t.Errorf("handler() body doesn't explain the degradation with %q: %s", tt.want, body)
+			}
+			if tt.err != nil && strings.Contains(body, tt.err.Error()) {
+				t.Errorf("handler() body shows the upstream error: %s", body)
+			}
+		})
+	}
+}
+
+func TestCreateDashboardHandlerChecksTheStop(t *testing.T) {
+	db := &fakeDB{stops: []store.Stop{
+		{ID: 1, Code: "8042"},
+		{ID: 2, Code: database.UnknownStopCode},
+		{ID: 3, Code: "5000", RemovedAt: sql.NullTime{Time: time.Now(), Valid: true}},
+	}}
+	s := &Server{db: db}
+
+	create := func(stopID string) error {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/dashboards", strings.NewReader(url.Values{"stop_id": {stopID}}.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set("session", &store.Session{ID: "token", Locale: "nl"})
+		return s.CreateDashboardHandler(c)
+	}
+
+	if err := create("1"); err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	for _, stopID := range []string{"42", "2", "3"} {
+		var he *echo.HTTPError
+		if err := create(stopID); !errors.As(err, &he) || he.Code != http.StatusNotFound {
+			t.Errorf("handler() for stop %s error = %v, want a 404", stopID, err)
+		}
+	}
+	if len(db.dashboards) != 1 {
+		t.Errorf("%d dashboards were created, want only the one of the stop in the network", len(db.dashboards))
+	}
+}
+
+func TestLinesPickerHandler(t *testing.T) {
+	s := &Server{db: &fakeDB{
+		// A row per line and direction, the N12 only runs towards the suburbs
+		lines: map[string]store.Line{
+			"2/suburbs":   {Code: "2", Direction: int64(store.TowardsSuburbs)},
+			"2/city":      {Code: "2", Direction: int64(store.TowardsCity)},
+			"11/city":     {Code: "11", Direction: int64(store.TowardsCity)},
+			"N12/suburbs": {Code: "N12", Direction: int64(store.TowardsSuburbs)},
+		},
+	}}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/lines/picker", nil)
+	resp := httptest.NewRecorder()
+	c := e.NewContext(req, resp)
+	c.Set("session", &store.Session{ID: "token", Locale: "nl"})
+	if err := s.LinesPickerHandler(c); err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+
+	body := resp.Body.String()
+	for _, code := range []string{"2", "11", "N12"} {
+		n := strings.Count(body, fmt.Sprintf(`hx-get="/directions/picker/%s"`, code))
+		if n != 1 {
+			t.Errorf("line %s is offered %d times, want once", code, n)
+		}
+	}
+	// Numeric codes are sorted as numbers, lettered ones after them
+	if i, j := strings.Index(body, "/directions/picker/2\""), strings.Index(body, "/directions/picker/11\""); i > j {
+		t.Errorf("line 2 is offered after line 11")
+	}
+}
+
+func TestStopSearchHandler(t *testing.T) {
+	db := &fakeDB{
+		stops:     []store.Stop{{ID: 42, Code: "8282", NameFr: "GARE DE L'OUEST", NameNl: "WESTSTATION"}},
+		stopLines: map[int64][]string{42: {"N04", "5", "1"}},
+	}
+	s := &Server{db: db}
+
+	search := func(query string) string {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/stops/search?q="+url.QueryEscape(query), nil)
+		resp := httptest.NewRecorder()
+		c := e.NewContext(req, resp)
+		c.Set("session", &store.Session{ID: "token", Locale: "nl"})
+		if err := s.StopSearchHandler(c); err != nil {
+			t.Fatalf("handler() error = %v", err)
+		}
+		return resp.Body.String()
+	}
+
+	if body := search(" w "); strings.Contains(body, "WESTSTATION") || len(db.searches) > 0 {
+		t.Errorf("handler() searched a single letter: %s", body)
+	}
+
+	body := search("weststat")
+	if !reflect.DeepEqual(db.searches, []string{"weststat"}) {
+		t.Errorf("handler() searched %v, want the trimmed query", db.searches)
+	}
+	if !strings.Contains(body, "WESTSTATION") || !strings.Contains(body, "1 · 5 · N04") {
+		t.Errorf("handler() body doesn't list the stop and its lines: %s", body)
+	}
+	if !strings.Contains(body, `hx-post="/dashboards"`) || !strings.Contains(body, "&#34;stop_id&#34;: &#34;42&#34;") {
+		t.Errorf("handler() body doesn't create the dashboard of the stop: %s", body)
+	}
+
+	db.stops = nil
+	if body := search("xyz"); !strings.Contains(body, "Geen halte gevonden voor &#34;xyz&#34;") {
+		t.Errorf("handler() body doesn't tell in Dutch that nothing matches: %s", body)
+	}
+}
+
+func TestNearbyStopsHandler(t *testing.T) {
+	s := &Server{db: &fakeDB{
+		nearby: []database.NearbyStop{
+			{Stop: store.Stop{ID: 3, Code: "8032", NameFr: "SCHUMAN", NameNl: "SCHUMAN"}, Distance: 61.4},
+			{Stop: store.Stop{ID: 4, Code: "8022", NameFr: "MAELBEEK", NameNl: "MAALBEEK"}, Distance: 812},
+		},
+		stopLines: map[int64][]string{3: {"5", "1"}},
+	}}
+
+	nearby := func(query string) (*httptest.ResponseRecorder, error) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/stops/nearby?"+query, nil)
+		resp := httptest.NewRecorder()
+		c := e.NewContext(req, resp)
+		c.Set("session", &store.Session{ID: "token", Locale: "nl"})
+		return resp, s.NearbyStopsHandler(c)
+	}
+
+	for _, query := range []string{"lon=4.38", "lat=91&lon=4.38", "lat=50.84&lon=abc", "lat=50.84&lon=4.38&radius=5000"} {
+		_, err := nearby(query)
+		var httpErr *echo.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+			t.Errorf("handler(%q) error = %v, want a bad request", query, err)
+		}
+	}
+
+	resp, err := nearby("lat=50.843&lon=4.38")
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	body := resp.Body.String()
+	if !strings.Contains(body, "SCHUMAN") || !strings.Contains(body, "61 m") || !strings.Contains(body, "1 · 5") {
+		t.Errorf("handler() body doesn't list the closest stop: %s", body)
+	}
+	if !strings.Contains(body, "Haltes in uw buurt") {
+		t.Errorf("handler() body isn't in Dutch: %s", body)
+	}
+	// 500 meters by default
+	if strings.Contains(body, "MAALBEEK") {
+		t.Errorf("handler() body lists a stop out of the radius: %s", body)
+	}
+
+	resp, err = nearby("lat=50.843&lon=4.38&radius=1000")
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	if !strings.Contains(resp.Body.String(), "MAALBEEK") {
+		t.Errorf("handler() body doesn't list the stops of the radius: %s", resp.Body.String())
+	}
+}
+
+func TestPlaceVehicles(t *testing.T) {
+	stops := []store.Stop{
+		{Code: "8011", NameFr: "DE BROUCKERE", NameNl: "DE BROUCKERE"},
+		{Code: "8021", NameFr: "GARE CENTRALE", NameNl: "CENTRAAL STATION"},
+		{Code: "8031", NameFr: "PARC", NameNl: "PARK"},
+	}
+	vehicles := []externalapi.VehiclePosition{
+		{DirectionID: "8031", PointID: "8011", DistanceFromPoint: 0},
+		{DirectionID: "8031", PointID: "8021", DistanceFromPoint: 250},
+		{DirectionID: "8031", PointID: "8031", DistanceFromPoint: 40},
+		{DirectionID: "8031", PointID: "9999", DistanceFromPoint: 0},
+	}
+
+	track := placeVehicles(stops, vehicles, "nl")
+
+	expected := []components.VehicleStop{
+		{Name: "DE BROUCKERE", AtStop: 1},
+		{Name: "CENTRAAL STATION", Leaving: 1},
+		{Name: "PARK", AtStop: 1},
+	}
+	if !reflect.DeepEqual(track, expected) {
+		t.Errorf("placeVehicles() = %+v, want %+v", track, expected)
+	}
+}
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
@@ -10,20 +12,39 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 
 	"github.com/jp-roisin/catch-and-go/internal/database"
+	"github.com/jp-roisin/catch-and-go/internal/externalapi"
+	"github.com/jp-roisin/catch-and-go/internal/poller"
 )
 
 type Server struct {
 	port int
 
-	db database.Service
+	db    database.Service
+	wt    externalapi.WaitingTimeProvider
+	clock externalapi.Clock
+}
+
+// now returns the time departures are computed against.
+func (s *Server) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock()
 }
 
 func NewServer() *http.Server {
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
+	wt, err := externalapi.NewProviderFromEnv()
+	if err != nil {
+		log.Fatalf("Couldn't set up the real-time provider: %v", err)
+	}
+
 	NewServer := &Server{
 		port: port,
 
-		db: database.New(),
+		db:    database.New(),
+		wt:    wt,
+		clock: time.Now,
 	}
 
 	// Declare Server config
@@ -35,5 +56,17 @@ func NewServer() *http.Server {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// Pre-warm the real-time cache for the stops people are watching
+	if refresher, ok := wt.(externalapi.StopRefresher); ok && os.Getenv("POLLER_DISABLED") != "true" {
+		cfg, err := poller.ConfigFromEnv()
+		if err != nil {
+			log.Fatalf("Couldn't configure the poller: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go poller.New(NewServer.db, refresher, cfg).Run(ctx)
+		server.RegisterOnShutdown(cancel)
+	}
+
 	return server
 }